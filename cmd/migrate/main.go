@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/NKV510/subscription-service/internal/config"
+	"github.com/NKV510/subscription-service/migrations"
+	"github.com/NKV510/subscription-service/pkg/database"
+	"github.com/NKV510/subscription-service/pkg/migrator"
+)
+
+const usage = `Usage: migrate <command>
+
+Commands:
+  up       apply all pending migrations
+  down     roll back the last applied migration
+  status   list migrations and whether they are applied
+  version  print the current schema version`
+
+func main() {
+	logger := slog.New(slog.NewJSONHandler(os.Stderr, nil))
+	slog.SetDefault(logger)
+
+	if len(os.Args) != 2 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+	command := os.Args[1]
+
+	cfg := config.Load()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	connectCtx, connectCancel := context.WithTimeout(ctx, 10*time.Second)
+	pool, err := database.NewDBPool(connectCtx, cfg)
+	connectCancel()
+	if err != nil {
+		slog.Error("Failed to connect to database", "error", err)
+		os.Exit(1)
+	}
+	defer pool.Close()
+
+	m, err := migrator.New(pool, migrations.FS, migrations.Funcs)
+	if err != nil {
+		slog.Error("Failed to load migrations", "error", err)
+		os.Exit(1)
+	}
+
+	if err := run(ctx, m, command); err != nil {
+		slog.Error("Migration command failed", "command", command, "error", err)
+		pool.Close()
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, m *migrator.Migrator, command string) error {
+	switch command {
+	case "up":
+		applied, err := m.Up(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("applied %d migration(s)\n", applied)
+
+	case "down":
+		rolledBack, err := m.Down(ctx)
+		if err != nil {
+			return err
+		}
+		if !rolledBack {
+			fmt.Println("no migrations to roll back")
+			return nil
+		}
+		fmt.Println("rolled back 1 migration")
+
+	case "status":
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			applied := "pending"
+			if status.Applied {
+				applied = "applied " + status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%04d  %-40s %s\n", status.Version, status.Name, applied)
+		}
+
+	case "version":
+		version, err := m.Version(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Println(version)
+
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		return fmt.Errorf("unknown command %q", command)
+	}
+
+	return nil
+}
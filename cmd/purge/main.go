@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/NKV510/subscription-service/internal/config"
+	"github.com/NKV510/subscription-service/internal/repository/postgres"
+	"github.com/NKV510/subscription-service/internal/service"
+	"github.com/NKV510/subscription-service/pkg/database"
+)
+
+// purge однократно очищает подписки, удаленные больше purge.retention назад.
+// Подходит для запуска по cron, когда фоновая очистка в сервере отключена
+func main() {
+	logger := slog.New(slog.NewJSONHandler(os.Stderr, nil))
+	slog.SetDefault(logger)
+
+	cfg := config.Load()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	connectCtx, connectCancel := context.WithTimeout(ctx, 10*time.Second)
+	pool, err := database.NewDBPool(connectCtx, cfg)
+	connectCancel()
+	if err != nil {
+		slog.Error("Failed to connect to database", "error", err)
+		os.Exit(1)
+	}
+	defer pool.Close()
+
+	repo := postgres.NewSubscriptionRepository(pool)
+	subscriptionService := service.NewSubscriptionService(repo, cfg.Idempotency.TTL)
+
+	purged, err := subscriptionService.PurgeDeletedSubscriptions(ctx, cfg.Purge.Retention)
+	if err != nil {
+		slog.Error("Purge failed", "error", err)
+		pool.Close()
+		os.Exit(1)
+	}
+	fmt.Printf("purged %d subscription(s)\n", purged)
+}
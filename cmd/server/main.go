@@ -14,7 +14,9 @@ import (
 	"github.com/NKV510/subscription-service/internal/handlers"
 	"github.com/NKV510/subscription-service/internal/repository/postgres"
 	"github.com/NKV510/subscription-service/internal/service"
+	"github.com/NKV510/subscription-service/migrations"
 	"github.com/NKV510/subscription-service/pkg/database"
+	"github.com/NKV510/subscription-service/pkg/migrator"
 	"github.com/gin-gonic/gin"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
@@ -54,31 +56,43 @@ func main() {
 	}
 	defer pool.Close()
 
+	if cfg.Database.AutoMigrate {
+		m, err := migrator.New(pool, migrations.FS, migrations.Funcs)
+		if err != nil {
+			slog.Error("Failed to load migrations", "error", err)
+			os.Exit(1)
+		}
+		// Другая реплика может держать блокировку миграций, поэтому таймаут
+		// больше, чем у подключения
+		migrateCtx, migrateCancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		_, err = m.Up(migrateCtx)
+		migrateCancel()
+		if err != nil {
+			slog.Error("Failed to apply migrations", "error", err)
+			os.Exit(1)
+		}
+	}
+
 	// Инициализация слоев
 	repo := postgres.NewSubscriptionRepository(pool)
-	subscriptionService := service.NewSubscriptionService(repo)
+	subscriptionService := service.NewSubscriptionService(repo, cfg.Idempotency.TTL)
 	subscriptionHandler := handlers.NewSubscriptionHandler(subscriptionService)
 
+	// Фоновая очистка удаленных подписок
+	purgeCtx, purgeCancel := context.WithCancel(context.Background())
+	defer purgeCancel()
+	if cfg.Purge.Interval > 0 {
+		go subscriptionService.RunPurge(purgeCtx, cfg.Purge.Interval, cfg.Purge.Retention)
+	}
+
 	// Настройка роутера
 	router := gin.New()
 	router.Use(gin.Recovery())
+	router.Use(handlers.RequestContextMiddleware())
 	router.Use(handlers.LoggingMiddleware())
 
 	// Маршруты
-	subscriptions := router.Group("/subscriptions")
-	{
-		subscriptions.POST("", subscriptionHandler.CreateSubscription)
-		subscriptions.GET("/:id", subscriptionHandler.GetSubscriptionByID)
-		subscriptions.PUT("/:id", subscriptionHandler.UpdateSubscription)
-		subscriptions.DELETE("/:id", subscriptionHandler.DeleteSubscription)
-		subscriptions.GET("", subscriptionHandler.GetSubscriptionsByUserID)
-	}
-
-	// Ручка для аналитики
-	analytics := router.Group("/analytics")
-	{
-		analytics.GET("/total", subscriptionHandler.GetTotalSpent)
-	}
+	handlers.RegisterRoutes(router, subscriptionHandler)
 	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 	// Health check
 	router.GET("/health", func(c *gin.Context) {
@@ -103,6 +117,7 @@ func main() {
 	<-quit
 
 	slog.Info("Shutting down server...")
+	purgeCancel()
 
 	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
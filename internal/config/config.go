@@ -1,18 +1,33 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"log/slog"
+	"net"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/spf13/viper"
 )
 
+// EnvPrefix префикс переменных окружения: ключ конфигурации database.host
+// переопределяется переменной SUBS_DATABASE_HOST. Для совместимости с
+// docker-compose также читаются DB_HOST, DB_PORT и т.д. (см. envAliases)
+const EnvPrefix = "SUBS"
+
 type Config struct {
 	Server struct {
 		Port string `yaml:"port"`
 	} `yaml:"server"`
 
 	Database struct {
+		// DSN полная строка подключения; если задана, отдельные поля
+		// подключения (host, port, user, password, name, sslmode) не используются
+		DSN          string `yaml:"dsn"`
 		Host         string `yaml:"host"`
 		Port         string `yaml:"port"`
 		User         string `yaml:"user"`
@@ -20,27 +35,161 @@ type Config struct {
 		Name         string `yaml:"name"`
 		SSLMode      string `yaml:"sslmode"`
 		Max_DB_Conns int32  `yaml:"max_db_conns"`
+		// AutoMigrate применяет миграции при старте сервера
+		AutoMigrate bool `yaml:"auto_migrate" mapstructure:"auto_migrate"`
 	} `yaml:"database"`
+
+	Idempotency struct {
+		// TTL сколько хранится ответ на запрос с заголовком Idempotency-Key
+		TTL time.Duration `yaml:"ttl"`
+	} `yaml:"idempotency"`
+
+	Purge struct {
+		// Retention сколько хранятся удаленные подписки до окончательной очистки
+		Retention time.Duration `yaml:"retention"`
+		// Interval период фоновой очистки в сервере; 0 отключает ее
+		// (очистку можно запускать командой cmd/purge)
+		Interval time.Duration `yaml:"interval"`
+	} `yaml:"purge"`
+}
+
+// defaults значения по умолчанию для всех ключей конфигурации
+var defaults = map[string]any{
+	"server.port":           ":8080",
+	"database.dsn":          "",
+	"database.host":         "localhost",
+	"database.port":         "5432",
+	"database.user":         "postgres",
+	"database.password":     "",
+	"database.name":         "subscriptions",
+	"database.sslmode":      "disable",
+	"database.max_db_conns": 10,
+	"database.auto_migrate": false,
+	"idempotency.ttl":       "24h",
+	"purge.retention":       "720h",
+	"purge.interval":        "1h",
+}
+
+// envAliases дополнительные имена переменных окружения, которые читаются
+// после SUBS_*: имена из docker-compose.yml и общепринятый DATABASE_URL
+var envAliases = map[string][]string{
+	"server.port":           {"SERVER_PORT"},
+	"database.dsn":          {"DATABASE_URL"},
+	"database.host":         {"DB_HOST"},
+	"database.port":         {"DB_PORT"},
+	"database.user":         {"DB_USER"},
+	"database.password":     {"DB_PASSWORD"},
+	"database.name":         {"DB_NAME"},
+	"database.sslmode":      {"DB_SSLMODE"},
+	"database.max_db_conns": {"DB_MAX_CONNS"},
+	"database.auto_migrate": {"DB_AUTO_MIGRATE"},
+}
+
+var sslModes = map[string]bool{
+	"disable":     true,
+	"allow":       true,
+	"prefer":      true,
+	"require":     true,
+	"verify-ca":   true,
+	"verify-full": true,
 }
 
+// Load читает конфигурацию с приоритетом: переменные окружения,
+// configs/config.yaml, значения по умолчанию. Файл конфигурации
+// необязателен. При ошибках валидации выводит их все и завершает процесс
 func Load() *Config {
 	var cfg Config
 
-	viper.SetConfigName("config")
-	viper.SetConfigType("yaml")
-	viper.AddConfigPath("./configs")
-	viper.AddConfigPath(".")
+	v := viper.New()
+	v.SetConfigName("config")
+	v.SetConfigType("yaml")
+	v.AddConfigPath("./configs")
+	v.AddConfigPath(".")
 
-	if err := viper.ReadInConfig(); err != nil {
-		slog.Error("Failed to read config file", "error", err)
-		os.Exit(1)
+	for key, value := range defaults {
+		v.SetDefault(key, value)
+
+		envName := EnvPrefix + "_" + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+		if err := v.BindEnv(append([]string{key, envName}, envAliases[key]...)...); err != nil {
+			slog.Error("Failed to bind environment variable", "key", key, "error", err)
+			os.Exit(1)
+		}
+	}
+
+	if err := v.ReadInConfig(); err != nil {
+		var notFound viper.ConfigFileNotFoundError
+		if !errors.As(err, &notFound) {
+			slog.Error("Failed to read config file", "error", err)
+			os.Exit(1)
+		}
+		slog.Warn("Config file not found, using defaults and environment")
 	}
 
-	if err := viper.Unmarshal(&cfg); err != nil {
+	if err := v.Unmarshal(&cfg); err != nil {
 		slog.Error("Failed to unmarshal config", "error", err)
 		os.Exit(1)
 	}
 
+	if err := cfg.Validate(); err != nil {
+		slog.Error("Invalid configuration", "error", err)
+		os.Exit(1)
+	}
+
 	slog.Info("Configuration loaded successfully")
 	return &cfg
 }
+
+// Validate проверяет конфигурацию и возвращает все найденные ошибки сразу
+func (c *Config) Validate() error {
+	var errs []error
+
+	if c.Server.Port == "" {
+		errs = append(errs, errors.New("server.port is required"))
+	} else if _, port, err := net.SplitHostPort(c.Server.Port); err != nil || !validPort(port) {
+		errs = append(errs, fmt.Errorf("server.port %q must be in form [host]:port", c.Server.Port))
+	}
+
+	if c.Database.DSN != "" {
+		if _, err := pgconn.ParseConfig(c.Database.DSN); err != nil {
+			errs = append(errs, errors.New("database.dsn is not a valid connection string"))
+		}
+	} else {
+		if c.Database.Host == "" {
+			errs = append(errs, errors.New("database.host is required"))
+		}
+		if !validPort(c.Database.Port) {
+			errs = append(errs, fmt.Errorf("database.port %q must be a number between 1 and 65535", c.Database.Port))
+		}
+		if c.Database.User == "" {
+			errs = append(errs, errors.New("database.user is required"))
+		}
+		if c.Database.Name == "" {
+			errs = append(errs, errors.New("database.name is required"))
+		}
+		if !sslModes[c.Database.SSLMode] {
+			errs = append(errs, fmt.Errorf("database.sslmode %q is not supported", c.Database.SSLMode))
+		}
+	}
+
+	if c.Database.Max_DB_Conns <= 0 {
+		errs = append(errs, fmt.Errorf("database.max_db_conns must be positive, got %d", c.Database.Max_DB_Conns))
+	}
+
+	if c.Idempotency.TTL <= 0 {
+		errs = append(errs, fmt.Errorf("idempotency.ttl must be positive, got %s", c.Idempotency.TTL))
+	}
+
+	if c.Purge.Retention <= 0 {
+		errs = append(errs, fmt.Errorf("purge.retention must be positive, got %s", c.Purge.Retention))
+	}
+	if c.Purge.Interval < 0 {
+		errs = append(errs, fmt.Errorf("purge.interval must not be negative, got %s", c.Purge.Interval))
+	}
+
+	return errors.Join(errs...)
+}
+
+func validPort(port string) bool {
+	n, err := strconv.Atoi(port)
+	return err == nil && n > 0 && n <= 65535
+}
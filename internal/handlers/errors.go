@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/NKV510/subscription-service/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// respondError сопоставляет доменную ошибку статусу HTTP и отвечает клиенту.
+// Текст ошибок 4xx отдается клиенту как есть (для models.ValidationError -
+// вместе со списком полей), внутренние ошибки скрываются
+func respondError(c *gin.Context, err error, msg string, attrs ...any) {
+	status := errorStatus(err)
+	attrs = append(attrs, "error", err)
+
+	if status >= http.StatusInternalServerError {
+		slog.Error(msg, attrs...)
+		c.JSON(status, models.ErrorResponse{Error: "Internal server error"})
+		return
+	}
+
+	slog.Warn(msg, attrs...)
+	response := models.ErrorResponse{Error: err.Error()}
+	var validationErr *models.ValidationError
+	if errors.As(err, &validationErr) {
+		response.Fields = validationErr.Fields
+	}
+	c.JSON(status, response)
+}
+
+// errorStatus возвращает статус HTTP для ошибки сервиса
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, models.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, models.ErrValidation):
+		return http.StatusBadRequest
+	case errors.Is(err, models.ErrConflict):
+		return http.StatusConflict
+	case errors.Is(err, models.ErrPreconditionFailed):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, models.ErrIdempotencyMismatch):
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusInternalServerError
+	}
+}
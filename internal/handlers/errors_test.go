@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/NKV510/subscription-service/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+func TestRespondError(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		status  int
+		message string // пусто - текст ошибки как есть
+		fields  int
+	}{
+		{"NotFound", fmt.Errorf("%w: subscription 1", models.ErrNotFound), http.StatusNotFound, "", 0},
+		{"DoubleWrapped", fmt.Errorf("delete: %w", fmt.Errorf("%w: subscription 1", models.ErrNotFound)), http.StatusNotFound, "", 0},
+		{"Validation", fmt.Errorf("%w: bad cursor", models.ErrValidation), http.StatusBadRequest, "", 0},
+		{"ValidationFields", models.NewValidationError("price", "must be at least 1"), http.StatusBadRequest, "", 1},
+		{"WrappedValidationFields", fmt.Errorf("row 2: %w", models.NewValidationError("price", "must be at least 1")), http.StatusBadRequest, "", 1},
+		{"Conflict", fmt.Errorf("%w: service name is taken", models.ErrConflict), http.StatusConflict, "", 0},
+		{"PreconditionFailed", fmt.Errorf("%w: version 2, expected 1", models.ErrPreconditionFailed), http.StatusPreconditionFailed, "", 0},
+		{"IdempotencyMismatch", fmt.Errorf("%w: key \"k\"", models.ErrIdempotencyMismatch), http.StatusUnprocessableEntity, "", 0},
+		{"Internal", fmt.Errorf("failed to update: %w", errors.New("connection reset")), http.StatusInternalServerError, "Internal server error", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+
+			respondError(c, tt.err, "Request failed")
+
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			var resp models.ErrorResponse
+			decode(t, w, &resp)
+			message := tt.message
+			if message == "" {
+				message = tt.err.Error()
+			}
+			if resp.Error != message {
+				t.Errorf("error = %q, want %q", resp.Error, message)
+			}
+			if len(resp.Fields) != tt.fields {
+				t.Errorf("fields = %+v, want %d", resp.Fields, tt.fields)
+			}
+		})
+	}
+}
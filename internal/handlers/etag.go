@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/NKV510/subscription-service/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// etag формирует значение заголовка ETag из версии подписки
+func etag(version int) string {
+	return strconv.Quote(strconv.Itoa(version))
+}
+
+// ifMatchVersion разбирает заголовок If-Match. Возвращает nil, если
+// заголовок не передан или равен "*", то есть версия не проверяется
+func ifMatchVersion(c *gin.Context) (*int, error) {
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+	if header == "" || header == "*" {
+		return nil, nil
+	}
+
+	value := strings.TrimPrefix(header, "W/")
+	unquoted, err := strconv.Unquote(value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: If-Match must be a single quoted ETag", models.ErrValidation)
+	}
+
+	version, err := strconv.Atoi(unquoted)
+	if err != nil {
+		return nil, fmt.Errorf("%w: If-Match does not match any subscription version", models.ErrPreconditionFailed)
+	}
+
+	return &version, nil
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestIfMatch(t *testing.T) {
+	// Изменения подписки, принимающие If-Match; setup готовит подписку,
+	// например приостанавливает ее перед возобновлением
+	endpoints := []struct {
+		name   string
+		method string
+		suffix string
+		body   string
+		setup  string
+		status int
+	}{
+		{"Update", http.MethodPut, "", `{"price": 800}`, "", http.StatusOK},
+		{"Delete", http.MethodDelete, "", "", "", http.StatusNoContent},
+		{"Pause", http.MethodPost, "/pause", `{"from": "2025-03-01"}`, "", http.StatusOK},
+		{"Resume", http.MethodPost, "/resume", `{"from": "2025-05-01"}`, "/pause", http.StatusOK},
+		{"Cancel", http.MethodPost, "/cancel", `{"reason_code": "too_expensive"}`, "", http.StatusOK},
+		{"SchedulePriceChange", http.MethodPost, "/prices", `{"price": 900, "effective_from": "03-2025"}`, "", http.StatusOK},
+		{"SetTags", http.MethodPut, "/tags", `{"tags": ["fun"]}`, "", http.StatusOK},
+	}
+
+	// version - версия подписки перед запросом
+	headers := []struct {
+		name    string
+		ifMatch func(version int) string
+		status  int // 0 - статус успеха запроса
+	}{
+		{"Missing", func(int) string { return "" }, 0},
+		{"Current", func(version int) string { return etag(version) }, 0},
+		{"Weak", func(version int) string { return "W/" + etag(version) }, 0},
+		{"Any", func(int) string { return "*" }, 0},
+		{"Stale", func(version int) string { return etag(version - 1) }, http.StatusPreconditionFailed},
+		{"NotVersion", func(int) string { return `"abc"` }, http.StatusPreconditionFailed},
+		{"Unquoted", func(version int) string { return strconv.Itoa(version) }, http.StatusBadRequest},
+		{"Malformed", func(int) string { return `"1", "2"` }, http.StatusBadRequest},
+	}
+
+	for _, endpoint := range endpoints {
+		for _, header := range headers {
+			t.Run(endpoint.name+"/"+header.name, func(t *testing.T) {
+				router := newTestRouter(t)
+				sub := createSubscription(t, router, subscriptionBody(uuid.New()))
+				path := "/subscriptions/" + sub.ID.String()
+
+				version := sub.Version
+				if endpoint.setup != "" {
+					w := serve(t, router, http.MethodPost, path+endpoint.setup, `{"from": "2025-03-01"}`)
+					if w.Code != http.StatusOK {
+						t.Fatalf("setup %s = %d %s, want 200", endpoint.setup, w.Code, w.Body.String())
+					}
+					version++
+				}
+
+				var ifMatch []string
+				if value := header.ifMatch(version); value != "" {
+					ifMatch = []string{"If-Match", value}
+				}
+				w := serve(t, router, endpoint.method, path+endpoint.suffix, endpoint.body, ifMatch...)
+
+				status := header.status
+				if status == 0 {
+					status = endpoint.status
+				}
+				if w.Code != status {
+					t.Fatalf("%s %s = %d %s, want %d", endpoint.method, endpoint.suffix, w.Code, w.Body.String(), status)
+				}
+
+				// Успешное изменение возвращает новую версию, отклоненное ничего не меняет
+				wantETag := ""
+				if status == http.StatusOK {
+					wantETag = etag(version + 1)
+				}
+				if got := w.Header().Get("ETag"); got != wantETag {
+					t.Errorf("ETag = %q, want %q", got, wantETag)
+				}
+				if status != endpoint.status {
+					current := serve(t, router, http.MethodGet, path, "")
+					if got := current.Header().Get("ETag"); got != etag(version) {
+						t.Errorf("ETag after a rejected request = %s, want %s", got, etag(version))
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/NKV510/subscription-service/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// ImportExchangeRates загружает курсы валют из CSV или NDJSON
+// @Summary Import exchange rates
+// @Description Load exchange rates from CSV with a header row (date, from, to, rate) or NDJSON with one ExchangeRateRequest per line. A rate is effective from its date until the next rate of the same pair; a rate for an existing pair and date replaces it. Nothing is saved if any row is invalid
+// @Tags admin
+// @Accept text/csv
+// @Accept application/x-ndjson
+// @Produce json
+// @Param format query string false "Input format: csv or ndjson (default from Content-Type)"
+// @Param input body string true "CSV or NDJSON data"
+// @Success 200 {object} models.ImportExchangeRatesResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /admin/exchange-rates [post]
+func (h *SubscriptionHandler) ImportExchangeRates(c *gin.Context) {
+	format := c.Query("format")
+	if format == "" {
+		format = formatContentTypes[c.ContentType()]
+	}
+	if format == "" {
+		respondError(c, fmt.Errorf("%w: unsupported Content-Type %q, use text/csv or application/x-ndjson",
+			models.ErrValidation, c.ContentType()), "Invalid exchange rates import request")
+		return
+	}
+
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, maxImportBodySize)
+	result, err := h.service.ImportExchangeRates(c.Request.Context(), format, body)
+	if err != nil {
+		respondError(c, err, "Failed to import exchange rates", "format", format)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// ListExchangeRates возвращает загруженные курсы валют
+// @Summary List exchange rates
+// @Description List loaded exchange rates ordered by currency pair and date
+// @Tags admin
+// @Produce json
+// @Param from query string false "Source currency filter (ISO 4217)"
+// @Param to query string false "Target currency filter (ISO 4217)"
+// @Success 200 {object} models.ExchangeRatesResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /admin/exchange-rates [get]
+func (h *SubscriptionHandler) ListExchangeRates(c *gin.Context) {
+	var req models.ListExchangeRatesRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		respondError(c, bindingError(err), "Invalid query parameters")
+		return
+	}
+
+	rates, err := h.service.ListExchangeRates(c.Request.Context(), req)
+	if err != nil {
+		respondError(c, err, "Failed to list exchange rates")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ExchangeRatesResponse{Rates: rates})
+}
@@ -0,0 +1,309 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/NKV510/subscription-service/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// formatMediaTypes типы содержимого ответа для форматов выгрузки
+var formatMediaTypes = map[string]string{
+	models.FormatJSON:   "application/json",
+	models.FormatCSV:    "text/csv",
+	models.FormatNDJSON: "application/x-ndjson",
+}
+
+// exportFlushRows через сколько строк выгрузка отправляется клиенту
+const exportFlushRows = 1000
+
+// responseFormat выбирает формат ответа из параметра format или заголовка
+// Accept среди offered; первый из offered используется по умолчанию
+func responseFormat(c *gin.Context, offered ...string) (string, error) {
+	if format := c.Query("format"); format != "" {
+		for _, allowed := range offered {
+			if format == allowed {
+				return format, nil
+			}
+		}
+		return "", fmt.Errorf("%w: unsupported format %q", models.ErrValidation, format)
+	}
+
+	mediaTypes := make([]string, len(offered))
+	for i, format := range offered {
+		mediaTypes[i] = formatMediaTypes[format]
+	}
+	mediaType := c.NegotiateFormat(mediaTypes...)
+	for i := range mediaTypes {
+		if mediaTypes[i] == mediaType {
+			return offered[i], nil
+		}
+	}
+	return "", errNotAcceptable
+}
+
+// errNotAcceptable ни один из форматов не подходит под заголовок Accept
+var errNotAcceptable = fmt.Errorf("%w: none of the supported formats is acceptable", models.ErrValidation)
+
+// respondFormatError отвечает на ошибку выбора формата: 406 для Accept,
+// 400 для неверного параметра format
+func respondFormatError(c *gin.Context, err error) {
+	if errors.Is(err, errNotAcceptable) {
+		slog.Warn("Not acceptable", "accept", c.GetHeader("Accept"))
+		c.JSON(http.StatusNotAcceptable, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+	respondError(c, err, "Invalid format")
+}
+
+// exportWriter построчно пишет выгрузку в CSV или NDJSON прямо в ответ.
+// Заголовки ответа отправляются при первой строке (или в finish, если строк
+// нет), поэтому ошибку, случившуюся до первой строки, еще можно вернуть
+// обычным ответом
+type exportWriter struct {
+	c        *gin.Context
+	format   string
+	filename string
+	columns  []string
+	csv      *csv.Writer
+	json     *json.Encoder
+	rows     int
+}
+
+func newExportWriter(c *gin.Context, format, filename string, columns []string) *exportWriter {
+	return &exportWriter{c: c, format: format, filename: filename, columns: columns}
+}
+
+// Started сообщает, начата ли отправка ответа
+func (w *exportWriter) Started() bool {
+	return w.csv != nil || w.json != nil
+}
+
+func (w *exportWriter) start() error {
+	w.c.Header("Content-Type", formatMediaTypes[w.format]+"; charset=utf-8")
+	w.c.Header("Content-Disposition",
+		fmt.Sprintf(`attachment; filename="%s.%s"`, w.filename, w.format))
+	w.c.Status(http.StatusOK)
+
+	if w.format == models.FormatNDJSON {
+		w.json = json.NewEncoder(w.c.Writer)
+		return nil
+	}
+	w.csv = csv.NewWriter(w.c.Writer)
+	return w.csv.Write(w.columns)
+}
+
+// Write пишет одну строку: record для CSV в порядке columns, value для NDJSON
+func (w *exportWriter) Write(record []string, value any) error {
+	if !w.Started() {
+		if err := w.start(); err != nil {
+			return err
+		}
+	}
+
+	var err error
+	if w.json != nil {
+		err = w.json.Encode(value)
+	} else {
+		err = w.csv.Write(record)
+	}
+	if err != nil {
+		return err
+	}
+
+	w.rows++
+	if w.rows%exportFlushRows == 0 {
+		return w.flush()
+	}
+	return nil
+}
+
+// Finish дописывает выгрузку; пустая выгрузка состоит из заголовка CSV
+func (w *exportWriter) Finish() error {
+	if !w.Started() {
+		if err := w.start(); err != nil {
+			return err
+		}
+	}
+	return w.flush()
+}
+
+func (w *exportWriter) flush() error {
+	if w.csv != nil {
+		w.csv.Flush()
+		if err := w.csv.Error(); err != nil {
+			return err
+		}
+	}
+	w.c.Writer.Flush()
+	return nil
+}
+
+// subscriptionColumns колонки CSV выгрузки подписок
+var subscriptionColumns = []string{
+	"id", "service_name", "service_id", "price", "currency", "user_id", "start_date", "end_date",
+	"billing_period", "billing_interval_months", "trial_months", "intro_price", "intro_months", "trial_end_date",
+	"monthly_equivalent", "next_charge_date", "status", "version", "created_at", "updated_at",
+}
+
+// optionalInt форматирует необязательное число, пустая строка для nil
+func optionalInt(v *int) string {
+	if v == nil {
+		return ""
+	}
+	return strconv.Itoa(*v)
+}
+
+// optionalUUID форматирует необязательный идентификатор, пустая строка для nil
+func optionalUUID(id *uuid.UUID) string {
+	if id == nil {
+		return ""
+	}
+	return id.String()
+}
+
+// optionalDate форматирует необязательную дату, пустая строка для nil
+func optionalDate(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.DateOnly)
+}
+
+func subscriptionRecord(sub *models.Subscription) []string {
+	return []string{
+		sub.ID.String(),
+		sub.ServiceName,
+		optionalUUID(sub.ServiceID),
+		strconv.Itoa(sub.Price),
+		sub.Currency,
+		sub.UserID.String(),
+		sub.StartDate.Format(time.DateOnly),
+		optionalDate(sub.EndDate),
+		sub.BillingPeriod,
+		optionalInt(sub.BillingIntervalMonths),
+		optionalInt(sub.TrialMonths),
+		optionalInt(sub.IntroPrice),
+		optionalInt(sub.IntroMonths),
+		optionalDate(sub.TrialEndDate),
+		strconv.Itoa(sub.MonthlyEquivalent),
+		optionalDate(sub.NextChargeDate),
+		sub.Status,
+		strconv.Itoa(sub.Version),
+		sub.CreatedAt.Format(time.RFC3339),
+		sub.UpdatedAt.Format(time.RFC3339),
+	}
+}
+
+// ExportSubscriptions выгружает подписки потоком
+// @Summary Export subscriptions
+// @Description Stream all subscriptions matching the listing filters as CSV or NDJSON. Rows are read from the database with a cursor, so exports of any size are not buffered in memory. The format is taken from the format parameter or the Accept header (CSV by default)
+// @Tags subscriptions
+// @Produce text/csv
+// @Produce application/x-ndjson
+// @Param format query string false "Output format: csv (default) or ndjson"
+// @Param user_id query string false "User ID filter"
+// @Param service_name query string false "Service name filter"
+// @Param active_at query string false "Active on day (YYYY-MM-DD) or in month (MM-YYYY)"
+// @Param min_price query int false "Minimum price"
+// @Param max_price query int false "Maximum price"
+// @Param start_from query string false "Start date from (YYYY-MM-DD or MM-YYYY)"
+// @Param start_to query string false "Start date to (YYYY-MM-DD or MM-YYYY)"
+// @Param end_from query string false "End date from (YYYY-MM-DD or MM-YYYY)"
+// @Param end_to query string false "End date to (YYYY-MM-DD or MM-YYYY)"
+// @Param trial_ends_within query int false "Trial period ends within N days from today"
+// @Param tag query []string false "Tag filter, repeat to require several tags" collectionFormat(multi)
+// @Param sort_by query string false "Sort field: start_date (default), price, service_name"
+// @Param order query string false "Sort order: asc or desc (default)"
+// @Success 200 {string} string "CSV with a header row or one JSON subscription per line"
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 406 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /subscriptions/export [get]
+func (h *SubscriptionHandler) ExportSubscriptions(c *gin.Context) {
+	format, err := responseFormat(c, models.FormatCSV, models.FormatNDJSON)
+	if err != nil {
+		respondFormatError(c, err)
+		return
+	}
+
+	var req models.ListSubscriptionsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		respondError(c, bindingError(err), "Invalid query parameters")
+		return
+	}
+
+	w := newExportWriter(c, format, "subscriptions", subscriptionColumns)
+	err = h.service.ExportSubscriptions(c.Request.Context(), req, func(sub *models.Subscription) error {
+		return w.Write(subscriptionRecord(sub), sub)
+	})
+	if err == nil {
+		err = w.Finish()
+	}
+	if err != nil {
+		if w.Started() {
+			// Статус уже отправлен, клиент получит обрезанную выгрузку
+			slog.Error("Export interrupted", "rows", w.rows, "error", err)
+			return
+		}
+		respondError(c, err, "Failed to export subscriptions")
+	}
+}
+
+// writeMonthlySpent отдает помесячные траты в CSV или NDJSON
+func writeMonthlySpent(c *gin.Context, format string, months []models.MonthlySpent) error {
+	w := newExportWriter(c, format, "monthly_spent",
+		[]string{"month", "total", "active_subscriptions", "monthly_equivalent"})
+	for _, month := range months {
+		record := []string{
+			month.Month.String(),
+			strconv.Itoa(month.Total),
+			strconv.Itoa(month.ActiveSubscriptions),
+			strconv.Itoa(month.MonthlyEquivalent),
+		}
+		if err := w.Write(record, month); err != nil {
+			return err
+		}
+	}
+	return w.Finish()
+}
+
+// writeSpentBreakdown отдает траты по группам в CSV или NDJSON. Колонки
+// измерений, по которым не группировали, и тег подписок без тегов остаются
+// пустыми
+func writeSpentBreakdown(c *gin.Context, format string, groups []models.SpentGroup) error {
+	w := newExportWriter(c, format, "spent_breakdown",
+		[]string{"service_name", "user_id", "tag", "total", "subscriptions", "monthly_equivalent"})
+	for _, group := range groups {
+		var serviceName, userID, tag string
+		if group.ServiceName != nil {
+			serviceName = *group.ServiceName
+		}
+		if group.UserID != nil {
+			userID = group.UserID.String()
+		}
+		if group.Tag != nil {
+			tag = *group.Tag
+		}
+		record := []string{
+			serviceName,
+			userID,
+			tag,
+			strconv.Itoa(group.Total),
+			strconv.Itoa(group.Subscriptions),
+			strconv.Itoa(group.MonthlyEquivalent),
+		}
+		if err := w.Write(record, group); err != nil {
+			return err
+		}
+	}
+	return w.Finish()
+}
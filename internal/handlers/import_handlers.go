@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/NKV510/subscription-service/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// maxImportBodySize ограничение размера тела запроса импорта
+const maxImportBodySize = 32 << 20
+
+// formatContentTypes сопоставляет типы содержимого форматам импорта и выгрузки
+var formatContentTypes = map[string]string{
+	"text/csv":             models.FormatCSV,
+	"application/csv":      models.FormatCSV,
+	"application/x-ndjson": models.FormatNDJSON,
+	"application/ndjson":   models.FormatNDJSON,
+	"application/jsonl":    models.FormatNDJSON,
+}
+
+// ImportSubscriptions создает подписки из CSV или NDJSON
+// @Summary Import subscriptions
+// @Description Bulk-create subscriptions from CSV with a header row (service_name, price, user_id, start_date and optional currency, end_date, billing_period, billing_interval_months, trial_months, intro_price, intro_months) or NDJSON with one CreateSubscriptionRequest per line. Service names are resolved through the service catalog, an empty price is taken from it. The format is taken from the format parameter or Content-Type. In atomic mode nothing is imported if any row is invalid; in best_effort mode valid rows are imported. The response reports the result of every row
+// @Tags subscriptions
+// @Accept text/csv
+// @Accept application/x-ndjson
+// @Produce json
+// @Param format query string false "Input format: csv or ndjson (default from Content-Type)"
+// @Param mode query string false "Import mode: atomic (default) or best_effort"
+// @Param input body string true "CSV or NDJSON data"
+// @Success 201 {object} models.ImportSubscriptionsResponse "At least one subscription imported"
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 422 {object} models.ImportSubscriptionsResponse "No subscriptions imported because of invalid rows"
+// @Failure 500 {object} models.ErrorResponse
+// @Router /subscriptions/import [post]
+func (h *SubscriptionHandler) ImportSubscriptions(c *gin.Context) {
+	format := c.Query("format")
+	if format == "" {
+		format = formatContentTypes[c.ContentType()]
+	}
+	if format == "" {
+		respondError(c, fmt.Errorf("%w: unsupported Content-Type %q, use text/csv or application/x-ndjson",
+			models.ErrValidation, c.ContentType()), "Invalid import request")
+		return
+	}
+
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, maxImportBodySize)
+	result, err := h.service.ImportSubscriptions(c.Request.Context(), format, c.Query("mode"), body)
+	if err != nil {
+		respondError(c, err, "Failed to import subscriptions", "format", format)
+		return
+	}
+
+	if result.Imported == 0 {
+		c.JSON(http.StatusUnprocessableEntity, result)
+		return
+	}
+	c.JSON(http.StatusCreated, result)
+}
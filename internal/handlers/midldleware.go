@@ -4,9 +4,21 @@ import (
 	"log/slog"
 	"time"
 
+	"github.com/NKV510/subscription-service/internal/reqctx"
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 )
 
+// Заголовки, из которых берутся сведения о запросе для журнала изменений
+const (
+	requestIDHeader = "X-Request-ID"
+	actorHeader     = "X-Actor"
+)
+
+// maxHeaderValueLength ограничение длины значений X-Request-ID и X-Actor,
+// совпадающее с размером колонок журнала изменений
+const maxHeaderValueLength = 255
+
 func LoggingMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		start := time.Now()
@@ -21,6 +33,28 @@ func LoggingMiddleware() gin.HandlerFunc {
 			"status", c.Writer.Status(),
 			"duration", duration,
 			"client_ip", c.ClientIP(),
+			"request_id", reqctx.RequestID(c.Request.Context()),
 		)
 	}
 }
+
+// RequestContextMiddleware кладет в контекст запроса его идентификатор
+// (из X-Request-ID или новый) и инициатора изменений из X-Actor.
+// Идентификатор запроса возвращается клиенту в X-Request-ID
+func RequestContextMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(requestIDHeader)
+		if requestID == "" || len(requestID) > maxHeaderValueLength {
+			requestID = uuid.NewString()
+		}
+		c.Header(requestIDHeader, requestID)
+
+		ctx := reqctx.WithRequestID(c.Request.Context(), requestID)
+		if actor := c.GetHeader(actorHeader); actor != "" && len(actor) <= maxHeaderValueLength {
+			ctx = reqctx.WithActor(ctx, actor)
+		}
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+	}
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import "github.com/gin-gonic/gin"
+
+// RegisterRoutes регистрирует маршруты API обработчика h
+func RegisterRoutes(router gin.IRouter, h *SubscriptionHandler) {
+	subscriptions := router.Group("/subscriptions")
+	{
+		subscriptions.POST("", h.CreateSubscription)
+		subscriptions.POST("/import", h.ImportSubscriptions)
+		subscriptions.GET("/export", h.ExportSubscriptions)
+		subscriptions.GET("/upcoming", h.GetUpcomingCharges)
+		subscriptions.GET("/:id", h.GetSubscriptionByID)
+		subscriptions.PUT("/:id", h.UpdateSubscription)
+		subscriptions.DELETE("/:id", h.DeleteSubscription)
+		subscriptions.POST("/:id/restore", h.RestoreSubscription)
+		subscriptions.POST("/:id/pause", h.PauseSubscription)
+		subscriptions.POST("/:id/resume", h.ResumeSubscription)
+		subscriptions.POST("/:id/cancel", h.CancelSubscription)
+		subscriptions.GET("/:id/history", h.GetSubscriptionHistory)
+		subscriptions.POST("/:id/prices", h.SchedulePriceChange)
+		subscriptions.GET("/:id/prices", h.GetSubscriptionPrices)
+		subscriptions.PUT("/:id/tags", h.SetSubscriptionTags)
+		subscriptions.GET("", h.ListSubscriptions)
+	}
+
+	// Ручка для аналитики
+	analytics := router.Group("/analytics")
+	{
+		analytics.GET("/total", h.GetTotalSpent)
+		analytics.GET("/monthly", h.GetMonthlySpent)
+		analytics.GET("/breakdown", h.GetSpentBreakdown)
+		analytics.GET("/churn", h.GetChurn)
+	}
+
+	// Справочные данные для аналитики
+	admin := router.Group("/admin")
+	{
+		admin.POST("/exchange-rates", h.ImportExchangeRates)
+		admin.GET("/exchange-rates", h.ListExchangeRates)
+		admin.POST("/services", h.CreateService)
+		admin.GET("/services", h.ListServices)
+		admin.GET("/services/:id", h.GetService)
+		admin.PUT("/services/:id", h.UpdateService)
+		admin.DELETE("/services/:id", h.DeleteService)
+	}
+
+	// Теги пользователей
+	tags := router.Group("/tags")
+	{
+		tags.POST("", h.CreateTag)
+		tags.GET("", h.ListTags)
+		tags.PUT("/:id", h.RenameTag)
+		tags.DELETE("/:id", h.DeleteTag)
+	}
+}
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/NKV510/subscription-service/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// CreateService добавляет сервис в каталог
+// @Summary Create catalog service
+// @Description Add a service to the catalog. Subscription names are resolved through the catalog ignoring case and extra spaces: a subscription created with the name or any alias of a service is stored under its canonical name, and default_price is used when the subscription has no price. Existing subscriptions outside the catalog with one of the names are attached to the service; their version is incremented and the change is recorded in their history
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param input body models.CreateServiceRequest true "Service data"
+// @Success 201 {object} models.Service
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse "Name or alias belongs to another service"
+// @Failure 500 {object} models.ErrorResponse
+// @Router /admin/services [post]
+func (h *SubscriptionHandler) CreateService(c *gin.Context) {
+	var req models.CreateServiceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, bindingError(err), "Invalid request body")
+		return
+	}
+
+	svc, err := h.service.CreateService(c.Request.Context(), req)
+	if err != nil {
+		respondError(c, err, "Failed to create service")
+		return
+	}
+
+	c.JSON(http.StatusCreated, svc)
+}
+
+// ListServices возвращает каталог сервисов
+// @Summary List catalog services
+// @Description List catalog services with their aliases ordered by name
+// @Tags admin
+// @Produce json
+// @Success 200 {object} models.ServicesResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /admin/services [get]
+func (h *SubscriptionHandler) ListServices(c *gin.Context) {
+	services, err := h.service.ListServices(c.Request.Context())
+	if err != nil {
+		respondError(c, err, "Failed to list services")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ServicesResponse{Services: services})
+}
+
+// GetService получает сервис каталога по ID
+// @Summary Get catalog service
+// @Description Get catalog service by its ID
+// @Tags admin
+// @Produce json
+// @Param id path string true "Service ID"
+// @Success 200 {object} models.Service
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /admin/services/{id} [get]
+func (h *SubscriptionHandler) GetService(c *gin.Context) {
+	idStr := c.Param("id")
+
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		slog.Warn("Invalid UUID format", "id", idStr, "error", err)
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid service ID"})
+		return
+	}
+
+	svc, err := h.service.GetService(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err, "Failed to get service", "id", id)
+		return
+	}
+
+	c.JSON(http.StatusOK, svc)
+}
+
+// UpdateService обновляет сервис каталога
+// @Summary Update catalog service
+// @Description Update a catalog service. A new name is applied to all subscriptions of the service; aliases, if given, replace the current ones and attach subscriptions outside the catalog with these names. Every changed subscription gets a new version and a history record. default_price 0 removes the default price
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path string true "Service ID"
+// @Param input body models.UpdateServiceRequest true "Service update data"
+// @Success 200 {object} models.Service
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse "Name or alias belongs to another service"
+// @Failure 500 {object} models.ErrorResponse
+// @Router /admin/services/{id} [put]
+func (h *SubscriptionHandler) UpdateService(c *gin.Context) {
+	idStr := c.Param("id")
+
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		slog.Warn("Invalid UUID format", "id", idStr, "error", err)
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid service ID"})
+		return
+	}
+
+	var req models.UpdateServiceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, bindingError(err), "Invalid request body")
+		return
+	}
+
+	svc, err := h.service.UpdateService(c.Request.Context(), id, req)
+	if err != nil {
+		respondError(c, err, "Failed to update service", "id", id)
+		return
+	}
+
+	c.JSON(http.StatusOK, svc)
+}
+
+// DeleteService удаляет сервис из каталога
+// @Summary Delete catalog service
+// @Description Remove a service from the catalog. Its subscriptions keep their name but are no longer attached to the service; their version is incremented and the change is recorded in their history
+// @Tags admin
+// @Param id path string true "Service ID"
+// @Success 204
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /admin/services/{id} [delete]
+func (h *SubscriptionHandler) DeleteService(c *gin.Context) {
+	idStr := c.Param("id")
+
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		slog.Warn("Invalid UUID format", "id", idStr, "error", err)
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid service ID"})
+		return
+	}
+
+	if err := h.service.DeleteService(c.Request.Context(), id); err != nil {
+		respondError(c, err, "Failed to delete service", "id", id)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"fmt"
 	"log/slog"
 	"net/http"
 
@@ -20,13 +21,16 @@ func NewSubscriptionHandler(service *service.SubscriptionService) *SubscriptionH
 
 // CreateSubscription создает новую подписку
 // @Summary Create subscription
-// @Description Create a new subscription
+// @Description Create a new subscription. service_name is resolved through the service catalog ignoring case and extra spaces and stored under the canonical name with a link to the service; a name missing from the catalog is stored as given, without extra spaces and without a service, and does not add a service to the catalog. price defaults to the default price of the catalog service. Dates are accepted as YYYY-MM-DD or MM-YYYY (start of the month for start_date, end of the month for end_date). The price is charged on start_date and then at the start of every billing_period counted from start_date (monthly by default; custom requires billing_interval_months); in months without that day the charge falls on the last day of the month. The first trial_months months are free and the following intro_months months are charged at intro_price. Requests retried with the same Idempotency-Key get the original response instead of creating a duplicate
 // @Tags subscriptions
 // @Accept json
 // @Produce json
+// @Param Idempotency-Key header string false "Unique key of the request for safe retries"
 // @Param input body models.CreateSubscriptionRequest true "Subscription data"
 // @Success 201 {object} models.Subscription
+// @Header 201 {string} Idempotent-Replayed "true if the response was replayed for a retried request"
 // @Failure 400 {object} models.ErrorResponse
+// @Failure 422 {object} models.ErrorResponse "Idempotency-Key reused with a different request"
 // @Failure 500 {object} models.ErrorResponse
 // @Router /subscriptions [post]
 
@@ -34,18 +38,29 @@ func (h *SubscriptionHandler) CreateSubscription(c *gin.Context) {
 	var req models.CreateSubscriptionRequest
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		slog.Warn("Invalid request body", "error", err)
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		respondError(c, bindingError(err), "Invalid request body")
 		return
 	}
 
-	subscription, err := h.service.CreateSubscription(c.Request.Context(), req)
+	var (
+		subscription *models.Subscription
+		err          error
+	)
+	if key := c.GetHeader("Idempotency-Key"); key != "" {
+		var replayed bool
+		subscription, replayed, err = h.service.CreateSubscriptionIdempotent(c.Request.Context(), key, req)
+		if replayed {
+			c.Header("Idempotent-Replayed", "true")
+		}
+	} else {
+		subscription, err = h.service.CreateSubscription(c.Request.Context(), req)
+	}
 	if err != nil {
-		slog.Error("Failed to create subscription", "error", err)
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Internal server error"})
+		respondError(c, err, "Failed to create subscription")
 		return
 	}
 
+	c.Header("ETag", etag(subscription.Version))
 	c.JSON(http.StatusCreated, subscription)
 }
 
@@ -57,6 +72,7 @@ func (h *SubscriptionHandler) CreateSubscription(c *gin.Context) {
 // @Produce json
 // @Param id path string true "Subscription ID"
 // @Success 200 {object} models.Subscription
+// @Header 200 {string} ETag "Subscription version"
 // @Failure 400 {object} models.ErrorResponse
 // @Failure 404 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
@@ -73,25 +89,28 @@ func (h *SubscriptionHandler) GetSubscriptionByID(c *gin.Context) {
 
 	subscription, err := h.service.GetSubscriptionByID(c.Request.Context(), id)
 	if err != nil {
-		slog.Error("Failed to get subscription", "id", id, "error", err)
-		c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "Subscription not found"})
+		respondError(c, err, "Failed to get subscription", "id", id)
 		return
 	}
 
+	c.Header("ETag", etag(subscription.Version))
 	c.JSON(http.StatusOK, subscription)
 }
 
 // UpdateSubscription обновляет подписку
 // @Summary Update subscription
-// @Description Update existing subscription
+// @Description Update existing subscription. service_name is resolved through the service catalog as on creation. With If-Match the update is applied only if the ETag matches the current version
 // @Tags subscriptions
 // @Accept json
 // @Produce json
 // @Param id path string true "Subscription ID"
+// @Param If-Match header string false "ETag from GET /subscriptions/{id}"
 // @Param input body models.UpdateSubscriptionRequest true "Subscription update data"
 // @Success 200 {object} models.Subscription
+// @Header 200 {string} ETag "New subscription version"
 // @Failure 400 {object} models.ErrorResponse
 // @Failure 404 {object} models.ErrorResponse
+// @Failure 412 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 // @Router /subscriptions/{id} [put]
 func (h *SubscriptionHandler) UpdateSubscription(c *gin.Context) {
@@ -106,31 +125,38 @@ func (h *SubscriptionHandler) UpdateSubscription(c *gin.Context) {
 
 	var req models.UpdateSubscriptionRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		slog.Warn("Invalid request body", "error", err)
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		respondError(c, bindingError(err), "Invalid request body")
+		return
+	}
+
+	expectedVersion, err := ifMatchVersion(c)
+	if err != nil {
+		respondError(c, err, "Invalid If-Match header", "id", id)
 		return
 	}
 
-	subscription, err := h.service.UpdateSubscription(c.Request.Context(), id, req)
+	subscription, err := h.service.UpdateSubscription(c.Request.Context(), id, req, expectedVersion)
 	if err != nil {
-		slog.Error("Failed to update subscription", "id", id, "error", err)
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Internal server error"})
+		respondError(c, err, "Failed to update subscription", "id", id)
 		return
 	}
 
+	c.Header("ETag", etag(subscription.Version))
 	c.JSON(http.StatusOK, subscription)
 }
 
 // DeleteSubscription удаляет подписку
 // @Summary Delete subscription
-// @Description Delete subscription by ID
+// @Description Soft-delete subscription by ID. A deleted subscription is hidden from reads and analytics and can be restored until it is purged after the retention period. With If-Match the subscription is deleted only if the ETag matches the current version
 // @Tags subscriptions
 // @Accept json
 // @Produce json
 // @Param id path string true "Subscription ID"
+// @Param If-Match header string false "ETag from GET /subscriptions/{id}"
 // @Success 204
 // @Failure 400 {object} models.ErrorResponse
 // @Failure 404 {object} models.ErrorResponse
+// @Failure 412 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 // @Router /subscriptions/{id} [delete]
 func (h *SubscriptionHandler) DeleteSubscription(c *gin.Context) {
@@ -143,60 +169,405 @@ func (h *SubscriptionHandler) DeleteSubscription(c *gin.Context) {
 		return
 	}
 
-	if err := h.service.DeleteSubscription(c.Request.Context(), id); err != nil {
-		slog.Error("Failed to delete subscription", "id", id, "error", err)
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Internal server error"})
+	expectedVersion, err := ifMatchVersion(c)
+	if err != nil {
+		respondError(c, err, "Invalid If-Match header", "id", id)
+		return
+	}
+
+	if err := h.service.DeleteSubscription(c.Request.Context(), id, expectedVersion); err != nil {
+		respondError(c, err, "Failed to delete subscription", "id", id)
 		return
 	}
 
 	c.Status(http.StatusNoContent)
 }
 
-// GetSubscriptionsByUserID возвращает подписки пользователя
-// @Summary Get user subscriptions
-// @Description Get all subscriptions for a user
+// RestoreSubscription восстанавливает удаленную подписку
+// @Summary Restore deleted subscription
+// @Description Restore a soft-deleted subscription that has not been purged yet
+// @Tags subscriptions
+// @Produce json
+// @Param id path string true "Subscription ID"
+// @Success 200 {object} models.Subscription
+// @Header 200 {string} ETag "New subscription version"
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /subscriptions/{id}/restore [post]
+func (h *SubscriptionHandler) RestoreSubscription(c *gin.Context) {
+	idStr := c.Param("id")
+
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		slog.Warn("Invalid UUID format", "id", idStr, "error", err)
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid subscription ID"})
+		return
+	}
+
+	subscription, err := h.service.RestoreSubscription(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err, "Failed to restore subscription", "id", id)
+		return
+	}
+
+	c.Header("ETag", etag(subscription.Version))
+	c.JSON(http.StatusOK, subscription)
+}
+
+// PauseSubscription приостанавливает подписку
+// @Summary Pause subscription
+// @Description Pause a subscription from a given day (YYYY-MM-DD) or month (MM-YYYY, from its first day), today by default. Charges due while the subscription is paused are skipped by spend analytics, and months it is paused for entirely are not counted in monthly analytics. The body is optional
+// @Tags subscriptions
+// @Accept json
+// @Produce json
+// @Param id path string true "Subscription ID"
+// @Param If-Match header string false "Expected subscription version (ETag)"
+// @Param pause body models.PauseSubscriptionRequest false "Date the pause starts"
+// @Success 200 {object} models.Subscription
+// @Header 200 {string} ETag "New subscription version"
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 412 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /subscriptions/{id}/pause [post]
+func (h *SubscriptionHandler) PauseSubscription(c *gin.Context) {
+	idStr := c.Param("id")
+
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		slog.Warn("Invalid UUID format", "id", idStr, "error", err)
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid subscription ID"})
+		return
+	}
+
+	expectedVersion, err := ifMatchVersion(c)
+	if err != nil {
+		respondError(c, err, "Invalid If-Match header", "id", id)
+		return
+	}
+
+	var req models.PauseSubscriptionRequest
+	if err := bindOptionalJSON(c, &req); err != nil {
+		respondError(c, bindingError(err), "Invalid request body")
+		return
+	}
+
+	subscription, err := h.service.PauseSubscription(c.Request.Context(), id, req, expectedVersion)
+	if err != nil {
+		respondError(c, err, "Failed to pause subscription", "id", id)
+		return
+	}
+
+	c.Header("ETag", etag(subscription.Version))
+	c.JSON(http.StatusOK, subscription)
+}
+
+// ResumeSubscription возобновляет приостановленную подписку
+// @Summary Resume subscription
+// @Description End the pause of a subscription from a given day (YYYY-MM-DD) or month (MM-YYYY, from its first day), today by default. Charges continue from the next billing cycle. The body is optional
+// @Tags subscriptions
+// @Accept json
+// @Produce json
+// @Param id path string true "Subscription ID"
+// @Param If-Match header string false "Expected subscription version (ETag)"
+// @Param resume body models.ResumeSubscriptionRequest false "Date the subscription is resumed from"
+// @Success 200 {object} models.Subscription
+// @Header 200 {string} ETag "New subscription version"
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 412 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /subscriptions/{id}/resume [post]
+func (h *SubscriptionHandler) ResumeSubscription(c *gin.Context) {
+	idStr := c.Param("id")
+
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		slog.Warn("Invalid UUID format", "id", idStr, "error", err)
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid subscription ID"})
+		return
+	}
+
+	expectedVersion, err := ifMatchVersion(c)
+	if err != nil {
+		respondError(c, err, "Invalid If-Match header", "id", id)
+		return
+	}
+
+	var req models.ResumeSubscriptionRequest
+	if err := bindOptionalJSON(c, &req); err != nil {
+		respondError(c, bindingError(err), "Invalid request body")
+		return
+	}
+
+	subscription, err := h.service.ResumeSubscription(c.Request.Context(), id, req, expectedVersion)
+	if err != nil {
+		respondError(c, err, "Failed to resume subscription", "id", id)
+		return
+	}
+
+	c.Header("ETag", etag(subscription.Version))
+	c.JSON(http.StatusOK, subscription)
+}
+
+// CancelSubscription отменяет подписку с указанием причины
+// @Summary Cancel subscription
+// @Description Cancel a subscription: it ends on the last day of the effective month (MM-YYYY, the current month by default) and the reason is stored for churn analytics. Cancellation can only shorten a subscription; cancelling again replaces the reason. Extending the subscription later via update removes the cancellation
+// @Tags subscriptions
+// @Accept json
+// @Produce json
+// @Param id path string true "Subscription ID"
+// @Param If-Match header string false "Expected subscription version (ETag)"
+// @Param cancellation body models.CancelSubscriptionRequest true "Effective month and reason: too_expensive, not_using, switched_service, technical_issues or other"
+// @Success 200 {object} models.Subscription
+// @Header 200 {string} ETag "New subscription version"
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 412 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /subscriptions/{id}/cancel [post]
+func (h *SubscriptionHandler) CancelSubscription(c *gin.Context) {
+	idStr := c.Param("id")
+
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		slog.Warn("Invalid UUID format", "id", idStr, "error", err)
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid subscription ID"})
+		return
+	}
+
+	expectedVersion, err := ifMatchVersion(c)
+	if err != nil {
+		respondError(c, err, "Invalid If-Match header", "id", id)
+		return
+	}
+
+	var req models.CancelSubscriptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, bindingError(err), "Invalid request body")
+		return
+	}
+
+	subscription, err := h.service.CancelSubscription(c.Request.Context(), id, req, expectedVersion)
+	if err != nil {
+		respondError(c, err, "Failed to cancel subscription", "id", id)
+		return
+	}
+
+	c.Header("ETag", etag(subscription.Version))
+	c.JSON(http.StatusOK, subscription)
+}
+
+// GetSubscriptionHistory возвращает журнал изменений подписки
+// @Summary Get subscription change history
+// @Description Get create/update/delete/restore/pause/resume/cancel events of a subscription in chronological order, including deleted subscriptions. The actor is taken from the X-Actor header of the changing request
+// @Tags subscriptions
+// @Produce json
+// @Param id path string true "Subscription ID"
+// @Success 200 {array} models.SubscriptionEvent
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /subscriptions/{id}/history [get]
+func (h *SubscriptionHandler) GetSubscriptionHistory(c *gin.Context) {
+	idStr := c.Param("id")
+
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		slog.Warn("Invalid UUID format", "id", idStr, "error", err)
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid subscription ID"})
+		return
+	}
+
+	events, err := h.service.GetSubscriptionHistory(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err, "Failed to get subscription history", "id", id)
+		return
+	}
+
+	c.JSON(http.StatusOK, events)
+}
+
+// SchedulePriceChange планирует изменение цены подписки
+// @Summary Schedule price change
+// @Description Set a new subscription price effective from a given day (YYYY-MM-DD) or month (MM-YYYY, from its first day) until the next change. Spend analytics charge the price effective on each charge date, so earlier charges keep the old price. The date may be in the past; a change from the same date replaces the scheduled one. The subscription version is incremented and the change is recorded in its history. Returns all prices of the subscription
 // @Tags subscriptions
 // @Accept json
 // @Produce json
-// @Param user_id query string true "User ID"
+// @Param id path string true "Subscription ID"
+// @Param If-Match header string false "Expected subscription version (ETag)"
+// @Param change body models.SchedulePriceChangeRequest true "New price and the date it is effective from"
+// @Success 200 {object} models.SubscriptionPricesResponse
+// @Header 200 {string} ETag "New subscription version"
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 412 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /subscriptions/{id}/prices [post]
+func (h *SubscriptionHandler) SchedulePriceChange(c *gin.Context) {
+	idStr := c.Param("id")
+
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		slog.Warn("Invalid UUID format", "id", idStr, "error", err)
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid subscription ID"})
+		return
+	}
+
+	expectedVersion, err := ifMatchVersion(c)
+	if err != nil {
+		respondError(c, err, "Invalid If-Match header", "id", id)
+		return
+	}
+
+	var req models.SchedulePriceChangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, bindingError(err), "Invalid request body")
+		return
+	}
+
+	prices, subscription, err := h.service.SchedulePriceChange(c.Request.Context(), id, req, expectedVersion)
+	if err != nil {
+		respondError(c, err, "Failed to schedule price change", "id", id)
+		return
+	}
+
+	c.Header("ETag", etag(subscription.Version))
+	c.JSON(http.StatusOK, models.SubscriptionPricesResponse{Prices: prices})
+}
+
+// GetSubscriptionPrices возвращает цены подписки
+// @Summary Get subscription prices
+// @Description Get the price effective from start_date followed by all scheduled price changes in the order they take effect
+// @Tags subscriptions
+// @Produce json
+// @Param id path string true "Subscription ID"
+// @Success 200 {object} models.SubscriptionPricesResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /subscriptions/{id}/prices [get]
+func (h *SubscriptionHandler) GetSubscriptionPrices(c *gin.Context) {
+	idStr := c.Param("id")
+
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		slog.Warn("Invalid UUID format", "id", idStr, "error", err)
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid subscription ID"})
+		return
+	}
+
+	prices, err := h.service.GetSubscriptionPrices(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err, "Failed to get subscription prices", "id", id)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SubscriptionPricesResponse{Prices: prices})
+}
+
+// ListSubscriptions возвращает страницу подписок
+// @Summary List subscriptions
+// @Description List subscriptions with optional filters, sorting and cursor pagination. The body is an array of subscriptions; when there are more pages, the X-Next-Cursor header holds the cursor to pass as cursor for the next one and the Link header holds the URL of the next page
+// @Tags subscriptions
+// @Accept json
+// @Produce json
+// @Param user_id query string false "User ID filter"
+// @Param service_name query string false "Service name filter"
+// @Param active_at query string false "Active on day (YYYY-MM-DD) or in month (MM-YYYY)"
+// @Param min_price query int false "Minimum price"
+// @Param max_price query int false "Maximum price"
+// @Param start_from query string false "Start date from (YYYY-MM-DD or MM-YYYY)"
+// @Param start_to query string false "Start date to (YYYY-MM-DD or MM-YYYY)"
+// @Param end_from query string false "End date from (YYYY-MM-DD or MM-YYYY)"
+// @Param end_to query string false "End date to (YYYY-MM-DD or MM-YYYY)"
+// @Param trial_ends_within query int false "Trial period ends within N days from today"
+// @Param tag query []string false "Tag filter, repeat to require several tags" collectionFormat(multi)
+// @Param sort_by query string false "Sort field: start_date (default), price, service_name"
+// @Param order query string false "Sort order: asc or desc (default)"
+// @Param limit query int false "Page size (default 50, max 1000)"
+// @Param cursor query string false "Cursor from the previous page"
 // @Success 200 {array} models.Subscription
+// @Header 200 {string} X-Next-Cursor "Cursor of the next page, absent on the last page"
+// @Header 200 {string} Link "URL of the next page with rel=\"next\", absent on the last page"
 // @Failure 400 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 // @Router /subscriptions [get]
-func (h *SubscriptionHandler) GetSubscriptionsByUserID(c *gin.Context) {
-	userIDStr := c.Query("user_id")
-	if userIDStr == "" {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "user_id query parameter is required"})
+func (h *SubscriptionHandler) ListSubscriptions(c *gin.Context) {
+	var req models.ListSubscriptionsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		respondError(c, bindingError(err), "Invalid query parameters")
 		return
 	}
 
-	userID, err := uuid.Parse(userIDStr)
+	subscriptions, nextCursor, err := h.service.ListSubscriptions(c.Request.Context(), req)
 	if err != nil {
-		slog.Warn("Invalid user_id format", "user_id", userIDStr, "error", err)
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid user_id format"})
+		respondError(c, err, "Failed to list subscriptions")
 		return
 	}
 
-	subscriptions, err := h.service.GetSubscriptionsByUserID(c.Request.Context(), userID)
+	if subscriptions == nil {
+		subscriptions = []*models.Subscription{}
+	}
+
+	// Тело остается массивом, как до появления пагинации; курсор следующей
+	// страницы передается в заголовках
+	if nextCursor != "" {
+		next := *c.Request.URL
+		query := next.Query()
+		query.Set("cursor", nextCursor)
+		next.RawQuery = query.Encode()
+
+		c.Header("X-Next-Cursor", nextCursor)
+		c.Header("Link", fmt.Sprintf(`<%s>; rel="next"`, next.RequestURI()))
+	}
+
+	c.JSON(http.StatusOK, subscriptions)
+}
+
+// GetUpcomingCharges возвращает предстоящие списания
+// @Summary Upcoming charges
+// @Description List charges due in the next days starting today: a charge on start_date and at the start of every following billing cycle counted from start_date, at the price effective on that day. The last cycle cut short by end_date is prorated by days. Totals are summed per currency
+// @Tags subscriptions
+// @Produce json
+// @Param user_id query string false "User ID filter"
+// @Param service_name query string false "Service name filter"
+// @Param days query int false "Number of days including today (1-366, default 30)"
+// @Success 200 {object} models.UpcomingChargesResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /subscriptions/upcoming [get]
+func (h *SubscriptionHandler) GetUpcomingCharges(c *gin.Context) {
+	var req models.UpcomingChargesRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		respondError(c, bindingError(err), "Invalid query parameters")
+		return
+	}
+
+	upcoming, err := h.service.GetUpcomingCharges(c.Request.Context(), req)
 	if err != nil {
-		slog.Error("Failed to get subscriptions by user ID", "user_id", userID, "error", err)
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Internal server error"})
+		respondError(c, err, "Failed to get upcoming charges")
 		return
 	}
 
-	c.JSON(http.StatusOK, subscriptions)
+	c.JSON(http.StatusOK, upcoming)
 }
 
 // GetTotalSpent вычисляет суммарные траты за период
 // @Summary Calculate total spent
-// @Description Calculate total amount spent on subscriptions for a period
+// @Description Calculate total amount spent on subscriptions for a period: the price of every billing cycle of each subscription inside the window. Cycles are counted from start_date; a cycle cut short by end_date or lying partly outside the window is prorated by days. Without currency the matching subscriptions must share one currency, otherwise 400 is returned; with currency the charges of every month are converted at the latest exchange rate dated not after the end of that month (the inverse rate is used if there is no direct one)
 // @Tags analytics
 // @Accept json
 // @Produce json
-// @Param from query string true "Start date (MM-YYYY)"
-// @Param to query string true "End date (MM-YYYY)"
+// @Param from query string true "Start date (YYYY-MM-DD or MM-YYYY)"
+// @Param to query string true "End date (YYYY-MM-DD or MM-YYYY)"
 // @Param user_id query string false "User ID filter"
 // @Param service_name query string false "Service name filter"
+// @Param currency query string false "ISO 4217 currency to convert charges to"
 // @Success 200 {object} models.TotalSpentResponse
 // @Failure 400 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
@@ -204,17 +575,138 @@ func (h *SubscriptionHandler) GetSubscriptionsByUserID(c *gin.Context) {
 func (h *SubscriptionHandler) GetTotalSpent(c *gin.Context) {
 	var req models.TotalSpentRequest
 	if err := c.ShouldBindQuery(&req); err != nil {
-		slog.Warn("Invalid query parameters", "error", err)
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		respondError(c, bindingError(err), "Invalid query parameters")
+		return
+	}
+
+	total, err := h.service.GetTotalSpent(c.Request.Context(), req.From, req.To, req.UserID, req.ServiceName, req.Currency)
+	if err != nil {
+		respondError(c, err, "Failed to calculate total spent")
+		return
+	}
+
+	c.JSON(http.StatusOK, total)
+}
+
+// GetMonthlySpent возвращает помесячную разбивку трат за период
+// @Summary Monthly spend breakdown
+// @Description Amount charged, number of active subscriptions and the sum of their monthly equivalent prices for every month of a period. The matching subscriptions must share one currency, otherwise 400 is returned. CSV or NDJSON is returned when requested with the format parameter or the Accept header
+// @Tags analytics
+// @Accept json
+// @Produce json
+// @Produce text/csv
+// @Produce application/x-ndjson
+// @Param format query string false "Output format: json (default), csv or ndjson"
+// @Param from query string true "Start date (YYYY-MM-DD or MM-YYYY)"
+// @Param to query string true "End date (YYYY-MM-DD or MM-YYYY)"
+// @Param user_id query string false "User ID filter"
+// @Param service_name query string false "Service name filter"
+// @Success 200 {object} models.MonthlySpentResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 406 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /analytics/monthly [get]
+func (h *SubscriptionHandler) GetMonthlySpent(c *gin.Context) {
+	format, err := responseFormat(c, models.FormatJSON, models.FormatCSV, models.FormatNDJSON)
+	if err != nil {
+		respondFormatError(c, err)
+		return
+	}
+
+	var req models.MonthlySpentRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		respondError(c, bindingError(err), "Invalid query parameters")
+		return
+	}
+
+	months, err := h.service.GetMonthlySpent(c.Request.Context(), req.From, req.To, req.UserID, req.ServiceName)
+	if err != nil {
+		respondError(c, err, "Failed to calculate monthly spent")
+		return
+	}
+
+	if format != models.FormatJSON {
+		if err := writeMonthlySpent(c, format, months); err != nil {
+			slog.Error("Failed to write monthly spent", "format", format, "error", err)
+		}
+		return
+	}
+	c.JSON(http.StatusOK, models.MonthlySpentResponse{Months: months})
+}
+
+// GetSpentBreakdown возвращает траты, сгруппированные по измерениям
+// @Summary Spend breakdown
+// @Description Amount charged for a period and monthly equivalent prices of subscriptions active in it, aggregated by service, user, tag or their combination (tags of different users with the same name ignoring case and extra spaces form one group), sorted by total and limited to top-N groups. The matching subscriptions must share one currency, otherwise 400 is returned. CSV or NDJSON is returned when requested with the format parameter or the Accept header
+// @Tags analytics
+// @Accept json
+// @Produce json
+// @Produce text/csv
+// @Produce application/x-ndjson
+// @Param format query string false "Output format: json (default), csv or ndjson"
+// @Param from query string true "Start date (YYYY-MM-DD or MM-YYYY)"
+// @Param to query string true "End date (YYYY-MM-DD or MM-YYYY)"
+// @Param group_by query string true "Comma-separated grouping dimensions: service_name, user_id, tag. With tag a subscription counts in the group of each of its tags, untagged subscriptions form a group without tag"
+// @Param limit query int false "Number of top groups to return (default 10)"
+// @Param user_id query string false "User ID filter"
+// @Param service_name query string false "Service name filter"
+// @Success 200 {object} models.SpentBreakdownResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 406 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /analytics/breakdown [get]
+func (h *SubscriptionHandler) GetSpentBreakdown(c *gin.Context) {
+	format, err := responseFormat(c, models.FormatJSON, models.FormatCSV, models.FormatNDJSON)
+	if err != nil {
+		respondFormatError(c, err)
+		return
+	}
+
+	var req models.SpentBreakdownRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		respondError(c, bindingError(err), "Invalid query parameters")
+		return
+	}
+
+	groups, err := h.service.GetSpentBreakdown(c.Request.Context(), req)
+	if err != nil {
+		respondError(c, err, "Failed to calculate spent breakdown")
+		return
+	}
+
+	if format != models.FormatJSON {
+		if err := writeSpentBreakdown(c, format, groups); err != nil {
+			slog.Error("Failed to write spent breakdown", "format", format, "error", err)
+		}
+		return
+	}
+	c.JSON(http.StatusOK, models.SpentBreakdownResponse{Groups: groups})
+}
+
+// GetChurn возвращает отток подписок по месяцам
+// @Summary Churn analytics
+// @Description Number of subscription cancellations taking effect in every month of a period, with a breakdown by reason and by service. Months without cancellations are returned too
+// @Tags analytics
+// @Produce json
+// @Param from query string true "Start date (YYYY-MM-DD or MM-YYYY)"
+// @Param to query string true "End date (YYYY-MM-DD or MM-YYYY)"
+// @Param user_id query string false "User ID filter"
+// @Param service_name query string false "Service name filter"
+// @Success 200 {object} models.ChurnResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /analytics/churn [get]
+func (h *SubscriptionHandler) GetChurn(c *gin.Context) {
+	var req models.ChurnRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		respondError(c, bindingError(err), "Invalid query parameters")
 		return
 	}
 
-	total, err := h.service.GetTotalSpent(c.Request.Context(), req.From, req.To, req.UserID, req.ServiceName)
+	churn, err := h.service.GetChurn(c.Request.Context(), req)
 	if err != nil {
-		slog.Error("Failed to calculate total spent", "error", err)
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Internal server error"})
+		respondError(c, err, "Failed to calculate churn")
 		return
 	}
 
-	c.JSON(http.StatusOK, models.TotalSpentResponse{Total: total})
+	c.JSON(http.StatusOK, churn)
 }
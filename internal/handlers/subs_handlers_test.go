@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NKV510/subscription-service/internal/models"
+	"github.com/NKV510/subscription-service/internal/repository/memory"
+	"github.com/NKV510/subscription-service/internal/service"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// newTestRouter возвращает роутер со всеми маршрутами API поверх
+// хранилища в памяти
+func newTestRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	subscriptionService := service.NewSubscriptionService(memory.NewSubscriptionRepository(), time.Hour)
+	router := gin.New()
+	router.Use(RequestContextMiddleware())
+	RegisterRoutes(router, NewSubscriptionHandler(subscriptionService))
+	return router
+}
+
+// serve выполняет запрос к router; headers - пары имя, значение
+func serve(t *testing.T, router http.Handler, method, target, body string, headers ...string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// decode разбирает тело ответа w в v
+func decode(t *testing.T, w *httptest.ResponseRecorder, v any) {
+	t.Helper()
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatalf("decode response %q: %v", w.Body.String(), err)
+	}
+}
+
+// createSubscription создает подписку через API и возвращает ее
+func createSubscription(t *testing.T, router http.Handler, body string) models.Subscription {
+	t.Helper()
+	w := serve(t, router, http.MethodPost, "/subscriptions", body)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("POST /subscriptions = %d %s, want 201", w.Code, w.Body.String())
+	}
+	var sub models.Subscription
+	decode(t, w, &sub)
+	return sub
+}
+
+func subscriptionBody(userID uuid.UUID) string {
+	return `{"service_name": "Netflix", "price": 700, "user_id": "` + userID.String() + `", "start_date": "01-2025"}`
+}
+
+func TestCreateSubscriptionHandler(t *testing.T) {
+	userID := uuid.New().String()
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		fields []string
+	}{
+		{
+			name:   "Created",
+			body:   `{"service_name": "Netflix", "price": 700, "user_id": "` + userID + `", "start_date": "2025-01-15"}`,
+			status: http.StatusCreated,
+		},
+		{
+			name:   "MissingFields",
+			body:   `{"price": 700}`,
+			status: http.StatusBadRequest,
+			fields: []string{"service_name", "user_id", "start_date"},
+		},
+		{
+			name:   "WrongType",
+			body:   `{"service_name": "Netflix", "price": "700", "user_id": "` + userID + `", "start_date": "01-2025"}`,
+			status: http.StatusBadRequest,
+			fields: []string{"price"},
+		},
+		{
+			name:   "InvalidDate",
+			body:   `{"service_name": "Netflix", "price": 700, "user_id": "` + userID + `", "start_date": "January"}`,
+			status: http.StatusBadRequest,
+			fields: []string{"start_date"},
+		},
+		{
+			name:   "MalformedJSON",
+			body:   `{"service_name": `,
+			status: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(t, newTestRouter(t), http.MethodPost, "/subscriptions", tt.body)
+			if w.Code != tt.status {
+				t.Fatalf("POST /subscriptions = %d %s, want %d", w.Code, w.Body.String(), tt.status)
+			}
+			if tt.status == http.StatusCreated {
+				if got := w.Header().Get("ETag"); got != `"1"` {
+					t.Errorf("ETag = %s, want \"1\"", got)
+				}
+				return
+			}
+
+			var resp models.ErrorResponse
+			decode(t, w, &resp)
+			var fields []string
+			for _, field := range resp.Fields {
+				fields = append(fields, field.Field)
+			}
+			if strings.Join(fields, ",") != strings.Join(tt.fields, ",") {
+				t.Errorf("invalid fields = %v, want %v", fields, tt.fields)
+			}
+		})
+	}
+}
+
+func TestSubscriptionLifecycle(t *testing.T) {
+	router := newTestRouter(t)
+	sub := createSubscription(t, router, subscriptionBody(uuid.New()))
+	path := "/subscriptions/" + sub.ID.String()
+
+	w := serve(t, router, http.MethodGet, path, "")
+	if w.Code != http.StatusOK || w.Header().Get("ETag") != `"1"` {
+		t.Fatalf("GET = %d, ETag %s, want 200 and \"1\"", w.Code, w.Header().Get("ETag"))
+	}
+	var got models.Subscription
+	decode(t, w, &got)
+	if got.ID != sub.ID || got.ServiceName != "Netflix" || got.Price != 700 {
+		t.Errorf("GET = %+v, want %+v", got, sub)
+	}
+
+	w = serve(t, router, http.MethodPut, path, `{"price": 800}`)
+	if w.Code != http.StatusOK || w.Header().Get("ETag") != `"2"` {
+		t.Fatalf("PUT = %d %s, ETag %s, want 200 and \"2\"", w.Code, w.Body.String(), w.Header().Get("ETag"))
+	}
+	decode(t, w, &got)
+	if got.Price != 800 {
+		t.Errorf("price after PUT = %d, want 800", got.Price)
+	}
+
+	w = serve(t, router, http.MethodGet, "/subscriptions", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /subscriptions = %d %s, want 200", w.Code, w.Body.String())
+	}
+	var listed []models.Subscription
+	decode(t, w, &listed)
+	if len(listed) != 1 || listed[0].ID != sub.ID {
+		t.Errorf("GET /subscriptions = %+v, want only %s", listed, sub.ID)
+	}
+
+	if w = serve(t, router, http.MethodDelete, path, ""); w.Code != http.StatusNoContent {
+		t.Fatalf("DELETE = %d %s, want 204", w.Code, w.Body.String())
+	}
+	if w = serve(t, router, http.MethodGet, path, ""); w.Code != http.StatusNotFound {
+		t.Errorf("GET after DELETE = %d, want 404", w.Code)
+	}
+	if w = serve(t, router, http.MethodPost, path+"/restore", ""); w.Code != http.StatusOK {
+		t.Errorf("POST restore = %d %s, want 200", w.Code, w.Body.String())
+	}
+}
+
+func TestSubscriptionNotFound(t *testing.T) {
+	router := newTestRouter(t)
+	missing := "/subscriptions/" + uuid.NewString()
+
+	tests := []struct {
+		method, target, body string
+		status               int
+	}{
+		{http.MethodGet, missing, "", http.StatusNotFound},
+		{http.MethodPut, missing, `{"price": 800}`, http.StatusNotFound},
+		{http.MethodDelete, missing, "", http.StatusNotFound},
+		{http.MethodGet, missing + "/history", "", http.StatusNotFound},
+		{http.MethodGet, "/subscriptions/not-a-uuid", "", http.StatusBadRequest},
+		{http.MethodDelete, "/subscriptions/not-a-uuid", "", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.target, func(t *testing.T) {
+			if w := serve(t, router, tt.method, tt.target, tt.body); w.Code != tt.status {
+				t.Errorf("%s %s = %d %s, want %d", tt.method, tt.target, w.Code, w.Body.String(), tt.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/NKV510/subscription-service/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// CreateTag добавляет тег
+// @Summary Create tag
+// @Description Add a tag (spending category) the subscriptions of a user can be marked with. Every user has own tags; tag names of a user are compared ignoring case and extra spaces
+// @Tags tags
+// @Accept json
+// @Produce json
+// @Param input body models.CreateTagRequest true "Tag data"
+// @Success 201 {object} models.Tag
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse "Tag already exists"
+// @Failure 500 {object} models.ErrorResponse
+// @Router /tags [post]
+func (h *SubscriptionHandler) CreateTag(c *gin.Context) {
+	var req models.CreateTagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, bindingError(err), "Invalid request body")
+		return
+	}
+
+	tag, err := h.service.CreateTag(c.Request.Context(), req)
+	if err != nil {
+		respondError(c, err, "Failed to create tag")
+		return
+	}
+
+	c.JSON(http.StatusCreated, tag)
+}
+
+// ListTags возвращает теги
+// @Summary List tags
+// @Description List tags of all users or of one user ordered by name
+// @Tags tags
+// @Produce json
+// @Param user_id query string false "User ID filter"
+// @Success 200 {object} models.TagsResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /tags [get]
+func (h *SubscriptionHandler) ListTags(c *gin.Context) {
+	var userID *uuid.UUID
+	if userIDStr, ok := c.GetQuery("user_id"); ok {
+		id, err := uuid.Parse(userIDStr)
+		if err != nil {
+			slog.Warn("Invalid UUID format", "user_id", userIDStr, "error", err)
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid user ID"})
+			return
+		}
+		userID = &id
+	}
+
+	tags, err := h.service.ListTags(c.Request.Context(), userID)
+	if err != nil {
+		respondError(c, err, "Failed to list tags")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.TagsResponse{Tags: tags})
+}
+
+// RenameTag переименовывает тег
+// @Summary Rename tag
+// @Description Rename a tag. Subscriptions marked with it get the new name, a new version and a history record
+// @Tags tags
+// @Accept json
+// @Produce json
+// @Param id path string true "Tag ID"
+// @Param input body models.TagRequest true "New tag name"
+// @Success 200 {object} models.Tag
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse "Tag already exists"
+// @Failure 500 {object} models.ErrorResponse
+// @Router /tags/{id} [put]
+func (h *SubscriptionHandler) RenameTag(c *gin.Context) {
+	idStr := c.Param("id")
+
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		slog.Warn("Invalid UUID format", "id", idStr, "error", err)
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid tag ID"})
+		return
+	}
+
+	var req models.TagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, bindingError(err), "Invalid request body")
+		return
+	}
+
+	tag, err := h.service.RenameTag(c.Request.Context(), id, req)
+	if err != nil {
+		respondError(c, err, "Failed to rename tag", "id", id)
+		return
+	}
+
+	c.JSON(http.StatusOK, tag)
+}
+
+// DeleteTag удаляет тег
+// @Summary Delete tag
+// @Description Delete a tag and remove it from all subscriptions; each of them gets a new version and a history record
+// @Tags tags
+// @Param id path string true "Tag ID"
+// @Success 204
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /tags/{id} [delete]
+func (h *SubscriptionHandler) DeleteTag(c *gin.Context) {
+	idStr := c.Param("id")
+
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		slog.Warn("Invalid UUID format", "id", idStr, "error", err)
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid tag ID"})
+		return
+	}
+
+	if err := h.service.DeleteTag(c.Request.Context(), id); err != nil {
+		respondError(c, err, "Failed to delete tag", "id", id)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// SetSubscriptionTags заменяет теги подписки
+// @Summary Set subscription tags
+// @Description Replace the tags of a subscription with tags of its user. Tags the user does not have yet are created; an empty list removes all tags
+// @Tags subscriptions
+// @Accept json
+// @Produce json
+// @Param id path string true "Subscription ID"
+// @Param If-Match header string false "Expected subscription version (ETag)"
+// @Param input body models.SetTagsRequest true "Subscription tags"
+// @Success 200 {object} models.Subscription
+// @Header 200 {string} ETag "New subscription version"
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 412 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /subscriptions/{id}/tags [put]
+func (h *SubscriptionHandler) SetSubscriptionTags(c *gin.Context) {
+	idStr := c.Param("id")
+
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		slog.Warn("Invalid UUID format", "id", idStr, "error", err)
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid subscription ID"})
+		return
+	}
+
+	expectedVersion, err := ifMatchVersion(c)
+	if err != nil {
+		respondError(c, err, "Invalid If-Match header", "id", id)
+		return
+	}
+
+	var req models.SetTagsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, bindingError(err), "Invalid request body")
+		return
+	}
+
+	subscription, err := h.service.SetSubscriptionTags(c.Request.Context(), id, req, expectedVersion)
+	if err != nil {
+		respondError(c, err, "Failed to set subscription tags", "id", id)
+		return
+	}
+
+	c.Header("ETag", etag(subscription.Version))
+	c.JSON(http.StatusOK, subscription)
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/NKV510/subscription-service/internal/models"
+	"github.com/google/uuid"
+)
+
+func TestTagRoutes(t *testing.T) {
+	router := newTestRouter(t)
+	userID := uuid.NewString()
+
+	w := serve(t, router, http.MethodPost, "/tags", `{"user_id": "`+userID+`", "name": "fun"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("POST /tags = %d %s, want 201", w.Code, w.Body.String())
+	}
+	var tag models.Tag
+	decode(t, w, &tag)
+
+	w = serve(t, router, http.MethodGet, "/tags?user_id="+userID, "")
+	var listed models.TagsResponse
+	decode(t, w, &listed)
+	if w.Code != http.StatusOK || len(listed.Tags) != 1 || listed.Tags[0].ID != tag.ID {
+		t.Errorf("GET /tags = %d %+v, want only tag %s", w.Code, listed, tag.ID)
+	}
+
+	if w = serve(t, router, http.MethodPut, "/tags/"+tag.ID.String(), `{"name": "films"}`); w.Code != http.StatusOK {
+		t.Errorf("PUT /tags/{id} = %d %s, want 200", w.Code, w.Body.String())
+	}
+	// Теги - данные пользователей, а не справочник администратора
+	if w = serve(t, router, http.MethodGet, "/admin/tags", ""); w.Code != http.StatusNotFound {
+		t.Errorf("GET /admin/tags = %d, want 404", w.Code)
+	}
+	if w = serve(t, router, http.MethodDelete, "/tags/"+tag.ID.String(), ""); w.Code != http.StatusNoContent {
+		t.Errorf("DELETE /tags/{id} = %d %s, want 204", w.Code, w.Body.String())
+	}
+}
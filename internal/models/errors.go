@@ -0,0 +1,74 @@
+package models
+
+import (
+	"errors"
+	"strings"
+)
+
+// Доменные ошибки. Хранилища и сервис оборачивают их через %w, а обработчики
+// сопоставляют со статусами HTTP: ErrNotFound - 404, ErrValidation - 400,
+// ErrConflict - 409, ErrPreconditionFailed - 412, ErrIdempotencyMismatch - 422
+var (
+	ErrNotFound            = errors.New("not found")
+	ErrValidation          = errors.New("validation error")
+	ErrConflict            = errors.New("conflict")
+	ErrPreconditionFailed  = errors.New("precondition failed")
+	ErrIdempotencyMismatch = errors.New("idempotency key reused with a different request")
+)
+
+// FieldError ошибка в значении одного поля запроса
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError ошибки проверки запроса по полям. Оборачивает
+// ErrValidation, поэтому errors.Is(err, ErrValidation) для нее истинно
+type ValidationError struct {
+	Fields []FieldError
+}
+
+// NewValidationError возвращает ошибку проверки одного поля
+func NewValidationError(field, message string) *ValidationError {
+	return &ValidationError{Fields: []FieldError{{Field: field, Message: message}}}
+}
+
+// Add добавляет ошибку поля
+func (e *ValidationError) Add(field, message string) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Message: message})
+}
+
+// Merge добавляет ошибки полей из err. Ошибка без разбивки по полям
+// добавляется с пустым именем поля
+func (e *ValidationError) Merge(err error) {
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		e.Fields = append(e.Fields, validationErr.Fields...)
+		return
+	}
+	e.Add("", err.Error())
+}
+
+// Err возвращает e, если есть хотя бы одна ошибка поля, иначе nil
+func (e *ValidationError) Err() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		if field.Field == "" {
+			messages[i] = field.Message
+		} else {
+			messages[i] = field.Field + ": " + field.Message
+		}
+	}
+	return ErrValidation.Error() + ": " + strings.Join(messages, "; ")
+}
+
+func (e *ValidationError) Unwrap() error {
+	return ErrValidation
+}
@@ -1,44 +1,803 @@
 package models
 
 import (
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 )
 
 type Subscription struct {
-	ID          uuid.UUID  `json:"id"`
-	ServiceName string     `json:"service_name" binding:"required"`
-	Price       int        `json:"price" binding:"required,min=1"`
-	UserID      uuid.UUID  `json:"user_id" binding:"required"`
-	StartDate   time.Time  `json:"start_date" binding:"required"`
-	EndDate     *time.Time `json:"end_date,omitempty"`
+	ID          uuid.UUID `json:"id"`
+	ServiceName string    `json:"service_name" binding:"required"`
+	// ServiceID сервис каталога, к которому приведено ServiceName
+	ServiceID *uuid.UUID `json:"service_id,omitempty"`
+	Price     int        `json:"price" binding:"required,min=1"` // цена с start_date до первого PriceChange
+	Currency  string     `json:"currency" example:"RUB"`         // код ISO 4217
+	UserID    uuid.UUID  `json:"user_id" binding:"required"`
+	StartDate time.Time  `json:"start_date" binding:"required"`
+	EndDate   *time.Time `json:"end_date,omitempty"`
+	// BillingPeriod период оплаты, за который списывается Price;
+	// BillingIntervalMonths задан только для периода custom
+	BillingPeriod         string `json:"billing_period"`
+	BillingIntervalMonths *int   `json:"billing_interval_months,omitempty"`
+	// TrialMonths бесплатные месяцы с start_date; следующие IntroMonths
+	// месяцев списывается IntroPrice вместо цены
+	TrialMonths *int `json:"trial_months,omitempty"`
+	IntroPrice  *int `json:"intro_price,omitempty"`
+	IntroMonths *int `json:"intro_months,omitempty"`
+	// TrialEndDate последний день пробного периода; вычисляется, не хранится
+	TrialEndDate *time.Time `json:"trial_end_date,omitempty"`
+	// MonthlyEquivalent цена, приведенная к месяцу; вычисляется, не хранится
+	MonthlyEquivalent int `json:"monthly_equivalent"`
+	// NextChargeDate ближайшее списание начиная с сегодняшнего дня; пусто,
+	// если после end_date списаний не будет. Вычисляется, не хранится
+	NextChargeDate *time.Time `json:"next_charge_date,omitempty"`
+	// Status состояние подписки на сегодня; вычисляется, не хранится
+	Status string `json:"status" example:"active"`
+	// Pauses приостановки подписки по возрастанию PausedFrom
+	Pauses    []Pause   `json:"pauses,omitempty"`
+	Tags      []string  `json:"tags,omitempty"` // названия тегов по возрастанию
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// DeletedAt время мягкого удаления; удаленные подписки не видны в
+	// чтении и аналитике и могут быть восстановлены до очистки
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
 }
 
 type CreateSubscriptionRequest struct {
-	ServiceName string    `json:"service_name" binding:"required"`
-	Price       int       `json:"price" binding:"required,min=1"`
+	ServiceName string    `json:"service_name" binding:"required"`  // название или псевдоним сервиса из каталога
+	Price       int       `json:"price" binding:"omitempty,min=1"`  // по умолчанию цена сервиса из каталога
+	Currency    string    `json:"currency,omitempty" example:"RUB"` // код ISO 4217, по умолчанию RUB
 	UserID      uuid.UUID `json:"user_id" binding:"required"`
-	StartDate   string    `json:"start_date" binding:"required"` // формат "MM-YYYY"
+	StartDate   string    `json:"start_date" binding:"required"` // формат "YYYY-MM-DD" или "MM-YYYY"
+	EndDate     *string   `json:"end_date,omitempty"`            // формат "YYYY-MM-DD" или "MM-YYYY", не раньше start_date
+	// BillingPeriod weekly, monthly (по умолчанию), quarterly, yearly или
+	// custom - каждые BillingIntervalMonths месяцев
+	BillingPeriod         string `json:"billing_period,omitempty"`
+	BillingIntervalMonths *int   `json:"billing_interval_months,omitempty"`
+	// TrialMonths бесплатные месяцы с start_date; IntroPrice списывается
+	// вместо цены следующие IntroMonths месяцев, задаются вместе
+	TrialMonths *int `json:"trial_months,omitempty"`
+	IntroPrice  *int `json:"intro_price,omitempty"`
+	IntroMonths *int `json:"intro_months,omitempty"`
+}
+
+// DefaultCurrency валюта подписки, если она не указана
+const DefaultCurrency = "RUB"
+
+// Периоды оплаты подписки. Периоды в месяцах отсчитываются от первого
+// числа месяца начала подписки, недельные - от start_date. Списание
+// происходит в день начала подписки и далее в начале каждого следующего
+// периода; первый период, начатый не с его начала, и последний, прерванный
+// end_date, оплачиваются пропорционально числу дней
+const (
+	BillingWeekly    = "weekly"
+	BillingMonthly   = "monthly"
+	BillingQuarterly = "quarterly"
+	BillingYearly    = "yearly"
+	BillingCustom    = "custom"
+)
+
+// MaxBillingIntervalMonths максимальная длина периода custom в месяцах
+const MaxBillingIntervalMonths = 120
+
+// IsBillingPeriod сообщает, поддерживается ли период оплаты
+func IsBillingPeriod(period string) bool {
+	switch period {
+	case BillingWeekly, BillingMonthly, BillingQuarterly, BillingYearly, BillingCustom:
+		return true
+	}
+	return false
+}
+
+// BillingMonths возвращает длину периода оплаты в месяцах; для weekly - 0
+func BillingMonths(period string, intervalMonths *int) int {
+	switch period {
+	case BillingWeekly:
+		return 0
+	case BillingQuarterly:
+		return 3
+	case BillingYearly:
+		return 12
+	case BillingCustom:
+		if intervalMonths != nil {
+			return *intervalMonths
+		}
+	}
+	return 1
+}
+
+// MonthlyEquivalent приводит цену за период оплаты к месяцу (в году 52
+// недели) с округлением до целого, как ROUND в postgres
+func MonthlyEquivalent(price int, period string, intervalMonths *int) int {
+	months := BillingMonths(period, intervalMonths)
+	if months == 0 {
+		return (2*price*52 + 12) / 24
+	}
+	return (2*price + months) / (2 * months)
+}
+
+// SetMonthlyEquivalent пересчитывает MonthlyEquivalent по цене и периоду
+func (s *Subscription) SetMonthlyEquivalent() {
+	s.MonthlyEquivalent = MonthlyEquivalent(s.Price, s.BillingPeriod, s.BillingIntervalMonths)
+}
+
+// Состояния подписки
+const (
+	StatusActive    = "active"
+	StatusPaused    = "paused"
+	StatusEnded     = "ended"
+	StatusScheduled = "scheduled"
+)
+
+// Pause приостановка подписки с PausedFrom до ResumedFrom (не включая):
+// списания, приходящиеся на приостановку, пропускаются. Пока ResumedFrom
+// пусто, подписка приостановлена бессрочно
+type Pause struct {
+	PausedFrom  time.Time  `json:"paused_from"`
+	ResumedFrom *time.Time `json:"resumed_from,omitempty"`
+}
+
+// PausedOn сообщает, приостановлена ли подписка в день date
+func (s *Subscription) PausedOn(date time.Time) bool {
+	return s.PausedThrough(date, date)
+}
+
+// PausedThrough сообщает, приостановлена ли подписка весь период [first, last]
+func (s *Subscription) PausedThrough(first, last time.Time) bool {
+	for _, pause := range s.Pauses {
+		if !pause.PausedFrom.After(first) && (pause.ResumedFrom == nil || pause.ResumedFrom.After(last)) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckPause проверяет, что подписку можно приостановить с даты from:
+// она не приостановлена и from не раньше окончания последней приостановки
+func (s *Subscription) CheckPause(from time.Time) error {
+	for _, pause := range s.Pauses {
+		if pause.ResumedFrom == nil {
+			return fmt.Errorf("%w: subscription %s is already paused", ErrConflict, s.ID)
+		}
+		if pause.ResumedFrom.After(from) {
+			return NewValidationError("from", "must not be before the end of the previous pause")
+		}
+	}
+	return nil
+}
+
+// CheckResume проверяет, что подписку можно возобновить с даты from:
+// она приостановлена бессрочно и from позже начала приостановки
+func (s *Subscription) CheckResume(from time.Time) error {
+	for _, pause := range s.Pauses {
+		if pause.ResumedFrom != nil {
+			continue
+		}
+		if !from.After(pause.PausedFrom) {
+			return NewValidationError("from", "must be after the pause start")
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: subscription %s is not paused", ErrConflict, s.ID)
+}
+
+// MaxPromoMonths максимальная длина пробного периода и периода вводной цены
+const MaxPromoMonths = 24
+
+// PromoPrice возвращает цену на дату date, если она приходится на пробный
+// период (0) или период вводной цены
+func (s *Subscription) PromoPrice(date time.Time) (int, bool) {
+	var months int
+	if s.TrialMonths != nil {
+		months = *s.TrialMonths
+		if date.Before(CycleStart(s.StartDate, 1, months)) {
+			return 0, true
+		}
+	}
+	if s.IntroPrice != nil && s.IntroMonths != nil {
+		if date.Before(CycleStart(s.StartDate, 1, months+*s.IntroMonths)) {
+			return *s.IntroPrice, true
+		}
+	}
+	return 0, false
+}
+
+// SetComputed пересчитывает вычисляемые поля подписки на момент now
+func (s *Subscription) SetComputed(now time.Time) {
+	s.SetMonthlyEquivalent()
+	s.SetNextChargeDate(now)
+	s.SetStatus(now)
+
+	s.TrialEndDate = nil
+	if trialEnd, ok := s.TrialEnd(); ok {
+		s.TrialEndDate = &trialEnd
+	}
+}
+
+// TrialEnd возвращает последний день пробного периода, если он задан
+func (s *Subscription) TrialEnd() (time.Time, bool) {
+	if s.TrialMonths == nil {
+		return time.Time{}, false
+	}
+	return CycleStart(s.StartDate, 1, *s.TrialMonths).AddDate(0, 0, -1), true
+}
+
+// SetStatus пересчитывает Status на день now
+func (s *Subscription) SetStatus(now time.Time) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	switch {
+	case s.StartDate.After(today):
+		s.Status = StatusScheduled
+	case s.EndDate != nil && s.EndDate.Before(today):
+		s.Status = StatusEnded
+	case s.PausedOn(today):
+		s.Status = StatusPaused
+	default:
+		s.Status = StatusActive
+	}
+}
+
+// CycleStart возвращает начало n-го периода оплаты длиной months месяцев
+// (0 - неделя), считая от start; в этот день и происходит списание за
+// период. Месяцы прибавляются так же, как в postgres: если в целевом
+// месяце нет такого дня, берется его последний день
+func CycleStart(start time.Time, months, n int) time.Time {
+	if months == 0 {
+		return start.AddDate(0, 0, 7*n)
+	}
+	first := time.Date(start.Year(), start.Month()+time.Month(months*n), 1, 0, 0, 0, 0, time.UTC)
+	lastDay := first.AddDate(0, 1, -1).Day()
+	return first.AddDate(0, 0, min(start.Day(), lastDay)-1)
+}
+
+// SetNextChargeDate пересчитывает NextChargeDate: первое списание не раньше
+// дня now и не позже end_date, не попадающее на приостановку
+func (s *Subscription) SetNextChargeDate(now time.Time) {
+	s.NextChargeDate = nil
+
+	day := func(t time.Time) time.Time {
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+	start, today := day(s.StartDate), day(now)
+
+	// n - номер периода, начинающегося не позже месяца today: все периоды
+	// до него заведомо начинаются раньше today
+	var n int
+	months := BillingMonths(s.BillingPeriod, s.BillingIntervalMonths)
+	switch {
+	case !today.After(start):
+	case months == 0:
+		n = int(today.Sub(start).Hours()/24) / 7
+	default:
+		elapsed := (today.Year()-start.Year())*12 + int(today.Month()-start.Month())
+		n = elapsed / months
+	}
+
+	// С начала бессрочной приостановки списаний нет
+	var pausedSince *time.Time
+	for _, pause := range s.Pauses {
+		if pause.ResumedFrom == nil {
+			since := pause.PausedFrom
+			pausedSince = &since
+		}
+	}
+
+	next := CycleStart(start, months, n)
+	for next.Before(today) || s.PausedOn(next) {
+		if pausedSince != nil && !next.Before(*pausedSince) {
+			return
+		}
+		n++
+		next = CycleStart(start, months, n)
+	}
+
+	if s.EndDate != nil && next.After(day(*s.EndDate)) {
+		return
+	}
+	s.NextChargeDate = &next
 }
 
 type ErrorResponse struct {
 	Error string `json:"error"`
+	// Fields ошибки по отдельным полям запроса, если запрос не прошел проверку
+	Fields []FieldError `json:"fields,omitempty"`
 }
 type UpdateSubscriptionRequest struct {
 	ServiceName *string `json:"service_name,omitempty"`
 	Price       *int    `json:"price,omitempty"`
-	StartDate   *string `json:"start_date,omitempty"` // формат "MM-YYYY"
-	EndDate     *string `json:"end_date,omitempty"`   // формат "MM-YYYY"
+	Currency    *string `json:"currency,omitempty"`   // код ISO 4217
+	StartDate   *string `json:"start_date,omitempty"` // формат "YYYY-MM-DD" или "MM-YYYY"
+	EndDate     *string `json:"end_date,omitempty"`   // формат "YYYY-MM-DD" или "MM-YYYY"
+	// BillingIntervalMonths учитывается только вместе с периодом custom
+	BillingPeriod         *string `json:"billing_period,omitempty"`
+	BillingIntervalMonths *int    `json:"billing_interval_months,omitempty"`
+	// TrialMonths 0 убирает пробный период, IntroMonths 0 - вводную цену
+	TrialMonths *int `json:"trial_months,omitempty"`
+	IntroPrice  *int `json:"intro_price,omitempty"`
+	IntroMonths *int `json:"intro_months,omitempty"`
 }
 
 type TotalSpentRequest struct {
-	From        string     `form:"from" binding:"required"` // формат "MM-YYYY"
-	To          string     `form:"to" binding:"required"`   // формат "MM-YYYY"
+	From        string     `form:"from" binding:"required"` // формат "YYYY-MM-DD" или "MM-YYYY"
+	To          string     `form:"to" binding:"required"`   // формат "YYYY-MM-DD" или "MM-YYYY"
 	UserID      *uuid.UUID `form:"user_id,omitempty"`
 	ServiceName *string    `form:"service_name,omitempty"`
+	Currency    *string    `form:"currency,omitempty"` // код ISO 4217, в который пересчитываются списания
 }
 
+// TotalSpentResponse сумма трат; Currency указана, если суммы пересчитаны
+// в нее по курсам
 type TotalSpentResponse struct {
-	Total int `json:"total"`
+	Total    int    `json:"total"`
+	Currency string `json:"currency,omitempty"`
+}
+
+// SpendFilter параметры выборки списаний для аналитики
+type SpendFilter struct {
+	From        time.Time
+	To          time.Time
+	UserID      *uuid.UUID
+	ServiceName *string
+	// Currency валюта, в которую пересчитываются списания каждого месяца;
+	// учитывается только в GetTotalSpent
+	Currency *string
+}
+
+// MonthYear дата с точностью до месяца, в JSON имеет формат "MM-YYYY"
+type MonthYear time.Time
+
+func (m MonthYear) String() string {
+	return time.Time(m).Format("01-2006")
+}
+
+func (m MonthYear) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + m.String() + `"`), nil
+}
+
+type MonthlySpentRequest struct {
+	From        string     `form:"from" binding:"required"` // формат "YYYY-MM-DD" или "MM-YYYY"
+	To          string     `form:"to" binding:"required"`   // формат "YYYY-MM-DD" или "MM-YYYY"
+	UserID      *uuid.UUID `form:"user_id,omitempty"`
+	ServiceName *string    `form:"service_name,omitempty"`
+}
+
+// MonthlySpent списания за месяц и подписки, активные в этом месяце;
+// MonthlyEquivalent - сумма их цен, приведенных к месяцу
+type MonthlySpent struct {
+	Month               MonthYear `json:"month" swaggertype:"string" example:"01-2025"`
+	Total               int       `json:"total"`
+	ActiveSubscriptions int       `json:"active_subscriptions"`
+	MonthlyEquivalent   int       `json:"monthly_equivalent"`
+}
+
+type MonthlySpentResponse struct {
+	Months []MonthlySpent `json:"months"`
+}
+
+// Причины отмены подписки
+const (
+	CancelReasonTooExpensive    = "too_expensive"
+	CancelReasonNotUsing        = "not_using"
+	CancelReasonSwitchedService = "switched_service"
+	CancelReasonTechnicalIssues = "technical_issues"
+	CancelReasonOther           = "other"
+)
+
+// MaxCancelReasonTextLength максимальная длина пояснения к причине отмены
+const MaxCancelReasonTextLength = 1000
+
+// IsCancelReason сообщает, поддерживается ли причина отмены
+func IsCancelReason(code string) bool {
+	switch code {
+	case CancelReasonTooExpensive, CancelReasonNotUsing, CancelReasonSwitchedService,
+		CancelReasonTechnicalIssues, CancelReasonOther:
+		return true
+	}
+	return false
+}
+
+// Cancellation отмена подписки: EffectiveMonth (первый день месяца) -
+// последний оплачиваемый месяц, подписка заканчивается в его последний день
+type Cancellation struct {
+	EffectiveMonth time.Time `json:"effective_month"`
+	ReasonCode     string    `json:"reason_code"`
+	ReasonText     *string   `json:"reason_text,omitempty"`
+}
+
+type CancelSubscriptionRequest struct {
+	// EffectiveMonth последний оплачиваемый месяц, по умолчанию текущий
+	EffectiveMonth *string `json:"effective_month,omitempty" example:"03-2025"` // формат "MM-YYYY"
+	ReasonCode     string  `json:"reason_code" binding:"required" example:"too_expensive"`
+	ReasonText     *string `json:"reason_text,omitempty" binding:"omitempty,max=1000"`
+}
+
+type ChurnRequest struct {
+	From        string     `form:"from" binding:"required"` // формат "YYYY-MM-DD" или "MM-YYYY"
+	To          string     `form:"to" binding:"required"`   // формат "YYYY-MM-DD" или "MM-YYYY"
+	UserID      *uuid.UUID `form:"user_id,omitempty"`
+	ServiceName *string    `form:"service_name,omitempty"`
+}
+
+// CancellationCount число отмен подписок сервиса с одной причиной,
+// вступивших в силу в месяце Month
+type CancellationCount struct {
+	Month       time.Time
+	ServiceName string
+	ReasonCode  string
+	Count       int
+}
+
+// ChurnService отмены подписок одного сервиса за месяц по причинам
+type ChurnService struct {
+	ServiceName   string         `json:"service_name"`
+	Cancellations int            `json:"cancellations"`
+	Reasons       map[string]int `json:"reasons"`
+}
+
+// ChurnMonth отмены, вступившие в силу в месяце, по причинам и по сервисам
+type ChurnMonth struct {
+	Month         MonthYear      `json:"month" swaggertype:"string" example:"01-2025"`
+	Cancellations int            `json:"cancellations"`
+	Reasons       map[string]int `json:"reasons"`
+	Services      []ChurnService `json:"services"`
+}
+
+type ChurnResponse struct {
+	Months []ChurnMonth `json:"months"`
+}
+
+// Charge одно списание по подписке в начале периода оплаты по цене,
+// действующей в этот день
+type Charge struct {
+	SubscriptionID uuid.UUID `json:"subscription_id"`
+	UserID         uuid.UUID `json:"user_id"`
+	ServiceName    string    `json:"service_name"`
+	Date           time.Time `json:"date"`
+	Amount         int       `json:"amount"`
+	Currency       string    `json:"currency" example:"RUB"`
+}
+
+// MaxUpcomingDays максимальный горизонт предстоящих списаний
+const MaxUpcomingDays = 366
+
+type UpcomingChargesRequest struct {
+	UserID      *uuid.UUID `form:"user_id,omitempty"`
+	ServiceName *string    `form:"service_name,omitempty"`
+	// Days горизонт в днях, включая сегодняшний; по умолчанию 30
+	Days int `form:"days" binding:"omitempty,min=1,max=366"`
+}
+
+// UpcomingChargesResponse списания с From по To включительно и их суммы
+// по валютам
+type UpcomingChargesResponse struct {
+	From    time.Time      `json:"from"`
+	To      time.Time      `json:"to"`
+	Charges []Charge       `json:"charges"`
+	Totals  map[string]int `json:"totals"`
+}
+
+// Измерения группировки для аналитики трат
+const (
+	GroupByServiceName = "service_name"
+	GroupByUserID      = "user_id"
+	GroupByTag         = "tag" // подписка учитывается в группе каждого своего тега
+)
+
+type SpentBreakdownRequest struct {
+	From        string     `form:"from" binding:"required"`     // формат "YYYY-MM-DD" или "MM-YYYY"
+	To          string     `form:"to" binding:"required"`       // формат "YYYY-MM-DD" или "MM-YYYY"
+	GroupBy     string     `form:"group_by" binding:"required"` // через запятую: "service_name", "user_id", "tag"
+	Limit       int        `form:"limit" binding:"omitempty,min=1,max=1000"`
+	UserID      *uuid.UUID `form:"user_id,omitempty"`
+	ServiceName *string    `form:"service_name,omitempty"`
+}
+
+// SpentGroup траты одной группы по подпискам, активным в периоде; заполнены
+// только поля, по которым выполнялась группировка. MonthlyEquivalent - сумма
+// цен подписок группы, приведенных к месяцу
+type SpentGroup struct {
+	ServiceName       *string    `json:"service_name,omitempty"`
+	UserID            *uuid.UUID `json:"user_id,omitempty"`
+	Tag               *string    `json:"tag,omitempty"` // пусто для подписок без тегов
+	Total             int        `json:"total"`
+	Subscriptions     int        `json:"subscriptions"`
+	MonthlyEquivalent int        `json:"monthly_equivalent"`
+}
+
+type SpentBreakdownResponse struct {
+	Groups []SpentGroup `json:"groups"`
+}
+
+// Поля сортировки списка подписок
+const (
+	SortByStartDate   = "start_date"
+	SortByPrice       = "price"
+	SortByServiceName = "service_name"
+)
+
+type ListSubscriptionsRequest struct {
+	UserID      *uuid.UUID `form:"user_id"`
+	ServiceName *string    `form:"service_name"`
+	ActiveAt    *string    `form:"active_at"` // "YYYY-MM-DD" или "MM-YYYY": подписка активна в этот день или месяц
+	MinPrice    *int       `form:"min_price" binding:"omitempty,min=0"`
+	MaxPrice    *int       `form:"max_price" binding:"omitempty,min=0"`
+	StartFrom   *string    `form:"start_from"` // формат "YYYY-MM-DD" или "MM-YYYY"
+	StartTo     *string    `form:"start_to"`   // формат "YYYY-MM-DD" или "MM-YYYY"
+	EndFrom     *string    `form:"end_from"`   // формат "YYYY-MM-DD" или "MM-YYYY"
+	EndTo       *string    `form:"end_to"`     // формат "YYYY-MM-DD" или "MM-YYYY"
+	// TrialEndsWithin пробный период заканчивается в ближайшие N дней, включая сегодня
+	TrialEndsWithin *int     `form:"trial_ends_within" binding:"omitempty,min=0,max=366"`
+	Tags            []string `form:"tag"`     // подписка отмечена всеми перечисленными тегами
+	SortBy          string   `form:"sort_by"` // start_date (по умолчанию), price, service_name
+	Order           string   `form:"order"`   // asc или desc (по умолчанию)
+	Limit           int      `form:"limit" binding:"omitempty,min=1,max=1000"`
+	Cursor          string   `form:"cursor"`
+}
+
+// SubscriptionFilter разобранные параметры выборки подписок для хранилища.
+// Хранилище возвращает не больше Limit подписок, следующих за After в
+// порядке сортировки (SortBy, ID)
+type SubscriptionFilter struct {
+	UserID       *uuid.UUID
+	ServiceName  *string
+	ActiveFrom   *time.Time // вместе с ActiveTo: подписка пересекается с периодом
+	ActiveTo     *time.Time
+	MinPrice     *int
+	MaxPrice     *int
+	StartFrom    *time.Time
+	StartTo      *time.Time
+	EndFrom      *time.Time
+	EndTo        *time.Time
+	TrialEndFrom *time.Time // вместе с TrialEndTo: последний день пробного периода в диапазоне
+	TrialEndTo   *time.Time
+	Tags         []string // ключи TagKey тегов, которыми отмечена подписка
+	SortBy       string
+	Desc         bool
+	Limit        int
+	After        *ListCursor
+}
+
+// ListCursor позиция в списке подписок для keyset-пагинации: значение поля
+// сортировки и ID последней отданной подписки
+type ListCursor struct {
+	SortBy string    `json:"s"`
+	Desc   bool      `json:"d"`
+	Value  string    `json:"v"`
+	ID     uuid.UUID `json:"id"`
+}
+
+// SortValue возвращает значение поля сортировки подписки в том виде,
+// в котором оно хранится в курсоре
+func (s *Subscription) SortValue(sortBy string) string {
+	switch sortBy {
+	case SortByPrice:
+		return strconv.Itoa(s.Price)
+	case SortByServiceName:
+		return s.ServiceName
+	default:
+		return s.StartDate.Format("2006-01-02")
+	}
+}
+
+// IdempotencyKey ключ идемпотентности запроса на создание подписки
+type IdempotencyKey struct {
+	Key         string
+	RequestHash string // sha256 тела запроса
+	ExpiresAt   time.Time
+}
+
+// StoredResponse результат ранее выполненного запроса с тем же ключом
+// идемпотентности
+type StoredResponse struct {
+	RequestHash  string
+	Subscription *Subscription
+}
+
+// Типы событий журнала изменений подписки
+const (
+	EventCreated   = "created"
+	EventUpdated   = "updated"
+	EventDeleted   = "deleted"
+	EventRestored  = "restored"
+	EventPaused    = "paused"
+	EventResumed   = "resumed"
+	EventCancelled = "cancelled"
+	EventTagged    = "tagged"
+	EventRepriced  = "repriced"
+)
+
+// SubscriptionEvent запись журнала изменений подписки: состояние до и
+// после изменения, кто и в каком запросе его сделал
+type SubscriptionEvent struct {
+	ID             int64         `json:"id"`
+	SubscriptionID uuid.UUID     `json:"subscription_id"`
+	EventType      string        `json:"event_type"`
+	OldValues      *Subscription `json:"old_values,omitempty"`
+	NewValues      *Subscription `json:"new_values,omitempty"`
+	Actor          string        `json:"actor,omitempty"`
+	RequestID      string        `json:"request_id,omitempty"`
+	CreatedAt      time.Time     `json:"created_at"`
+}
+
+// Режимы импорта подписок: atomic не сохраняет ничего, если хотя бы одна
+// строка с ошибкой; best_effort сохраняет корректные строки
+const (
+	ImportModeAtomic     = "atomic"
+	ImportModeBestEffort = "best_effort"
+)
+
+// Форматы импорта и выгрузки; FormatJSON - обычный ответ JSON
+const (
+	FormatJSON   = "json"
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+)
+
+// ImportRowResult результат импорта одной строки: ID созданной подписки
+// или ошибка. Line - номер строки во входных данных
+type ImportRowResult struct {
+	Line   int          `json:"line"`
+	ID     *uuid.UUID   `json:"id,omitempty"`
+	Error  string       `json:"error,omitempty"`
+	Fields []FieldError `json:"fields,omitempty"`
+}
+
+type ImportSubscriptionsResponse struct {
+	Mode     string            `json:"mode"`
+	Total    int               `json:"total"`
+	Imported int               `json:"imported"`
+	Failed   int               `json:"failed"`
+	Rows     []ImportRowResult `json:"rows"`
+}
+
+// PriceChange цена подписки, действующая с EffectiveFrom до следующего
+// изменения
+type PriceChange struct {
+	EffectiveFrom time.Time `json:"effective_from"`
+	Price         int       `json:"price"`
+}
+
+type SchedulePriceChangeRequest struct {
+	Price         int    `json:"price" binding:"required,min=1"`
+	EffectiveFrom string `json:"effective_from" binding:"required"` // "YYYY-MM-DD" или "MM-YYYY" (с первого дня месяца)
+}
+
+// PauseSubscriptionRequest приостановка подписки; без From - с сегодняшнего дня
+type PauseSubscriptionRequest struct {
+	From *string `json:"from,omitempty"` // формат "YYYY-MM-DD" или "MM-YYYY"
+}
+
+// ResumeSubscriptionRequest возобновление подписки; без From - с сегодняшнего дня
+type ResumeSubscriptionRequest struct {
+	From *string `json:"from,omitempty"` // формат "YYYY-MM-DD" или "MM-YYYY"
+}
+
+// SubscriptionPricesResponse цены подписки в порядке вступления в силу,
+// начиная с цены на start_date
+type SubscriptionPricesResponse struct {
+	Prices []PriceChange `json:"prices"`
+}
+
+// ExchangeRate курс обмена: From * Rate = To, действует с даты Date до
+// следующего курса той же пары
+type ExchangeRate struct {
+	Date time.Time `json:"date"`
+	From string    `json:"from" example:"USD"`
+	To   string    `json:"to" example:"RUB"`
+	Rate float64   `json:"rate" example:"92.5"`
+}
+
+// ExchangeRateRequest строка загрузки курсов
+type ExchangeRateRequest struct {
+	Date string  `json:"date"` // формат "YYYY-MM-DD" или "MM-YYYY" (с первого дня месяца)
+	From string  `json:"from"`
+	To   string  `json:"to"`
+	Rate float64 `json:"rate"`
+}
+
+// ExchangeRateFilter выборка курсов; пустые поля не ограничивают выборку
+type ExchangeRateFilter struct {
+	From *string
+	To   *string
+}
+
+type ListExchangeRatesRequest struct {
+	From *string `form:"from"`
+	To   *string `form:"to"`
+}
+
+type ExchangeRatesResponse struct {
+	Rates []ExchangeRate `json:"rates"`
+}
+
+type ImportExchangeRatesResponse struct {
+	Imported int `json:"imported"`
+}
+
+// Service сервис каталога: каноническое название, под которым хранятся
+// подписки, псевдонимы, которые к нему приводятся, и цена по умолчанию
+// для новых подписок
+type Service struct {
+	ID           uuid.UUID `json:"id"`
+	Name         string    `json:"name" example:"Yandex Plus"`
+	Aliases      []string  `json:"aliases" example:"Яндекс Плюс"`
+	DefaultPrice *int      `json:"default_price,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// MaxServiceNameLength максимальная длина названия и псевдонима сервиса
+const MaxServiceNameLength = 255
+
+// CleanServiceName убирает пробелы по краям названия сервиса и схлопывает
+// пробелы внутри
+func CleanServiceName(name string) string {
+	return strings.Join(strings.Fields(name), " ")
+}
+
+// ServiceNameKey ключ, по которому названия и псевдонимы сервисов
+// сравниваются без учета регистра и лишних пробелов
+func ServiceNameKey(name string) string {
+	return strings.ToLower(CleanServiceName(name))
+}
+
+type CreateServiceRequest struct {
+	Name         string   `json:"name" binding:"required" example:"Yandex Plus"`
+	Aliases      []string `json:"aliases,omitempty" example:"Яндекс Плюс"`
+	DefaultPrice *int     `json:"default_price,omitempty" binding:"omitempty,min=1"`
+}
+
+type UpdateServiceRequest struct {
+	Name         *string   `json:"name,omitempty"`
+	Aliases      *[]string `json:"aliases,omitempty"`       // заменяет все псевдонимы
+	DefaultPrice *int      `json:"default_price,omitempty"` // 0 убирает цену по умолчанию
+}
+
+type ServicesResponse struct {
+	Services []Service `json:"services"`
+}
+
+// Tag тег для группировки подписок, например категория трат. Теги свои у
+// каждого пользователя и отмечают только его подписки
+type Tag struct {
+	ID        uuid.UUID `json:"id"`
+	UserID    uuid.UUID `json:"user_id"`
+	Name      string    `json:"name" example:"entertainment"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Ограничения тегов
+const (
+	MaxTagNameLength    = 64
+	MaxSubscriptionTags = 20
+)
+
+// TagKey ключ, по которому названия тегов сравниваются без учета регистра и
+// лишних пробелов, так же как названия сервисов
+func TagKey(name string) string {
+	return ServiceNameKey(name)
+}
+
+type CreateTagRequest struct {
+	UserID uuid.UUID `json:"user_id" binding:"required"`
+	Name   string    `json:"name" binding:"required" example:"entertainment"`
+}
+
+type TagRequest struct {
+	Name string `json:"name" binding:"required" example:"entertainment"`
+}
+
+// SetTagsRequest теги подписки, заменяющие текущие; тег, которого еще нет
+// у владельца подписки, создается
+type SetTagsRequest struct {
+	Tags []string `json:"tags" binding:"required" example:"entertainment"`
+}
+
+type TagsResponse struct {
+	Tags []Tag `json:"tags"`
 }
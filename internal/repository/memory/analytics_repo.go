@@ -0,0 +1,364 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/NKV510/subscription-service/internal/models"
+	"github.com/google/uuid"
+)
+
+// charge списание по подписке за период оплаты, пересекающийся с окном
+type charge struct {
+	subscriptionID uuid.UUID
+	userID         uuid.UUID
+	serviceName    string
+	currency       string
+	date           time.Time // день списания, может быть раньше окна
+	chargeAmount   int       // сумма списания
+	month          time.Time // месяц, в котором начинается часть периода в окне
+	amount         int       // доля списания за дни периода в окне
+}
+
+// active возвращает копии подписок, активных в окне фильтра, так же как
+// выборка active в spendCTE postgres
+func (r *SubscriptionRepository) active(filter models.SpendFilter) []models.Subscription {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	from := truncateDay(filter.From)
+	to := truncateDay(filter.To)
+
+	var result []models.Subscription
+	for _, sub := range r.subscriptions {
+		if sub.DeletedAt != nil {
+			continue
+		}
+		if filter.UserID != nil && sub.UserID != *filter.UserID {
+			continue
+		}
+		if filter.ServiceName != nil && sub.ServiceName != *filter.ServiceName {
+			continue
+		}
+		if !activeBetween(&sub, from, to) {
+			continue
+		}
+		result = append(result, copySubscription(&sub))
+	}
+
+	return result
+}
+
+// activeBetween сообщает, пересекается ли подписка с периодом [first, last]
+func activeBetween(sub *models.Subscription, first, last time.Time) bool {
+	if truncateDay(sub.StartDate).After(last) {
+		return false
+	}
+	return sub.EndDate == nil || !truncateDay(*sub.EndDate).Before(first)
+}
+
+// charges разворачивает подписки, активные в окне фильтра, в списания за
+// периоды оплаты, пересекающиеся с окном, по цене, действующей в день
+// списания, пропуская списания на время приостановки, так же как spendCTE
+// в postgres. Периоды отсчитываются от start_date, списание - в первый
+// день периода; оно пропорционально дням периода до end_date, а его доля
+// в окне - дням этой части периода внутри окна
+func (r *SubscriptionRepository) charges(filter models.SpendFilter) []charge {
+	from := truncateDay(filter.From)
+	to := truncateDay(filter.To)
+
+	var result []charge
+	for _, sub := range r.active(filter) {
+		start := truncateDay(sub.StartDate)
+		last := to
+		if sub.EndDate != nil && truncateDay(*sub.EndDate).Before(to) {
+			last = truncateDay(*sub.EndDate)
+		}
+
+		months := models.BillingMonths(sub.BillingPeriod, sub.BillingIntervalMonths)
+		for n := 0; ; n++ {
+			date := models.CycleStart(start, months, n)
+			if date.After(last) {
+				break
+			}
+			cycleEnd := models.CycleStart(start, months, n+1).AddDate(0, 0, -1)
+			if cycleEnd.Before(from) {
+				continue
+			}
+			if sub.PausedOn(date) {
+				continue
+			}
+
+			paidTill := cycleEnd
+			if sub.EndDate != nil {
+				paidTill = minTime(cycleEnd, truncateDay(*sub.EndDate))
+			}
+			spentFrom, spentTill := maxTime(date, from), minTime(paidTill, to)
+			cycleDays := daysBetween(date, cycleEnd)
+			price := r.priceAt(&sub, date)
+
+			result = append(result, charge{
+				subscriptionID: sub.ID,
+				userID:         sub.UserID,
+				serviceName:    sub.ServiceName,
+				currency:       sub.Currency,
+				date:           date,
+				chargeAmount:   prorate(price, daysBetween(date, paidTill), cycleDays),
+				month:          truncateMonth(spentFrom),
+				amount:         prorate(price, daysBetween(spentFrom, spentTill), cycleDays),
+			})
+		}
+	}
+
+	return result
+}
+
+// GetTotalSpent возвращает сумму списаний по подпискам за окно [from, to]:
+// цена за каждый период оплаты в окне, за период, лишь частично попавший в
+// окно или оплаченный не целиком, - пропорционально дням. Если задана
+// filter.Currency, списания пересчитываются в нее с помощью convertedTotal
+func (r *SubscriptionRepository) GetTotalSpent(ctx context.Context, filter models.SpendFilter) (int, error) {
+	if filter.Currency != nil {
+		return r.convertedTotal(filter)
+	}
+
+	total := 0
+	for _, c := range r.charges(filter) {
+		total += c.amount
+	}
+	return total, nil
+}
+
+// GetSpendCurrencies возвращает валюты подписок, активных в окне фильтра,
+// в порядке кода валюты
+func (r *SubscriptionRepository) GetSpendCurrencies(ctx context.Context, filter models.SpendFilter) ([]string, error) {
+	seen := make(map[string]bool)
+	currencies := make([]string, 0)
+	for _, sub := range r.active(filter) {
+		if !seen[sub.Currency] {
+			seen[sub.Currency] = true
+			currencies = append(currencies, sub.Currency)
+		}
+	}
+	sort.Strings(currencies)
+	return currencies, nil
+}
+
+// ListCharges возвращает списания по подпискам, приходящиеся на окно
+// [from, to], целиком, в порядке даты списания, названия сервиса и id
+// подписки
+func (r *SubscriptionRepository) ListCharges(ctx context.Context, filter models.SpendFilter) ([]models.Charge, error) {
+	var charges []models.Charge
+	for _, c := range r.charges(filter) {
+		if c.date.Before(truncateDay(filter.From)) {
+			continue
+		}
+		charges = append(charges, models.Charge{
+			SubscriptionID: c.subscriptionID,
+			UserID:         c.userID,
+			ServiceName:    c.serviceName,
+			Date:           c.date,
+			Amount:         c.chargeAmount,
+			Currency:       c.currency,
+		})
+	}
+
+	sort.Slice(charges, func(i, j int) bool {
+		a, b := charges[i], charges[j]
+		if !a.Date.Equal(b.Date) {
+			return a.Date.Before(b.Date)
+		}
+		if a.ServiceName != b.ServiceName {
+			return a.ServiceName < b.ServiceName
+		}
+		return a.SubscriptionID.String() < b.SubscriptionID.String()
+	})
+	return charges, nil
+}
+
+// GetMonthlySpent возвращает по каждому месяцу окна [from, to] сумму
+// списаний, число активных в месяце подписок и сумму их цен на конец
+// месяца, приведенных к месяцу; подписка, приостановленная на весь месяц,
+// в нем не учитывается. Месяцы без подписок тоже возвращаются
+func (r *SubscriptionRepository) GetMonthlySpent(
+	ctx context.Context,
+	filter models.SpendFilter,
+) ([]models.MonthlySpent, error) {
+	totals := make(map[time.Time]int)
+	for _, c := range r.charges(filter) {
+		totals[c.month] += c.amount
+	}
+	active := r.active(filter)
+
+	months := make([]models.MonthlySpent, 0)
+	last := truncateMonth(filter.To)
+	for month := truncateMonth(filter.From); !month.After(last); month = month.AddDate(0, 1, 0) {
+		item := models.MonthlySpent{Month: models.MonthYear(month), Total: totals[month]}
+		lastDay := month.AddDate(0, 1, -1)
+		for i := range active {
+			if activeBetween(&active[i], month, lastDay) && !active[i].PausedThrough(month, lastDay) {
+				item.ActiveSubscriptions++
+				item.MonthlyEquivalent += r.monthlyEquivalentAt(&active[i], lastDay)
+			}
+		}
+		months = append(months, item)
+	}
+
+	return months, nil
+}
+
+// groupKey ключ группы в разбивке трат
+type groupKey struct {
+	serviceName string
+	userID      uuid.UUID
+	tag         string // ключ TagKey тега
+	tagged      bool   // false - группа подписок без тегов
+}
+
+// GetSpentBreakdown возвращает списания и приведенные к месяцу цены на конец
+// окна для подписок, активных в окне, сгруппированные по указанным
+// измерениям, отсортированные по убыванию суммы и ограниченные limit группами.
+// При группировке по тегу подписка учитывается в группе каждого своего тега;
+// теги разных пользователей с одним ключом - одна группа под наименьшим из
+// их написаний
+func (r *SubscriptionRepository) GetSpentBreakdown(
+	ctx context.Context,
+	filter models.SpendFilter,
+	groupBy []string,
+	limit int,
+) ([]models.SpentGroup, error) {
+	var byService, byUser, byTag bool
+	for _, dimension := range groupBy {
+		switch dimension {
+		case models.GroupByServiceName:
+			byService = true
+		case models.GroupByUserID:
+			byUser = true
+		case models.GroupByTag:
+			byTag = true
+		default:
+			return nil, fmt.Errorf("%w: unsupported group_by dimension: %s", models.ErrValidation, dimension)
+		}
+	}
+
+	charged := make(map[uuid.UUID]int)
+	for _, c := range r.charges(filter) {
+		charged[c.subscriptionID] += c.amount
+	}
+
+	totals := make(map[groupKey]int)
+	members := make(map[groupKey]int)
+	equivalents := make(map[groupKey]int)
+	tagNames := make(map[groupKey]string)
+	windowEnd := truncateDay(filter.To)
+	for _, sub := range r.active(filter) {
+		var key groupKey
+		if byService {
+			key.serviceName = sub.ServiceName
+		}
+		if byUser {
+			key.userID = sub.UserID
+		}
+
+		// Как LEFT JOIN в postgres: по ключу на тег, без тегов - один ключ
+		subKeys := []groupKey{key}
+		if byTag && len(sub.Tags) > 0 {
+			subKeys = subKeys[:0]
+			for _, tag := range sub.Tags {
+				key.tag, key.tagged = models.TagKey(tag), true
+				subKeys = append(subKeys, key)
+				if name, ok := tagNames[key]; !ok || tag < name {
+					tagNames[key] = tag
+				}
+			}
+		}
+		for _, key := range subKeys {
+			totals[key] += charged[sub.ID]
+			members[key]++
+			equivalents[key] += r.monthlyEquivalentAt(&sub, windowEnd)
+		}
+	}
+
+	keys := make([]groupKey, 0, len(totals))
+	for key := range totals {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if totals[keys[i]] != totals[keys[j]] {
+			return totals[keys[i]] > totals[keys[j]]
+		}
+		if keys[i].serviceName != keys[j].serviceName {
+			return keys[i].serviceName < keys[j].serviceName
+		}
+		if keys[i].userID != keys[j].userID {
+			return keys[i].userID.String() < keys[j].userID.String()
+		}
+		// NULL в postgres при сортировке по возрастанию идет последним
+		if keys[i].tagged != keys[j].tagged {
+			return keys[i].tagged
+		}
+		return tagNames[keys[i]] < tagNames[keys[j]]
+	})
+	if len(keys) > limit {
+		keys = keys[:limit]
+	}
+
+	groups := make([]models.SpentGroup, 0, len(keys))
+	for _, key := range keys {
+		group := models.SpentGroup{
+			Total:             totals[key],
+			Subscriptions:     members[key],
+			MonthlyEquivalent: equivalents[key],
+		}
+		if byService {
+			serviceName := key.serviceName
+			group.ServiceName = &serviceName
+		}
+		if byUser {
+			userID := key.userID
+			group.UserID = &userID
+		}
+		if byTag && key.tagged {
+			tag := tagNames[key]
+			group.Tag = &tag
+		}
+		groups = append(groups, group)
+	}
+
+	return groups, nil
+}
+
+func truncateDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func truncateMonth(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// daysBetween число дней от first до last включительно
+func daysBetween(first, last time.Time) int {
+	return int(last.Sub(first).Hours()/24) + 1
+}
+
+// prorate возвращает долю цены за days дней периода из periodDays,
+// округленную до целого так же, как ROUND в postgres
+func prorate(price, days, periodDays int) int {
+	return (2*price*days + periodDays) / (2 * periodDays)
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,29 @@
+package memory
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/NKV510/subscription-service/internal/models"
+)
+
+// CreateBatch добавляет подписки, привязанные к сервисам каталога по
+// названию, вместе с событиями создания. Как и в postgres, либо
+// сохраняются все подписки, либо ни одна
+func (r *SubscriptionRepository) CreateBatch(ctx context.Context, subs []*models.Subscription) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, sub := range subs {
+		r.resolveService(sub)
+		if err := r.checkConstraints(sub); err != nil {
+			return err
+		}
+	}
+	for _, sub := range subs {
+		r.create(ctx, sub)
+	}
+
+	slog.Info("Subscriptions batch created successfully", "count", len(subs))
+	return nil
+}
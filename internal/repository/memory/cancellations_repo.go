@@ -0,0 +1,117 @@
+package memory
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/NKV510/subscription-service/internal/models"
+	"github.com/google/uuid"
+)
+
+// Cancel завершает неудаленную подписку последним днем
+// cancellation.EffectiveMonth, сохраняет причину отмены (заменяя прежнюю),
+// увеличивает версию и записывает событие в журнал изменений
+func (r *SubscriptionRepository) Cancel(
+	ctx context.Context,
+	id uuid.UUID,
+	cancellation models.Cancellation,
+	expectedVersion *int,
+) (*models.Subscription, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, err := r.lockSubscription(id, expectedVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	cancellation.EffectiveMonth = truncateMonth(cancellation.EffectiveMonth)
+	if !models.IsCancelReason(cancellation.ReasonCode) {
+		return nil, models.NewValidationError("reason_code", "unsupported cancellation reason")
+	}
+
+	cancelled := copySubscription(&existing)
+	endDate := cancellation.EffectiveMonth.AddDate(0, 1, -1)
+	cancelled.EndDate = &endDate
+	if err := r.checkConstraints(&cancelled); err != nil {
+		return nil, err
+	}
+
+	if cancellation.ReasonText != nil {
+		text := *cancellation.ReasonText
+		cancellation.ReasonText = &text
+	}
+	r.cancellations[id] = cancellation
+	r.touch(ctx, &existing, &cancelled, models.EventCancelled)
+
+	slog.Info("Subscription cancelled", "id", id, "end_date", endDate, "reason_code", cancellation.ReasonCode)
+	return cloneSubscription(cancelled), nil
+}
+
+// deleteStaleCancellation удаляет отмену подписки, если ее end_date больше
+// не приходится на месяц отмены; вызывается под r.mu
+func (r *SubscriptionRepository) deleteStaleCancellation(sub *models.Subscription) {
+	cancellation, ok := r.cancellations[sub.ID]
+	if ok && (sub.EndDate == nil || !truncateMonth(*sub.EndDate).Equal(cancellation.EffectiveMonth)) {
+		delete(r.cancellations, sub.ID)
+	}
+}
+
+// GetCancellations возвращает число отмен неудаленных подписок по месяцам
+// отмены из окна [from, to], сервисам и причинам
+func (r *SubscriptionRepository) GetCancellations(
+	ctx context.Context,
+	filter models.SpendFilter,
+) ([]models.CancellationCount, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	type countKey struct {
+		month       time.Time
+		serviceName string
+		reasonCode  string
+	}
+
+	from := truncateMonth(filter.From)
+	to := truncateDay(filter.To)
+	counts := make(map[countKey]int)
+	for id, cancellation := range r.cancellations {
+		sub, ok := r.subscriptions[id]
+		if !ok || sub.DeletedAt != nil {
+			continue
+		}
+		if filter.UserID != nil && sub.UserID != *filter.UserID {
+			continue
+		}
+		if filter.ServiceName != nil && sub.ServiceName != *filter.ServiceName {
+			continue
+		}
+		if cancellation.EffectiveMonth.Before(from) || cancellation.EffectiveMonth.After(to) {
+			continue
+		}
+		counts[countKey{cancellation.EffectiveMonth, sub.ServiceName, cancellation.ReasonCode}]++
+	}
+
+	result := make([]models.CancellationCount, 0, len(counts))
+	for key, count := range counts {
+		result = append(result, models.CancellationCount{
+			Month:       key.month,
+			ServiceName: key.serviceName,
+			ReasonCode:  key.reasonCode,
+			Count:       count,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if !a.Month.Equal(b.Month) {
+			return a.Month.Before(b.Month)
+		}
+		if a.ServiceName != b.ServiceName {
+			return a.ServiceName < b.ServiceName
+		}
+		return a.ReasonCode < b.ReasonCode
+	})
+	return result, nil
+}
@@ -0,0 +1,62 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/NKV510/subscription-service/internal/models"
+	"github.com/NKV510/subscription-service/internal/reqctx"
+	"github.com/google/uuid"
+)
+
+// recordEvent добавляет событие в журнал изменений; вызывается под r.mu
+func (r *SubscriptionRepository) recordEvent(
+	ctx context.Context,
+	subscriptionID uuid.UUID,
+	eventType string,
+	oldValues *models.Subscription,
+	newValues *models.Subscription,
+) {
+	r.events = append(r.events, models.SubscriptionEvent{
+		ID:             int64(len(r.events) + 1),
+		SubscriptionID: subscriptionID,
+		EventType:      eventType,
+		OldValues:      snapshot(oldValues),
+		NewValues:      snapshot(newValues),
+		Actor:          reqctx.Actor(ctx),
+		RequestID:      reqctx.RequestID(ctx),
+		CreatedAt:      time.Now().UTC(),
+	})
+}
+
+func snapshot(sub *models.Subscription) *models.Subscription {
+	if sub == nil {
+		return nil
+	}
+	return cloneSubscription(*sub)
+}
+
+// GetHistory возвращает журнал изменений подписки в хронологическом порядке.
+// История удаленной подписки сохраняется
+func (r *SubscriptionRepository) GetHistory(ctx context.Context, id uuid.UUID) ([]models.SubscriptionEvent, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	events := make([]models.SubscriptionEvent, 0)
+	for _, event := range r.events {
+		if event.SubscriptionID == id {
+			event.OldValues = snapshot(event.OldValues)
+			event.NewValues = snapshot(event.NewValues)
+			events = append(events, event)
+		}
+	}
+
+	if len(events) == 0 {
+		if _, ok := r.subscriptions[id]; !ok {
+			return nil, fmt.Errorf("%w: subscription %s", models.ErrNotFound, id)
+		}
+	}
+
+	return events, nil
+}
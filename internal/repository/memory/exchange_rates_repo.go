@@ -0,0 +1,144 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/NKV510/subscription-service/internal/models"
+)
+
+// currencyPattern повторяет ограничения CHECK на коды валют
+var currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// exchangeRateKey первичный ключ таблицы exchange_rates
+type exchangeRateKey struct {
+	from string
+	to   string
+	date time.Time
+}
+
+// UpsertExchangeRates добавляет курсы; курс той же пары на ту же дату
+// заменяется
+func (r *SubscriptionRepository) UpsertExchangeRates(ctx context.Context, rates []models.ExchangeRate) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, rate := range rates {
+		if !currencyPattern.MatchString(rate.From) || !currencyPattern.MatchString(rate.To) || rate.Rate <= 0 {
+			return fmt.Errorf("%w: invalid exchange rate %+v", models.ErrValidation, rate)
+		}
+	}
+	for _, rate := range rates {
+		r.exchangeRates[exchangeRateKey{rate.From, rate.To, truncateDay(rate.Date)}] = rate.Rate
+	}
+
+	slog.Info("Exchange rates saved", "count", len(rates))
+	return nil
+}
+
+// ListExchangeRates возвращает курсы, отсортированные по паре и дате
+func (r *SubscriptionRepository) ListExchangeRates(
+	ctx context.Context,
+	filter models.ExchangeRateFilter,
+) ([]models.ExchangeRate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	rates := make([]models.ExchangeRate, 0)
+	for key, rate := range r.exchangeRates {
+		if filter.From != nil && key.from != *filter.From {
+			continue
+		}
+		if filter.To != nil && key.to != *filter.To {
+			continue
+		}
+		rates = append(rates, models.ExchangeRate{Date: key.date, From: key.from, To: key.to, Rate: rate})
+	}
+
+	sort.Slice(rates, func(i, j int) bool {
+		if rates[i].From != rates[j].From {
+			return rates[i].From < rates[j].From
+		}
+		if rates[i].To != rates[j].To {
+			return rates[i].To < rates[j].To
+		}
+		return rates[i].Date.Before(rates[j].Date)
+	})
+
+	return rates, nil
+}
+
+// exchangeRate возвращает курс from -> to, действующий на дату date: самый
+// поздний курс не позже date, прямой или обратный, при равных датах -
+// прямой. Так же выбирает курс convertedTotal в postgres
+func (r *SubscriptionRepository) exchangeRate(from, to string, date time.Time) (float64, bool) {
+	if from == to {
+		return 1, true
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var (
+		rate   float64
+		latest time.Time
+		found  bool
+	)
+	for key, value := range r.exchangeRates {
+		if key.date.After(date) {
+			continue
+		}
+		switch {
+		case key.from == from && key.to == to:
+			if !found || !key.date.Before(latest) {
+				rate, latest, found = value, key.date, true
+			}
+		case key.from == to && key.to == from:
+			if !found || key.date.After(latest) {
+				rate, latest, found = 1/value, key.date, true
+			}
+		}
+	}
+	return rate, found
+}
+
+// convertedTotal пересчитывает сумму списаний каждого месяца в каждой
+// валюте в filter.Currency по курсу на последний день месяца, так же как
+// convertedTotal в postgres
+func (r *SubscriptionRepository) convertedTotal(filter models.SpendFilter) (int, error) {
+	type monthCurrency struct {
+		month    time.Time
+		currency string
+	}
+	amounts := make(map[monthCurrency]int)
+	for _, c := range r.charges(filter) {
+		amounts[monthCurrency{c.month, c.currency}] += c.amount
+	}
+
+	keys := make([]monthCurrency, 0, len(amounts))
+	for key := range amounts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].month.Equal(keys[j].month) {
+			return keys[i].month.Before(keys[j].month)
+		}
+		return keys[i].currency < keys[j].currency
+	})
+
+	total := 0
+	for _, key := range keys {
+		rate, ok := r.exchangeRate(key.currency, *filter.Currency, key.month.AddDate(0, 1, -1))
+		if !ok {
+			return 0, models.NewValidationError("currency", fmt.Sprintf(
+				"no exchange rate from %s to %s effective in %s", key.currency, *filter.Currency, models.MonthYear(key.month)))
+		}
+		total += int(math.Round(float64(amounts[key]) * rate))
+	}
+	return total, nil
+}
@@ -0,0 +1,84 @@
+package memory
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/NKV510/subscription-service/internal/models"
+)
+
+// idempotencyRecord сохраненный ответ на запрос с ключом идемпотентности
+type idempotencyRecord struct {
+	requestHash  string
+	subscription models.Subscription
+	expiresAt    time.Time
+}
+
+// CreateIdempotent создает подписку и сохраняет ее под ключом
+// идемпотентности. Если ключ уже использован и не истек, подписка не
+// создается и возвращается сохраненный ответ
+func (r *SubscriptionRepository) CreateIdempotent(
+	ctx context.Context,
+	sub *models.Subscription,
+	key models.IdempotencyKey,
+) (*models.StoredResponse, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if record, ok := r.idempotencyKeys[key.Key]; ok && record.expiresAt.After(time.Now()) {
+		slog.Info("Idempotency key already used", "key", key.Key, "id", record.subscription.ID)
+		return &models.StoredResponse{
+			RequestHash:  record.requestHash,
+			Subscription: cloneSubscription(record.subscription),
+		}, nil
+	}
+
+	r.resolveService(sub)
+	if err := r.checkConstraints(sub); err != nil {
+		return nil, err
+	}
+	r.create(ctx, sub)
+	r.idempotencyKeys[key.Key] = idempotencyRecord{
+		requestHash:  key.RequestHash,
+		subscription: copySubscription(sub),
+		expiresAt:    key.ExpiresAt,
+	}
+
+	slog.Info("Subscription created successfully", "id", sub.ID, "idempotency_key", key.Key)
+	return nil, nil
+}
+
+// GetIdempotentResponse возвращает сохраненный ответ для неистекшего ключа
+// идемпотентности; nil, если ключ не использован или истек
+func (r *SubscriptionRepository) GetIdempotentResponse(ctx context.Context, key string) (*models.StoredResponse, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	record, ok := r.idempotencyKeys[key]
+	if !ok || !record.expiresAt.After(time.Now()) {
+		return nil, nil
+	}
+	return &models.StoredResponse{
+		RequestHash:  record.requestHash,
+		Subscription: cloneSubscription(record.subscription),
+	}, nil
+}
+
+// PurgeIdempotencyKeys удаляет ключи идемпотентности, истекшие не позже
+// expiredBefore, и возвращает их количество
+func (r *SubscriptionRepository) PurgeIdempotencyKeys(ctx context.Context, expiredBefore time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var purged int64
+	for key, record := range r.idempotencyKeys {
+		if !record.expiresAt.After(expiredBefore) {
+			delete(r.idempotencyKeys, key)
+			purged++
+		}
+	}
+
+	slog.Info("Purged expired idempotency keys", "count", purged, "expired_before", expiredBefore)
+	return purged, nil
+}
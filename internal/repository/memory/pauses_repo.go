@@ -0,0 +1,103 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/NKV510/subscription-service/internal/models"
+	"github.com/google/uuid"
+)
+
+// Pause приостанавливает неудаленную подписку с даты from, увеличивает
+// версию и записывает событие в журнал изменений. Если подписка уже
+// приостановлена, возвращает models.ErrConflict; приостановка не может
+// начинаться раньше окончания предыдущей
+func (r *SubscriptionRepository) Pause(
+	ctx context.Context,
+	id uuid.UUID,
+	from time.Time,
+	expectedVersion *int,
+) (*models.Subscription, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, err := r.lockSubscription(id, expectedVersion)
+	if err != nil {
+		return nil, err
+	}
+	if err := existing.CheckPause(from); err != nil {
+		return nil, err
+	}
+
+	paused := copySubscription(&existing)
+	paused.Pauses = append(paused.Pauses, models.Pause{PausedFrom: truncateDay(from)})
+	r.touch(ctx, &existing, &paused, models.EventPaused)
+
+	slog.Info("Subscription paused", "id", id, "from", from)
+	return cloneSubscription(paused), nil
+}
+
+// Resume завершает бессрочную приостановку подписки датой from,
+// увеличивает версию и записывает событие в журнал изменений. Если подписка
+// не приостановлена, возвращает models.ErrConflict
+func (r *SubscriptionRepository) Resume(
+	ctx context.Context,
+	id uuid.UUID,
+	from time.Time,
+	expectedVersion *int,
+) (*models.Subscription, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, err := r.lockSubscription(id, expectedVersion)
+	if err != nil {
+		return nil, err
+	}
+	if err := existing.CheckResume(from); err != nil {
+		return nil, err
+	}
+
+	resumed := copySubscription(&existing)
+	for i := range resumed.Pauses {
+		if resumed.Pauses[i].ResumedFrom == nil {
+			resumedFrom := truncateDay(from)
+			resumed.Pauses[i].ResumedFrom = &resumedFrom
+		}
+	}
+	r.touch(ctx, &existing, &resumed, models.EventResumed)
+
+	slog.Info("Subscription resumed", "id", id, "from", from)
+	return cloneSubscription(resumed), nil
+}
+
+// lockSubscription возвращает неудаленную подписку, проверяя версию, если
+// expectedVersion задан, так же как lockSubscription в postgres;
+// вызывается под r.mu
+func (r *SubscriptionRepository) lockSubscription(id uuid.UUID, expectedVersion *int) (models.Subscription, error) {
+	existing, ok := r.subscriptions[id]
+	if !ok || existing.DeletedAt != nil {
+		return models.Subscription{}, fmt.Errorf("%w: subscription %s", models.ErrNotFound, id)
+	}
+	if expectedVersion != nil && existing.Version != *expectedVersion {
+		return models.Subscription{}, fmt.Errorf("%w: subscription %s was modified, expected version %d",
+			models.ErrPreconditionFailed, id, *expectedVersion)
+	}
+	return existing, nil
+}
+
+// touch сохраняет измененную подписку с новой версией и записывает событие
+// в журнал изменений; вызывается под r.mu
+func (r *SubscriptionRepository) touch(
+	ctx context.Context,
+	existing *models.Subscription,
+	changed *models.Subscription,
+	eventType string,
+) {
+	changed.Version++
+	changed.UpdatedAt = time.Now().UTC()
+	*changed = copySubscription(changed)
+	r.subscriptions[changed.ID] = *changed
+	r.recordEvent(ctx, changed.ID, eventType, existing, changed)
+}
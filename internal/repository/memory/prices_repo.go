@@ -0,0 +1,89 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/NKV510/subscription-service/internal/models"
+	"github.com/google/uuid"
+)
+
+// SchedulePriceChange сохраняет изменение цены неудаленной подписки,
+// увеличивает версию и записывает событие в журнал изменений; изменение с
+// той же даты заменяется
+func (r *SubscriptionRepository) SchedulePriceChange(
+	ctx context.Context,
+	id uuid.UUID,
+	change models.PriceChange,
+	expectedVersion *int,
+) (*models.Subscription, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, err := r.lockSubscription(id, expectedVersion)
+	if err != nil {
+		return nil, err
+	}
+	if change.Price < 0 {
+		return nil, models.NewValidationError("price", "must not be negative")
+	}
+
+	change.EffectiveFrom = truncateDay(change.EffectiveFrom)
+	changes := r.prices[id]
+	i, found := slices.BinarySearchFunc(changes, change.EffectiveFrom, func(c models.PriceChange, t time.Time) int {
+		return c.EffectiveFrom.Compare(t)
+	})
+	if found {
+		changes[i] = change
+	} else {
+		r.prices[id] = slices.Insert(changes, i, change)
+	}
+
+	repriced := copySubscription(&existing)
+	r.touch(ctx, &existing, &repriced, models.EventRepriced)
+
+	slog.Info("Price change scheduled", "id", id, "effective_from", change.EffectiveFrom, "price", change.Price)
+	return cloneSubscription(repriced), nil
+}
+
+// GetPriceChanges возвращает изменения цены неудаленной подписки в порядке
+// вступления в силу
+func (r *SubscriptionRepository) GetPriceChanges(ctx context.Context, id uuid.UUID) ([]models.PriceChange, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	sub, ok := r.subscriptions[id]
+	if !ok || sub.DeletedAt != nil {
+		return nil, fmt.Errorf("%w: subscription %s", models.ErrNotFound, id)
+	}
+	return slices.Clone(r.prices[id]), nil
+}
+
+// priceAt возвращает цену подписки, действующую на дату date: в пробный
+// период и период вводной цены - их цену, иначе последнее изменение цены
+func (r *SubscriptionRepository) priceAt(sub *models.Subscription, date time.Time) int {
+	if price, ok := sub.PromoPrice(date); ok {
+		return price
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	price := sub.Price
+	for _, change := range r.prices[sub.ID] {
+		if change.EffectiveFrom.After(date) {
+			break
+		}
+		price = change.Price
+	}
+	return price
+}
+
+// monthlyEquivalentAt возвращает цену подписки на дату date, приведенную
+// к месяцу
+func (r *SubscriptionRepository) monthlyEquivalentAt(sub *models.Subscription, date time.Time) int {
+	return models.MonthlyEquivalent(r.priceAt(sub, date), sub.BillingPeriod, sub.BillingIntervalMonths)
+}
@@ -0,0 +1,229 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/NKV510/subscription-service/internal/models"
+	"github.com/google/uuid"
+)
+
+// CreateService добавляет сервис в каталог вместе с его написаниями и
+// привязывает к нему подписки без сервиса с одним из этих написаний,
+// увеличивая их версию. Написание, которое уже принадлежит другому сервису, - models.ErrConflict
+func (r *SubscriptionRepository) CreateService(ctx context.Context, svc *models.Service) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.checkServiceNames(svc); err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	svc.ID = uuid.New()
+	svc.CreatedAt = now
+	svc.UpdatedAt = now
+	r.saveService(ctx, svc)
+
+	slog.Info("Service created successfully", "id", svc.ID, "name", svc.Name)
+	return nil
+}
+
+// UpdateService заменяет название, псевдонимы и цену по умолчанию сервиса.
+// Подписки сервиса получают новое каноническое название, подписки без
+// сервиса с одним из новых написаний привязываются к нему; версия каждой
+// измененной подписки увеличивается, изменение пишется в журнал
+func (r *SubscriptionRepository) UpdateService(ctx context.Context, svc *models.Service) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, ok := r.services[svc.ID]
+	if !ok {
+		return fmt.Errorf("%w: service %s", models.ErrNotFound, svc.ID)
+	}
+	if err := r.checkServiceNames(svc); err != nil {
+		return err
+	}
+
+	r.deleteServiceNames(svc.ID)
+	svc.CreatedAt = existing.CreatedAt
+	svc.UpdatedAt = time.Now().UTC()
+	r.saveService(ctx, svc)
+
+	r.relinkSubscriptions(ctx, func(sub *models.Subscription) bool {
+		return sub.ServiceID != nil && *sub.ServiceID == svc.ID && sub.ServiceName != svc.Name
+	}, &svc.ID, &svc.Name)
+
+	slog.Info("Service updated successfully", "id", svc.ID, "name", svc.Name)
+	return nil
+}
+
+// checkServiceNames повторяет первичный ключ service_names: написание
+// принадлежит одному сервису; вызывается под r.mu
+func (r *SubscriptionRepository) checkServiceNames(svc *models.Service) error {
+	if svc.DefaultPrice != nil && *svc.DefaultPrice < 1 {
+		return models.NewValidationError("default_price", "must be at least 1")
+	}
+
+	seen := make(map[string]bool)
+	for _, name := range append([]string{svc.Name}, svc.Aliases...) {
+		key := models.ServiceNameKey(name)
+		owner, taken := r.serviceNames[key]
+		if seen[key] || taken && owner != svc.ID {
+			return fmt.Errorf("%w: service name or alias is already in the catalog: %s", models.ErrConflict, name)
+		}
+		seen[key] = true
+	}
+	return nil
+}
+
+// saveService сохраняет копию сервиса с его написаниями и привязывает к нему
+// подписки без сервиса с этими написаниями; вызывается под r.mu
+func (r *SubscriptionRepository) saveService(ctx context.Context, svc *models.Service) {
+	stored := copyService(svc)
+	r.services[svc.ID] = &stored
+
+	for _, name := range append([]string{svc.Name}, svc.Aliases...) {
+		r.serviceNames[models.ServiceNameKey(name)] = svc.ID
+	}
+
+	r.relinkSubscriptions(ctx, func(sub *models.Subscription) bool {
+		return sub.ServiceID == nil && r.serviceNames[models.ServiceNameKey(sub.ServiceName)] == svc.ID
+	}, &svc.ID, &svc.Name)
+}
+
+// resolveService привязывает подписку к сервису каталога с ее названием или
+// псевдонимом и приводит название к каноническому; подписка с названием не
+// из каталога сохраняется без сервиса, так же как resolveServices в
+// postgres. Вызывается под r.mu
+func (r *SubscriptionRepository) resolveService(sub *models.Subscription) {
+	id, ok := r.serviceNames[models.ServiceNameKey(sub.ServiceName)]
+	if !ok {
+		sub.ServiceID = nil
+		return
+	}
+	sub.ServiceID = &id
+	sub.ServiceName = r.services[id].Name
+}
+
+// relinkSubscriptions привязывает подписки, для которых match возвращает
+// true, к сервису serviceID (nil - отвязывает) под названием name (nil -
+// название не меняется), увеличивает их версию и пишет изменение в журнал,
+// так же как relinkSubscriptions в postgres; вызывается под r.mu
+func (r *SubscriptionRepository) relinkSubscriptions(
+	ctx context.Context,
+	match func(sub *models.Subscription) bool,
+	serviceID *uuid.UUID,
+	name *string,
+) {
+	var ids []uuid.UUID
+	for id, sub := range r.subscriptions {
+		if match(&sub) {
+			ids = append(ids, id)
+		}
+	}
+	slices.SortFunc(ids, func(a, b uuid.UUID) int {
+		return strings.Compare(a.String(), b.String())
+	})
+
+	for _, id := range ids {
+		existing := r.subscriptions[id]
+		relinked := copySubscription(&existing)
+		relinked.ServiceID = serviceID
+		if name != nil {
+			relinked.ServiceName = *name
+		}
+		r.touch(ctx, &existing, &relinked, models.EventUpdated)
+	}
+}
+
+// deleteServiceNames удаляет все написания сервиса; вызывается под r.mu
+func (r *SubscriptionRepository) deleteServiceNames(id uuid.UUID) {
+	for key, owner := range r.serviceNames {
+		if owner == id {
+			delete(r.serviceNames, key)
+		}
+	}
+}
+
+// DeleteService удаляет сервис из каталога; подписки сохраняют название,
+// но теряют привязку к сервису, их версия увеличивается
+func (r *SubscriptionRepository) DeleteService(ctx context.Context, id uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.services[id]; !ok {
+		return fmt.Errorf("%w: service %s", models.ErrNotFound, id)
+	}
+	delete(r.services, id)
+	r.deleteServiceNames(id)
+
+	r.relinkSubscriptions(ctx, func(sub *models.Subscription) bool {
+		return sub.ServiceID != nil && *sub.ServiceID == id
+	}, nil, nil)
+
+	slog.Info("Service deleted successfully", "id", id)
+	return nil
+}
+
+func (r *SubscriptionRepository) GetService(ctx context.Context, id uuid.UUID) (*models.Service, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	svc, ok := r.services[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: service %s", models.ErrNotFound, id)
+	}
+	found := copyService(svc)
+	return &found, nil
+}
+
+// FindService находит сервис по каноническому названию или псевдониму без
+// учета регистра и лишних пробелов
+func (r *SubscriptionRepository) FindService(ctx context.Context, name string) (*models.Service, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	id, ok := r.serviceNames[models.ServiceNameKey(name)]
+	if !ok {
+		return nil, fmt.Errorf("%w: service %q", models.ErrNotFound, name)
+	}
+	found := copyService(r.services[id])
+	return &found, nil
+}
+
+// ListServices возвращает каталог сервисов по названию
+func (r *SubscriptionRepository) ListServices(ctx context.Context) ([]models.Service, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	services := make([]models.Service, 0, len(r.services))
+	for _, svc := range r.services {
+		services = append(services, copyService(svc))
+	}
+	sort.Slice(services, func(i, j int) bool {
+		if services[i].Name != services[j].Name {
+			return services[i].Name < services[j].Name
+		}
+		return services[i].ID.String() < services[j].ID.String()
+	})
+	return services, nil
+}
+
+// copyService возвращает копию сервиса с псевдонимами по возрастанию, как
+// их выбирает postgres
+func copyService(svc *models.Service) models.Service {
+	stored := *svc
+	stored.Aliases = slices.Clone(svc.Aliases)
+	if stored.Aliases == nil {
+		stored.Aliases = []string{}
+	}
+	slices.Sort(stored.Aliases)
+	stored.DefaultPrice = copyInt(svc.DefaultPrice)
+	return stored
+}
@@ -0,0 +1,420 @@
+package memory
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/NKV510/subscription-service/internal/models"
+	"github.com/google/uuid"
+)
+
+// SubscriptionRepository хранит подписки в памяти процесса. Повторяет
+// поведение postgres.SubscriptionRepository и используется в тестах
+// сервиса и обработчиков без базы данных
+type SubscriptionRepository struct {
+	mu              sync.RWMutex
+	subscriptions   map[uuid.UUID]models.Subscription
+	idempotencyKeys map[string]idempotencyRecord
+	events          []models.SubscriptionEvent
+	exchangeRates   map[exchangeRateKey]float64
+	prices          map[uuid.UUID][]models.PriceChange // по возрастанию EffectiveFrom
+	cancellations   map[uuid.UUID]models.Cancellation
+	services        map[uuid.UUID]*models.Service
+	serviceNames    map[string]uuid.UUID // models.ServiceNameKey написания -> сервис
+	tags            map[uuid.UUID]models.Tag
+	tagKeys         map[tagKey]uuid.UUID
+}
+
+func NewSubscriptionRepository() *SubscriptionRepository {
+	return &SubscriptionRepository{
+		subscriptions:   make(map[uuid.UUID]models.Subscription),
+		idempotencyKeys: make(map[string]idempotencyRecord),
+		exchangeRates:   make(map[exchangeRateKey]float64),
+		prices:          make(map[uuid.UUID][]models.PriceChange),
+		cancellations:   make(map[uuid.UUID]models.Cancellation),
+		services:        make(map[uuid.UUID]*models.Service),
+		serviceNames:    make(map[string]uuid.UUID),
+		tags:            make(map[uuid.UUID]models.Tag),
+		tagKeys:         make(map[tagKey]uuid.UUID),
+	}
+}
+
+// Create добавляет подписку, привязанную к сервису каталога по названию, и
+// записывает событие в журнал изменений
+func (r *SubscriptionRepository) Create(ctx context.Context, sub *models.Subscription) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.resolveService(sub)
+	if err := r.checkConstraints(sub); err != nil {
+		return err
+	}
+	r.create(ctx, sub)
+
+	slog.Info("Subscription created successfully", "id", sub.ID)
+	return nil
+}
+
+// checkConstraints повторяет ограничения CHECK и внешний ключ на каталог
+// сервисов таблицы subscriptions; вызывается под r.mu
+func (r *SubscriptionRepository) checkConstraints(sub *models.Subscription) error {
+	interval := sub.BillingIntervalMonths
+	switch {
+	case sub.ServiceID != nil && r.services[*sub.ServiceID] == nil:
+		return models.NewValidationError("service_name", "service is not in the catalog")
+	case sub.Price < 0:
+		return models.NewValidationError("price", "must not be negative")
+	case !currencyPattern.MatchString(sub.Currency):
+		return models.NewValidationError("currency", "must be an ISO 4217 code")
+	case sub.EndDate != nil && sub.EndDate.Before(sub.StartDate):
+		return models.NewValidationError("end_date", "must not be before start_date")
+	case !models.IsBillingPeriod(sub.BillingPeriod):
+		return models.NewValidationError("billing_period", "unsupported billing period")
+	case (sub.BillingPeriod == models.BillingCustom) != (interval != nil),
+		interval != nil && (*interval < 1 || *interval > models.MaxBillingIntervalMonths):
+		return models.NewValidationError("billing_interval_months",
+			"must be set from 1 to 120 for custom billing period only")
+	case sub.TrialMonths != nil && (*sub.TrialMonths < 1 || *sub.TrialMonths > models.MaxPromoMonths):
+		return models.NewValidationError("trial_months", "must be from 1 to 24")
+	case (sub.IntroPrice == nil) != (sub.IntroMonths == nil), sub.IntroPrice != nil && *sub.IntroPrice < 0:
+		return models.NewValidationError("intro_price", "must be set with intro_months and not negative")
+	case sub.IntroMonths != nil && (*sub.IntroMonths < 1 || *sub.IntroMonths > models.MaxPromoMonths):
+		return models.NewValidationError("intro_months", "must be from 1 to 24")
+	}
+	return nil
+}
+
+// create сохраняет новую подписку и событие о ее создании; вызывается под r.mu
+func (r *SubscriptionRepository) create(ctx context.Context, sub *models.Subscription) {
+	// Как и в postgres, идентификатор и служебные поля выдает хранилище
+	now := time.Now().UTC()
+	sub.ID = uuid.New()
+	sub.Version = 1
+	sub.CreatedAt = now
+	sub.UpdatedAt = now
+	sub.Pauses = nil
+	sub.Tags = nil
+	r.subscriptions[sub.ID] = copySubscription(sub)
+	r.recordEvent(ctx, sub.ID, models.EventCreated, nil, sub)
+}
+
+func (r *SubscriptionRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Subscription, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	sub, ok := r.subscriptions[id]
+	if !ok || sub.DeletedAt != nil {
+		return nil, fmt.Errorf("%w: subscription %s", models.ErrNotFound, id)
+	}
+
+	return cloneSubscription(sub), nil
+}
+
+// Update сохраняет подписку, если ее версия совпадает с sub.Version,
+// увеличивает версию и записывает событие в журнал изменений. Иначе
+// возвращает models.ErrPreconditionFailed. Отмена подписки удаляется, если
+// end_date больше не приходится на месяц отмены
+func (r *SubscriptionRepository) Update(ctx context.Context, sub *models.Subscription) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, ok := r.subscriptions[sub.ID]
+	if !ok || existing.DeletedAt != nil {
+		return fmt.Errorf("%w: subscription %s", models.ErrNotFound, sub.ID)
+	}
+	if existing.Version != sub.Version {
+		return fmt.Errorf("%w: subscription %s was modified, expected version %d",
+			models.ErrPreconditionFailed, sub.ID, sub.Version)
+	}
+	r.resolveService(sub)
+	if err := r.checkConstraints(sub); err != nil {
+		return err
+	}
+
+	sub.Version++
+	sub.UpdatedAt = time.Now().UTC()
+
+	// UPDATE в postgres не трогает user_id, created_at, приостановки и теги
+	updated := copySubscription(sub)
+	updated.UserID = existing.UserID
+	updated.CreatedAt = existing.CreatedAt
+	updated.Pauses = existing.Pauses
+	updated.Tags = existing.Tags
+	updated = copySubscription(&updated)
+	r.subscriptions[sub.ID] = updated
+	*sub = copySubscription(&updated)
+	r.deleteStaleCancellation(sub)
+	r.recordEvent(ctx, sub.ID, models.EventUpdated, &existing, sub)
+
+	slog.Info("Subscription updated successfully", "id", sub.ID)
+	return nil
+}
+
+// Delete помечает подписку удаленной и записывает событие в журнал
+// изменений. Если expectedVersion задан, подписка удаляется только при
+// совпадении версии. Удаленную подписку можно восстановить до очистки
+func (r *SubscriptionRepository) Delete(ctx context.Context, id uuid.UUID, expectedVersion *int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, ok := r.subscriptions[id]
+	if !ok || existing.DeletedAt != nil {
+		return fmt.Errorf("%w: subscription %s", models.ErrNotFound, id)
+	}
+	if expectedVersion != nil && existing.Version != *expectedVersion {
+		return fmt.Errorf("%w: subscription %s was modified, expected version %d",
+			models.ErrPreconditionFailed, id, *expectedVersion)
+	}
+
+	now := time.Now().UTC()
+	deleted := copySubscription(&existing)
+	deleted.DeletedAt = &now
+	deleted.Version++
+	deleted.UpdatedAt = now
+	r.subscriptions[id] = deleted
+	r.recordEvent(ctx, id, models.EventDeleted, &existing, &deleted)
+
+	slog.Info("Subscription deleted successfully", "id", id)
+	return nil
+}
+
+// Restore снимает с подписки пометку об удалении и записывает событие в
+// журнал изменений. Для неудаленной подписки возвращает models.ErrConflict
+func (r *SubscriptionRepository) Restore(ctx context.Context, id uuid.UUID) (*models.Subscription, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, ok := r.subscriptions[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: subscription %s", models.ErrNotFound, id)
+	}
+	if existing.DeletedAt == nil {
+		return nil, fmt.Errorf("%w: subscription %s is not deleted", models.ErrConflict, id)
+	}
+
+	restored := copySubscription(&existing)
+	restored.DeletedAt = nil
+	restored.Version++
+	restored.UpdatedAt = time.Now().UTC()
+	r.subscriptions[id] = restored
+	r.recordEvent(ctx, id, models.EventRestored, &existing, &restored)
+
+	slog.Info("Subscription restored successfully", "id", id)
+	return cloneSubscription(restored), nil
+}
+
+// Purge окончательно удаляет подписки, удаленные раньше deletedBefore,
+// и возвращает их количество. Журнал изменений сохраняется
+func (r *SubscriptionRepository) Purge(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var purged int64
+	for id, sub := range r.subscriptions {
+		if sub.DeletedAt != nil && sub.DeletedAt.Before(deletedBefore) {
+			delete(r.subscriptions, id)
+			delete(r.prices, id)
+			delete(r.cancellations, id)
+			purged++
+		}
+	}
+
+	slog.Info("Purged deleted subscriptions", "count", purged, "deleted_before", deletedBefore)
+	return purged, nil
+}
+
+// copySubscription возвращает копию подписки, не разделяющую указатели
+// с оригиналом, с пересчитанными вычисляемыми полями
+func copySubscription(sub *models.Subscription) models.Subscription {
+	stored := *sub
+	if sub.EndDate != nil {
+		endDate := *sub.EndDate
+		stored.EndDate = &endDate
+	}
+	if sub.ServiceID != nil {
+		serviceID := *sub.ServiceID
+		stored.ServiceID = &serviceID
+	}
+	if sub.BillingIntervalMonths != nil {
+		interval := *sub.BillingIntervalMonths
+		stored.BillingIntervalMonths = &interval
+	}
+	stored.TrialMonths = copyInt(sub.TrialMonths)
+	stored.IntroPrice = copyInt(sub.IntroPrice)
+	stored.IntroMonths = copyInt(sub.IntroMonths)
+	if sub.DeletedAt != nil {
+		deletedAt := *sub.DeletedAt
+		stored.DeletedAt = &deletedAt
+	}
+	stored.Pauses = nil
+	for _, pause := range sub.Pauses {
+		if pause.ResumedFrom != nil {
+			resumedFrom := *pause.ResumedFrom
+			pause.ResumedFrom = &resumedFrom
+		}
+		stored.Pauses = append(stored.Pauses, pause)
+	}
+	stored.Tags = slices.Clone(sub.Tags)
+	stored.SetComputed(time.Now())
+	return stored
+}
+
+func copyInt(v *int) *int {
+	if v == nil {
+		return nil
+	}
+	copied := *v
+	return &copied
+}
+
+func cloneSubscription(sub models.Subscription) *models.Subscription {
+	clone := copySubscription(&sub)
+	return &clone
+}
+
+// List возвращает страницу подписок, удовлетворяющих фильтру, в порядке
+// (SortBy, id). Следующая страница начинается после filter.After
+func (r *SubscriptionRepository) List(
+	ctx context.Context,
+	filter models.SubscriptionFilter,
+) ([]*models.Subscription, error) {
+	subscriptions, err := r.list(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(subscriptions) > filter.Limit {
+		subscriptions = subscriptions[:filter.Limit]
+	}
+
+	slog.Info("Listed subscriptions", "count", len(subscriptions))
+	return subscriptions, nil
+}
+
+// Export передает в fn все подписки, удовлетворяющие фильтру, в порядке
+// (SortBy, id). filter.Limit не используется. Ошибка fn прерывает выгрузку
+func (r *SubscriptionRepository) Export(
+	ctx context.Context,
+	filter models.SubscriptionFilter,
+	fn func(sub *models.Subscription) error,
+) error {
+	subscriptions, err := r.list(filter)
+	if err != nil {
+		return err
+	}
+
+	for _, sub := range subscriptions {
+		if err := fn(sub); err != nil {
+			return err
+		}
+	}
+
+	slog.Info("Exported subscriptions", "count", len(subscriptions))
+	return nil
+}
+
+// list возвращает все подписки, удовлетворяющие фильтру, в порядке
+// (SortBy, id) без учета filter.Limit
+func (r *SubscriptionRepository) list(filter models.SubscriptionFilter) ([]*models.Subscription, error) {
+	var compareValues func(a, b *models.Subscription) int
+	switch filter.SortBy {
+	case models.SortByStartDate:
+		compareValues = func(a, b *models.Subscription) int { return a.StartDate.Compare(b.StartDate) }
+	case models.SortByPrice:
+		compareValues = func(a, b *models.Subscription) int { return cmp.Compare(a.Price, b.Price) }
+	case models.SortByServiceName:
+		compareValues = func(a, b *models.Subscription) int { return strings.Compare(a.ServiceName, b.ServiceName) }
+	default:
+		return nil, fmt.Errorf("%w: unsupported sort field: %s", models.ErrValidation, filter.SortBy)
+	}
+
+	// compare упорядочивает подписки по (SortBy, id) с учетом направления
+	compare := func(a, b *models.Subscription) int {
+		result := compareValues(a, b)
+		if result == 0 {
+			result = bytes.Compare(a.ID[:], b.ID[:])
+		}
+		if filter.Desc {
+			result = -result
+		}
+		return result
+	}
+
+	var after *models.Subscription
+	if filter.After != nil {
+		var err error
+		after, err = cursorSubscription(filter.After)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	r.mu.RLock()
+	var subscriptions []*models.Subscription
+	for _, stored := range r.subscriptions {
+		sub := cloneSubscription(stored)
+		if matchesFilter(sub, filter) && (after == nil || compare(sub, after) > 0) {
+			subscriptions = append(subscriptions, sub)
+		}
+	}
+	r.mu.RUnlock()
+
+	slices.SortFunc(subscriptions, compare)
+	return subscriptions, nil
+}
+
+// cursorSubscription восстанавливает из курсора подписку с теми же
+// значениями поля сортировки и ID для сравнения
+func cursorSubscription(cursor *models.ListCursor) (*models.Subscription, error) {
+	sub := &models.Subscription{ID: cursor.ID}
+
+	var err error
+	switch cursor.SortBy {
+	case models.SortByStartDate:
+		sub.StartDate, err = time.Parse("2006-01-02", cursor.Value)
+	case models.SortByPrice:
+		sub.Price, err = strconv.Atoi(cursor.Value)
+	case models.SortByServiceName:
+		sub.ServiceName = cursor.Value
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid cursor value: %v", models.ErrValidation, err)
+	}
+
+	return sub, nil
+}
+
+func matchesFilter(sub *models.Subscription, filter models.SubscriptionFilter) bool {
+	switch {
+	case sub.DeletedAt != nil,
+		filter.UserID != nil && sub.UserID != *filter.UserID,
+		filter.ServiceName != nil && sub.ServiceName != *filter.ServiceName,
+		filter.ActiveFrom != nil && sub.EndDate != nil && sub.EndDate.Before(*filter.ActiveFrom),
+		filter.ActiveTo != nil && sub.StartDate.After(*filter.ActiveTo),
+		filter.MinPrice != nil && sub.Price < *filter.MinPrice,
+		filter.MaxPrice != nil && sub.Price > *filter.MaxPrice,
+		filter.StartFrom != nil && sub.StartDate.Before(*filter.StartFrom),
+		filter.StartTo != nil && sub.StartDate.After(*filter.StartTo),
+		filter.EndFrom != nil && (sub.EndDate == nil || sub.EndDate.Before(*filter.EndFrom)),
+		filter.EndTo != nil && (sub.EndDate == nil || sub.EndDate.After(*filter.EndTo)):
+		return false
+	}
+	if !hasTags(sub, filter.Tags) {
+		return false
+	}
+	if filter.TrialEndFrom != nil && filter.TrialEndTo != nil {
+		trialEnd, ok := sub.TrialEnd()
+		if !ok || trialEnd.Before(*filter.TrialEndFrom) || trialEnd.After(*filter.TrialEndTo) {
+			return false
+		}
+	}
+	return true
+}
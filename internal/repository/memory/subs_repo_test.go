@@ -0,0 +1,14 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/NKV510/subscription-service/internal/repository/repotest"
+	"github.com/NKV510/subscription-service/internal/service"
+)
+
+func TestSubscriptionRepository(t *testing.T) {
+	repotest.RunSubscriptionRepositoryTests(t, func(t *testing.T) service.SubscriptionRepository {
+		return NewSubscriptionRepository()
+	})
+}
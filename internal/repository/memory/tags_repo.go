@@ -0,0 +1,185 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/NKV510/subscription-service/internal/models"
+	"github.com/google/uuid"
+)
+
+// tagKey уникальный ключ тега, как ограничение tags_user_id_name_key_key:
+// пользователь и models.TagKey названия
+type tagKey struct {
+	userID uuid.UUID
+	name   string
+}
+
+func keyOf(tag models.Tag) tagKey {
+	return tagKey{tag.UserID, models.TagKey(tag.Name)}
+}
+
+// CreateTag добавляет тег пользователя; тег пользователя с тем же ключом
+// названия - models.ErrConflict
+func (r *SubscriptionRepository) CreateTag(ctx context.Context, tag *models.Tag) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.tagKeys[keyOf(*tag)]; ok {
+		return fmt.Errorf("%w: tag %q already exists", models.ErrConflict, tag.Name)
+	}
+	r.createTag(tag)
+
+	slog.Info("Tag created successfully", "id", tag.ID, "user_id", tag.UserID, "name", tag.Name)
+	return nil
+}
+
+// createTag сохраняет новый тег; вызывается под r.mu
+func (r *SubscriptionRepository) createTag(tag *models.Tag) {
+	tag.ID = uuid.New()
+	tag.CreatedAt = time.Now().UTC()
+	r.tags[tag.ID] = *tag
+	r.tagKeys[keyOf(*tag)] = tag.ID
+}
+
+// RenameTag меняет название тега. Версия каждой отмеченной им подписки
+// увеличивается, изменение пишется в журнал. Тег того же пользователя с тем
+// же ключом названия - models.ErrConflict
+func (r *SubscriptionRepository) RenameTag(ctx context.Context, tag *models.Tag) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, ok := r.tags[tag.ID]
+	if !ok {
+		return fmt.Errorf("%w: tag %s", models.ErrNotFound, tag.ID)
+	}
+	tag.UserID = existing.UserID
+	if owner, ok := r.tagKeys[keyOf(*tag)]; ok && owner != tag.ID {
+		return fmt.Errorf("%w: tag %q already exists", models.ErrConflict, tag.Name)
+	}
+
+	delete(r.tagKeys, keyOf(existing))
+	tag.CreatedAt = existing.CreatedAt
+	r.tags[tag.ID] = *tag
+	r.tagKeys[keyOf(*tag)] = tag.ID
+	r.replaceTag(ctx, existing, &tag.Name)
+
+	slog.Info("Tag renamed successfully", "id", tag.ID, "name", tag.Name)
+	return nil
+}
+
+// DeleteTag удаляет тег и снимает его со всех подписок; версия каждой из
+// них увеличивается, изменение пишется в журнал
+func (r *SubscriptionRepository) DeleteTag(ctx context.Context, id uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, ok := r.tags[id]
+	if !ok {
+		return fmt.Errorf("%w: tag %s", models.ErrNotFound, id)
+	}
+	delete(r.tags, id)
+	delete(r.tagKeys, keyOf(existing))
+	r.replaceTag(ctx, existing, nil)
+
+	slog.Info("Tag deleted successfully", "id", id)
+	return nil
+}
+
+// replaceTag заменяет тег у подписок его пользователя на renamed или
+// снимает его, если renamed == nil, увеличивая версию каждой подписки с
+// записью события в журнал, так же как retagSubscriptions в postgres;
+// вызывается под r.mu
+func (r *SubscriptionRepository) replaceTag(ctx context.Context, tag models.Tag, renamed *string) {
+	var ids []uuid.UUID
+	for id, sub := range r.subscriptions {
+		if sub.UserID == tag.UserID && slices.Contains(sub.Tags, tag.Name) {
+			ids = append(ids, id)
+		}
+	}
+	slices.SortFunc(ids, func(a, b uuid.UUID) int {
+		return strings.Compare(a.String(), b.String())
+	})
+
+	for _, id := range ids {
+		existing := r.subscriptions[id]
+		retagged := copySubscription(&existing)
+		i := slices.Index(retagged.Tags, tag.Name)
+		retagged.Tags = slices.Delete(retagged.Tags, i, i+1)
+		if renamed != nil {
+			retagged.Tags = append(retagged.Tags, *renamed)
+			slices.Sort(retagged.Tags)
+		}
+		r.touch(ctx, &existing, &retagged, models.EventTagged)
+	}
+}
+
+// ListTags возвращает теги по названию, все или только пользователя userID
+func (r *SubscriptionRepository) ListTags(ctx context.Context, userID *uuid.UUID) ([]models.Tag, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	tags := make([]models.Tag, 0, len(r.tags))
+	for _, tag := range r.tags {
+		if userID == nil || tag.UserID == *userID {
+			tags = append(tags, tag)
+		}
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		if tags[i].Name != tags[j].Name {
+			return tags[i].Name < tags[j].Name
+		}
+		return tags[i].ID.String() < tags[j].ID.String()
+	})
+	return tags, nil
+}
+
+// SetTags заменяет теги неудаленной подписки тегами ее пользователя с
+// названиями names, создавая недостающие, увеличивает версию и записывает
+// событие в журнал изменений. Названия в names не должны совпадать по ключу
+func (r *SubscriptionRepository) SetTags(
+	ctx context.Context,
+	id uuid.UUID,
+	names []string,
+	expectedVersion *int,
+) (*models.Subscription, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, err := r.lockSubscription(id, expectedVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	tagged := copySubscription(&existing)
+	tagged.Tags = nil
+	for _, name := range names {
+		tag := models.Tag{UserID: existing.UserID, Name: name}
+		tagID, ok := r.tagKeys[keyOf(tag)]
+		if !ok {
+			r.createTag(&tag)
+			tagID = tag.ID
+		}
+		tagged.Tags = append(tagged.Tags, r.tags[tagID].Name)
+	}
+	slices.Sort(tagged.Tags)
+	r.touch(ctx, &existing, &tagged, models.EventTagged)
+
+	slog.Info("Subscription tags set", "id", id, "tags", names)
+	return cloneSubscription(tagged), nil
+}
+
+// hasTags сообщает, отмечена ли подписка всеми тегами с ключами keys
+func hasTags(sub *models.Subscription, keys []string) bool {
+	for _, key := range keys {
+		if !slices.ContainsFunc(sub.Tags, func(name string) bool { return models.TagKey(name) == key }) {
+			return false
+		}
+	}
+	return true
+}
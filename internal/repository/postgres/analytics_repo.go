@@ -0,0 +1,464 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/NKV510/subscription-service/internal/models"
+)
+
+// spendCTE выбирает подписки, активные в окне [$1, $2] (active), и
+// разворачивает их в списания (charges): одна строка на каждый период
+// оплаты, пересекающийся с окном, по цене, действующей в день списания (с
+// учетом пробного периода и вводной цены); списания на время приостановки
+// пропускаются. Периоды отсчитываются от start_date, как
+// models.CycleStart. charge_date и charge_amount - день и сумма списания:
+// списание в первый день периода, сумма пропорциональна дням периода до
+// end_date. month и amount - месяц начала части периода внутри окна и
+// доля списания за ее дни; суммы округляются до целого.
+// Дополнительные условия фильтра подставляются в WHERE выборки active.
+var spendCTE = `
+    WITH active AS (
+        SELECT s.id, s.user_id, s.service_name, s.price, s.currency, s.start_date, s.end_date,
+               s.trial_months, s.intro_price, s.intro_months, p.cycle_months
+        FROM subscriptions s
+        CROSS JOIN LATERAL (
+            SELECT CASE s.billing_period
+                       WHEN 'weekly' THEN 0
+                       WHEN 'monthly' THEN 1
+                       WHEN 'quarterly' THEN 3
+                       WHEN 'yearly' THEN 12
+                       ELSE s.billing_interval_months
+                   END AS cycle_months
+        ) AS p
+        WHERE s.deleted_at IS NULL
+          AND s.start_date <= $2::date
+          AND (s.end_date IS NULL OR s.end_date >= $1::date)
+          %s
+    ),
+    charges AS (
+        SELECT a.id AS subscription_id, a.user_id, a.service_name, a.currency,
+               d.charge_date,
+               ROUND(d.price * (d.paid_till - d.charge_date + 1)::numeric
+                     / (c.next_day - c.first_day))::integer AS charge_amount,
+               date_trunc('month', d.spent_from)::date AS month,
+               ROUND(d.price * (d.spent_till - d.spent_from + 1)::numeric
+                     / (c.next_day - c.first_day))::integer AS amount
+        FROM active a
+        CROSS JOIN LATERAL (
+            SELECT LEAST(COALESCE(a.end_date, $2::date), $2::date) AS last_day
+        ) AS w
+        -- Последний период может начинаться в месяце last_day, но после
+        -- него; такие периоды отсекаются в WHERE
+        CROSS JOIN LATERAL generate_series(0,
+            CASE WHEN a.cycle_months = 0 THEN (w.last_day - a.start_date) / 7
+                 ELSE ((date_part('year', w.last_day) - date_part('year', a.start_date)) * 12
+                       + date_part('month', w.last_day) - date_part('month', a.start_date))::integer
+                      / a.cycle_months
+            END
+        ) AS k(n)
+        CROSS JOIN LATERAL (
+            SELECT CASE WHEN a.cycle_months = 0 THEN a.start_date + 7 * k.n
+                        ELSE (a.start_date + make_interval(months => k.n * a.cycle_months))::date
+                   END AS first_day,
+                   CASE WHEN a.cycle_months = 0 THEN a.start_date + 7 * (k.n + 1)
+                        ELSE (a.start_date + make_interval(months => (k.n + 1) * a.cycle_months))::date
+                   END AS next_day
+        ) AS c
+        CROSS JOIN LATERAL (
+            SELECT c.first_day AS charge_date,
+                   LEAST(c.next_day - 1, COALESCE(a.end_date, c.next_day - 1)) AS paid_till
+        ) AS b
+        CROSS JOIN LATERAL (
+            SELECT b.charge_date, b.paid_till,
+                   GREATEST(b.charge_date, $1::date) AS spent_from,
+                   LEAST(b.paid_till, $2::date) AS spent_till,
+                   ` + effectivePrice("b.charge_date") + ` AS price
+        ) AS d
+        WHERE c.next_day > $1::date
+          AND c.first_day <= w.last_day
+          AND NOT ` + pausedThrough("b.charge_date", "b.charge_date") + `
+    )
+`
+
+// effectivePrice возвращает выражение цены подписки active a, действующей
+// на дату date: 0 в пробный период, вводная цена после него, иначе
+// последнее изменение цены, как models.Subscription.PromoPrice и priceAt
+func effectivePrice(date string) string {
+	return `CASE
+                   WHEN ` + date + ` < (a.start_date + make_interval(months => COALESCE(a.trial_months, 0)))::date
+                   THEN 0
+                   WHEN ` + date + ` < (a.start_date + make_interval(months => COALESCE(a.trial_months, 0) + COALESCE(a.intro_months, 0)))::date
+                   THEN a.intro_price
+                   ELSE COALESCE((
+                       SELECT sp.price FROM subscription_prices sp
+                       WHERE sp.subscription_id = a.id AND sp.effective_from <= ` + date + `
+                       ORDER BY sp.effective_from DESC
+                       LIMIT 1
+                   ), a.price)
+               END`
+}
+
+// pausedThrough возвращает условие, что подписка active a приостановлена
+// весь период [first, last], как models.Subscription.PausedThrough
+func pausedThrough(first, last string) string {
+	return `EXISTS (
+                   SELECT 1 FROM subscription_pauses sp
+                   WHERE sp.subscription_id = a.id AND sp.paused_from <= ` + first + `
+                     AND (sp.resumed_from IS NULL OR sp.resumed_from > ` + last + `)
+               )`
+}
+
+// monthlyEquivalent возвращает выражение цены подписки active a на дату
+// date, приведенной к месяцу так же, как models.MonthlyEquivalent
+func monthlyEquivalent(date string) string {
+	price := effectivePrice(date)
+	return `CASE WHEN a.cycle_months = 0 THEN ROUND(` + price + ` * 52 / 12.0)
+                    ELSE ROUND(` + price + `::numeric / a.cycle_months)
+               END::integer`
+}
+
+// spendQuery собирает CTE подписок и списаний с условиями фильтра и
+// возвращает его вместе с аргументами запроса
+func spendQuery(filter models.SpendFilter) (string, []interface{}) {
+	var conditions string
+	args := []interface{}{filter.From, filter.To}
+	argIndex := 3
+
+	if filter.UserID != nil {
+		conditions += fmt.Sprintf(" AND s.user_id = $%d", argIndex)
+		args = append(args, *filter.UserID)
+		argIndex++
+	}
+
+	if filter.ServiceName != nil {
+		conditions += fmt.Sprintf(" AND s.service_name = $%d", argIndex)
+		args = append(args, *filter.ServiceName)
+	}
+
+	return fmt.Sprintf(spendCTE, conditions), args
+}
+
+// GetTotalSpent возвращает сумму списаний по подпискам за окно [from, to]:
+// цена за каждый период оплаты в окне, за период, лишь частично попавший в
+// окно или оплаченный не целиком, - пропорционально дням. Если задана
+// filter.Currency, списания пересчитываются в нее с помощью convertedTotal
+func (r *SubscriptionRepository) GetTotalSpent(ctx context.Context, filter models.SpendFilter) (int, error) {
+	if filter.Currency != nil {
+		return r.convertedTotal(ctx, filter)
+	}
+
+	cte, args := spendQuery(filter)
+	query := cte + `SELECT COALESCE(SUM(amount), 0) FROM charges`
+
+	var total int
+	err := r.pool.QueryRow(ctx, query, args...).Scan(&total)
+	if err != nil {
+		slog.Error("Failed to calculate total spent",
+			"from", filter.From, "to", filter.To, "user_id", filter.UserID, "service_name", filter.ServiceName, "error", err)
+		return 0, fmt.Errorf("failed to calculate total spent: %w", err)
+	}
+
+	slog.Info("Calculated total spent",
+		"from", filter.From, "to", filter.To, "user_id", filter.UserID, "service_name", filter.ServiceName, "total", total)
+	return total, nil
+}
+
+// GetSpendCurrencies возвращает валюты подписок, активных в окне фильтра,
+// в порядке кода валюты
+func (r *SubscriptionRepository) GetSpendCurrencies(ctx context.Context, filter models.SpendFilter) ([]string, error) {
+	cte, args := spendQuery(filter)
+	query := cte + `
+        SELECT DISTINCT currency FROM active ORDER BY currency
+    `
+
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		slog.Error("Failed to get spend currencies", "from", filter.From, "to", filter.To, "user_id", filter.UserID, "error", err)
+		return nil, fmt.Errorf("failed to get spend currencies: %w", err)
+	}
+	defer rows.Close()
+
+	currencies := make([]string, 0)
+	for rows.Next() {
+		var currency string
+		if err := rows.Scan(&currency); err != nil {
+			return nil, fmt.Errorf("failed to scan currency: %w", err)
+		}
+		currencies = append(currencies, currency)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return currencies, nil
+}
+
+// convertedTotal пересчитывает сумму списаний каждого месяца в каждой
+// валюте в filter.Currency по курсу, действующему в последний день месяца,
+// с округлением до целого. Если прямого курса нет, используется обратный.
+// Если нет ни того, ни другого, возвращает ошибку поля currency
+func (r *SubscriptionRepository) convertedTotal(ctx context.Context, filter models.SpendFilter) (int, error) {
+	cte, args := spendQuery(filter)
+	args = append(args, *filter.Currency)
+	query := cte + fmt.Sprintf(`
+        SELECT t.month, t.currency, ROUND(t.amount * x.rate)::bigint
+        FROM (
+            SELECT month, currency, SUM(amount) AS amount
+            FROM charges
+            GROUP BY month, currency
+        ) AS t
+        LEFT JOIN LATERAL (
+            SELECT CASE WHEN t.currency = $%[1]d THEN 1 ELSE (
+                SELECT r.rate
+                FROM (
+                    SELECT date, rate, 0 AS inverse
+                    FROM exchange_rates
+                    WHERE from_currency = t.currency AND to_currency = $%[1]d
+                    UNION ALL
+                    SELECT date, 1 / rate, 1
+                    FROM exchange_rates
+                    WHERE from_currency = $%[1]d AND to_currency = t.currency
+                ) AS r
+                WHERE r.date <= (t.month + interval '1 month - 1 day')::date
+                ORDER BY r.date DESC, r.inverse
+                LIMIT 1
+            ) END AS rate
+        ) AS x ON true
+        ORDER BY t.month, t.currency
+    `, len(args))
+
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		slog.Error("Failed to calculate converted total spent",
+			"from", filter.From, "to", filter.To, "currency", *filter.Currency, "error", err)
+		return 0, fmt.Errorf("failed to calculate total spent: %w", err)
+	}
+	defer rows.Close()
+
+	total := 0
+	for rows.Next() {
+		var (
+			month     time.Time
+			currency  string
+			converted *int
+		)
+		if err := rows.Scan(&month, &currency, &converted); err != nil {
+			return 0, fmt.Errorf("failed to scan converted total: %w", err)
+		}
+		if converted == nil {
+			return 0, models.NewValidationError("currency", fmt.Sprintf(
+				"no exchange rate from %s to %s effective in %s", currency, *filter.Currency, models.MonthYear(month)))
+		}
+		total += *converted
+	}
+
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	slog.Info("Calculated total spent",
+		"from", filter.From, "to", filter.To, "currency", *filter.Currency, "total", total)
+	return total, nil
+}
+
+// ListCharges возвращает списания по подпискам, приходящиеся на окно
+// [from, to], целиком, в порядке даты списания, названия сервиса и id
+// подписки
+func (r *SubscriptionRepository) ListCharges(ctx context.Context, filter models.SpendFilter) ([]models.Charge, error) {
+	cte, args := spendQuery(filter)
+	query := cte + `
+        SELECT subscription_id, user_id, service_name, charge_date, charge_amount, currency
+        FROM charges
+        WHERE charge_date >= $1::date
+        ORDER BY charge_date, service_name COLLATE "C", subscription_id
+    `
+
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		slog.Error("Failed to list charges", "from", filter.From, "to", filter.To, "user_id", filter.UserID, "error", err)
+		return nil, fmt.Errorf("failed to list charges: %w", err)
+	}
+	defer rows.Close()
+
+	var charges []models.Charge
+	for rows.Next() {
+		var c models.Charge
+		if err := rows.Scan(&c.SubscriptionID, &c.UserID, &c.ServiceName, &c.Date, &c.Amount, &c.Currency); err != nil {
+			return nil, fmt.Errorf("failed to scan charge: %w", err)
+		}
+		charges = append(charges, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return charges, nil
+}
+
+// GetMonthlySpent возвращает по каждому месяцу окна [from, to] сумму
+// списаний, число активных в месяце подписок и сумму их цен на конец
+// месяца, приведенных к месяцу; подписка, приостановленная на весь месяц,
+// в нем не учитывается. Месяцы без подписок тоже возвращаются
+func (r *SubscriptionRepository) GetMonthlySpent(
+	ctx context.Context,
+	filter models.SpendFilter,
+) ([]models.MonthlySpent, error) {
+	cte, args := spendQuery(filter)
+	query := cte + `
+        SELECT w.month::date,
+               COALESCE((SELECT SUM(c.amount) FROM charges c WHERE c.month = w.month::date), 0),
+               COUNT(m.id),
+               COALESCE(SUM(m.monthly_equivalent), 0)
+        FROM generate_series(
+            date_trunc('month', $1::date::timestamp),
+            date_trunc('month', $2::date::timestamp),
+            interval '1 month'
+        ) AS w(month)
+        LEFT JOIN LATERAL (
+            SELECT a.id, ` + monthlyEquivalent("(w.month + interval '1 month - 1 day')::date") + ` AS monthly_equivalent
+            FROM active a
+            WHERE a.start_date <= (w.month + interval '1 month - 1 day')::date
+              AND (a.end_date IS NULL OR a.end_date >= w.month::date)
+              AND NOT ` + pausedThrough("w.month::date", "(w.month + interval '1 month - 1 day')::date") + `
+        ) AS m ON true
+        GROUP BY w.month
+        ORDER BY w.month
+    `
+
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		slog.Error("Failed to calculate monthly spent",
+			"from", filter.From, "to", filter.To, "user_id", filter.UserID, "service_name", filter.ServiceName, "error", err)
+		return nil, fmt.Errorf("failed to calculate monthly spent: %w", err)
+	}
+	defer rows.Close()
+
+	months := make([]models.MonthlySpent, 0)
+	for rows.Next() {
+		var (
+			item  models.MonthlySpent
+			month time.Time
+		)
+		if err := rows.Scan(&month, &item.Total, &item.ActiveSubscriptions, &item.MonthlyEquivalent); err != nil {
+			return nil, fmt.Errorf("failed to scan monthly spent: %w", err)
+		}
+		item.Month = models.MonthYear(month)
+		months = append(months, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	slog.Info("Calculated monthly spent",
+		"from", filter.From, "to", filter.To, "user_id", filter.UserID, "service_name", filter.ServiceName, "months", len(months))
+	return months, nil
+}
+
+// groupByColumns сопоставляет измерениям группировки выражения над CTE
+// active и присоединенными к ней тегами t: значение группы, ключ
+// группировки и ключ сортировки. Названия сравниваются побайтово, как в
+// хранилище в памяти. Теги разных пользователей с одним ключом - одна
+// группа под наименьшим из их написаний
+var groupByColumns = map[string]struct{ value, key, order string }{
+	models.GroupByServiceName: {"a.service_name", "a.service_name", `a.service_name COLLATE "C"`},
+	models.GroupByUserID:      {"a.user_id", "a.user_id", "a.user_id"},
+	models.GroupByTag:         {`MIN(t.name COLLATE "C")`, "t.name_key", `MIN(t.name COLLATE "C")`},
+}
+
+// tagsJoin присоединяет к подпискам active их теги: подписка с несколькими
+// тегами дает по строке на тег, без тегов - одну строку с NULL
+const tagsJoin = `
+        LEFT JOIN subscription_tags st ON st.subscription_id = a.id
+        LEFT JOIN tags t ON t.id = st.tag_id`
+
+// GetSpentBreakdown возвращает списания и приведенные к месяцу цены на конец
+// окна для подписок, активных в окне, сгруппированные по указанным
+// измерениям, отсортированные по убыванию суммы и ограниченные limit группами.
+// При группировке по тегу подписка учитывается в группе каждого своего тега
+func (r *SubscriptionRepository) GetSpentBreakdown(
+	ctx context.Context,
+	filter models.SpendFilter,
+	groupBy []string,
+	limit int,
+) ([]models.SpentGroup, error) {
+	values := make([]string, 0, len(groupBy))
+	keys := make([]string, 0, len(groupBy))
+	orders := make([]string, 0, len(groupBy))
+	joins := ""
+	for _, dimension := range groupBy {
+		column, ok := groupByColumns[dimension]
+		if !ok {
+			return nil, fmt.Errorf("%w: unsupported group_by dimension: %s", models.ErrValidation, dimension)
+		}
+		values = append(values, column.value)
+		keys = append(keys, column.key)
+		orders = append(orders, column.order)
+		if dimension == models.GroupByTag {
+			joins = tagsJoin
+		}
+	}
+
+	cte, args := spendQuery(filter)
+	query := cte + fmt.Sprintf(`
+        SELECT %s, COALESCE(SUM(c.total), 0), COUNT(*), SUM(e.monthly_equivalent)
+        FROM active a
+        CROSS JOIN LATERAL (
+            SELECT `+monthlyEquivalent("$2::date")+` AS monthly_equivalent
+        ) AS e
+        LEFT JOIN (
+            SELECT subscription_id, SUM(amount) AS total
+            FROM charges
+            GROUP BY subscription_id
+        ) AS c ON c.subscription_id = a.id%s
+        GROUP BY %s
+        ORDER BY COALESCE(SUM(c.total), 0) DESC, %s
+        LIMIT $%d
+    `, strings.Join(values, ", "), joins, strings.Join(keys, ", "), strings.Join(orders, ", "), len(args)+1)
+	args = append(args, limit)
+
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		slog.Error("Failed to calculate spent breakdown",
+			"from", filter.From, "to", filter.To, "group_by", groupBy, "error", err)
+		return nil, fmt.Errorf("failed to calculate spent breakdown: %w", err)
+	}
+	defer rows.Close()
+
+	groups := make([]models.SpentGroup, 0)
+	for rows.Next() {
+		var group models.SpentGroup
+
+		dest := make([]interface{}, 0, len(groupBy)+3)
+		for _, dimension := range groupBy {
+			switch dimension {
+			case models.GroupByServiceName:
+				dest = append(dest, &group.ServiceName)
+			case models.GroupByUserID:
+				dest = append(dest, &group.UserID)
+			case models.GroupByTag:
+				dest = append(dest, &group.Tag)
+			}
+		}
+		dest = append(dest, &group.Total, &group.Subscriptions, &group.MonthlyEquivalent)
+
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("failed to scan spent group: %w", err)
+		}
+		groups = append(groups, group)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	slog.Info("Calculated spent breakdown",
+		"from", filter.From, "to", filter.To, "group_by", groupBy, "groups", len(groups))
+	return groups, nil
+}
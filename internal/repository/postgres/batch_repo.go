@@ -0,0 +1,106 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/NKV510/subscription-service/internal/models"
+	"github.com/NKV510/subscription-service/internal/reqctx"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// CreateBatch добавляет подписки, привязанные к сервисам каталога по
+// названию, одной транзакцией через COPY вместе с событиями создания в
+// журнале изменений. COPY не возвращает значения колонок, поэтому
+// идентификаторы и служебные поля заполняются здесь
+func (r *SubscriptionRepository) CreateBatch(ctx context.Context, subs []*models.Subscription) error {
+	now := time.Now().UTC()
+	for _, sub := range subs {
+		sub.ID = uuid.New()
+		sub.Version = 1
+		sub.CreatedAt = now
+		sub.UpdatedAt = now
+	}
+
+	err := r.withTx(ctx, func(tx pgx.Tx) error {
+		if err := resolveServices(ctx, tx, subs...); err != nil {
+			return err
+		}
+
+		_, err := tx.CopyFrom(
+			ctx,
+			pgx.Identifier{"subscriptions"},
+			[]string{
+				"id", "service_name", "service_id", "price", "currency", "user_id", "start_date", "end_date",
+				"billing_period", "billing_interval_months", "trial_months", "intro_price", "intro_months",
+				"version", "created_at", "updated_at",
+			},
+			pgx.CopyFromSlice(len(subs), func(i int) ([]any, error) {
+				sub := subs[i]
+				return []any{
+					sub.ID,
+					sub.ServiceName,
+					sub.ServiceID,
+					sub.Price,
+					sub.Currency,
+					sub.UserID,
+					sub.StartDate,
+					sub.EndDate,
+					sub.BillingPeriod,
+					sub.BillingIntervalMonths,
+					sub.TrialMonths,
+					sub.IntroPrice,
+					sub.IntroMonths,
+					sub.Version,
+					sub.CreatedAt,
+					sub.UpdatedAt,
+				}, nil
+			}),
+		)
+		if err != nil {
+			return wrapError(err, "failed to copy subscriptions")
+		}
+
+		return copyCreatedEvents(ctx, tx, subs)
+	})
+	if err != nil {
+		slog.Error("Failed to create subscriptions batch", "count", len(subs), "error", err)
+		return err
+	}
+
+	slog.Info("Subscriptions batch created successfully", "count", len(subs))
+	return nil
+}
+
+// copyCreatedEvents записывает через COPY события создания подписок
+func copyCreatedEvents(ctx context.Context, tx pgx.Tx, subs []*models.Subscription) error {
+	actor := nullIfEmpty(reqctx.Actor(ctx))
+	requestID := nullIfEmpty(reqctx.RequestID(ctx))
+
+	_, err := tx.CopyFrom(
+		ctx,
+		pgx.Identifier{"subscription_events"},
+		[]string{"subscription_id", "event_type", "new_values", "actor", "request_id"},
+		pgx.CopyFromSlice(len(subs), func(i int) ([]any, error) {
+			newValues, err := marshalSnapshot(subs[i])
+			if err != nil {
+				return nil, err
+			}
+			return []any{subs[i].ID, models.EventCreated, newValues, actor, requestID}, nil
+		}),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to write subscription events: %w", err)
+	}
+	return nil
+}
+
+func nullIfEmpty(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return &value
+}
@@ -0,0 +1,135 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/NKV510/subscription-service/internal/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Cancel завершает неудаленную подписку последним днем
+// cancellation.EffectiveMonth, сохраняет причину отмены (заменяя прежнюю),
+// увеличивает версию и записывает событие в журнал изменений
+func (r *SubscriptionRepository) Cancel(
+	ctx context.Context,
+	id uuid.UUID,
+	cancellation models.Cancellation,
+	expectedVersion *int,
+) (*models.Subscription, error) {
+	updateQuery := `
+        UPDATE subscriptions
+        SET end_date = $2, version = version + 1, updated_at = now()
+        WHERE id = $1
+        RETURNING ` + subscriptionColumns
+
+	upsertQuery := `
+        INSERT INTO subscription_cancellations (subscription_id, effective_month, reason_code, reason_text)
+        VALUES ($1, $2, $3, $4)
+        ON CONFLICT (subscription_id)
+        DO UPDATE SET effective_month = EXCLUDED.effective_month,
+                      reason_code = EXCLUDED.reason_code,
+                      reason_text = EXCLUDED.reason_text,
+                      created_at = now()
+    `
+
+	endDate := cancellation.EffectiveMonth.AddDate(0, 1, -1)
+
+	var cancelled *models.Subscription
+	err := r.withTx(ctx, func(tx pgx.Tx) error {
+		old, err := lockSubscription(ctx, tx, id, expectedVersion)
+		if err != nil {
+			return err
+		}
+
+		cancelled, err = scanSubscription(tx.QueryRow(ctx, updateQuery, id, endDate))
+		if err != nil {
+			return wrapError(err, "failed to cancel subscription")
+		}
+
+		_, err = tx.Exec(ctx, upsertQuery, id, cancellation.EffectiveMonth, cancellation.ReasonCode, cancellation.ReasonText)
+		if err != nil {
+			return wrapError(err, "failed to save cancellation")
+		}
+
+		return insertEvent(ctx, tx, id, models.EventCancelled, old, cancelled)
+	})
+	if err != nil {
+		slog.Error("Failed to cancel subscription", "id", id, "error", err)
+		return nil, err
+	}
+
+	slog.Info("Subscription cancelled", "id", id, "end_date", endDate, "reason_code", cancellation.ReasonCode)
+	return cancelled, nil
+}
+
+// deleteStaleCancellation удаляет отмену подписки, если ее end_date больше
+// не приходится на месяц отмены, например подписку продлили
+func deleteStaleCancellation(ctx context.Context, q querier, sub *models.Subscription) error {
+	query := `
+        DELETE FROM subscription_cancellations
+        WHERE subscription_id = $1
+          AND ($2::date IS NULL OR effective_month <> date_trunc('month', $2::date)::date)
+    `
+
+	if _, err := q.Exec(ctx, query, sub.ID, sub.EndDate); err != nil {
+		return fmt.Errorf("failed to delete cancellation: %w", err)
+	}
+	return nil
+}
+
+// GetCancellations возвращает число отмен неудаленных подписок по месяцам
+// отмены из окна [from, to], сервисам и причинам
+func (r *SubscriptionRepository) GetCancellations(
+	ctx context.Context,
+	filter models.SpendFilter,
+) ([]models.CancellationCount, error) {
+	var conditions string
+	args := []interface{}{filter.From, filter.To}
+	argIndex := 3
+
+	if filter.UserID != nil {
+		conditions += fmt.Sprintf(" AND s.user_id = $%d", argIndex)
+		args = append(args, *filter.UserID)
+		argIndex++
+	}
+
+	if filter.ServiceName != nil {
+		conditions += fmt.Sprintf(" AND s.service_name = $%d", argIndex)
+		args = append(args, *filter.ServiceName)
+	}
+
+	query := `
+        SELECT c.effective_month, s.service_name, c.reason_code, COUNT(*)
+        FROM subscription_cancellations c
+        JOIN subscriptions s ON s.id = c.subscription_id
+        WHERE s.deleted_at IS NULL
+          AND c.effective_month BETWEEN date_trunc('month', $1::date)::date AND $2::date` + conditions + `
+        GROUP BY c.effective_month, s.service_name, c.reason_code
+        ORDER BY c.effective_month, s.service_name COLLATE "C", c.reason_code
+    `
+
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		slog.Error("Failed to get cancellations", "from", filter.From, "to", filter.To, "error", err)
+		return nil, fmt.Errorf("failed to get cancellations: %w", err)
+	}
+	defer rows.Close()
+
+	var counts []models.CancellationCount
+	for rows.Next() {
+		var count models.CancellationCount
+		if err := rows.Scan(&count.Month, &count.ServiceName, &count.ReasonCode, &count.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan cancellations: %w", err)
+		}
+		counts = append(counts, count)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return counts, nil
+}
@@ -0,0 +1,57 @@
+package postgres
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/NKV510/subscription-service/internal/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Коды ошибок postgres, которые сопоставляются доменным ошибкам
+const (
+	uniqueViolationCode     = "23505"
+	foreignKeyViolationCode = "23503"
+	checkViolationCode      = "23514"
+)
+
+// constraintFields поля запроса, к которым относятся ограничения таблиц,
+// чтобы нарушение ограничения возвращалось как ошибка конкретного поля
+var constraintFields = map[string]struct{ name, message string }{
+	"subscriptions_price_check":                    {"price", "must not be negative"},
+	"subscriptions_end_date_check":                 {"end_date", "must not be before start_date"},
+	"subscriptions_currency_check":                 {"currency", "must be an ISO 4217 code"},
+	"subscriptions_billing_period_check":           {"billing_period", "unsupported billing period"},
+	"subscriptions_billing_interval_months_check":  {"billing_interval_months", "must be set from 1 to 120 for custom billing period only"},
+	"subscriptions_trial_months_check":             {"trial_months", "must be from 1 to 24"},
+	"subscriptions_intro_price_check":              {"intro_price", "must be set with intro_months and not negative"},
+	"subscriptions_intro_months_check":             {"intro_months", "must be from 1 to 24"},
+	"subscriptions_service_id_fkey":                {"service_name", "service is not in the catalog"},
+	"services_default_price_check":                 {"default_price", "must be at least 1"},
+	"subscription_pauses_resumed_from_check":       {"from", "must be after the pause start"},
+	"subscription_cancellations_reason_code_check": {"reason_code", "unsupported cancellation reason"},
+}
+
+// wrapError оборачивает ошибку драйвера в доменную ошибку из models,
+// сохраняя исходную ошибку в цепочке
+func wrapError(err error, msg string) error {
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("%w: %s", models.ErrNotFound, msg)
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case uniqueViolationCode:
+			return fmt.Errorf("%w: %s: %s", models.ErrConflict, msg, pgErr.Detail)
+		case foreignKeyViolationCode, checkViolationCode:
+			if field, ok := constraintFields[pgErr.ConstraintName]; ok {
+				return fmt.Errorf("%s: %w", msg, models.NewValidationError(field.name, field.message))
+			}
+			return fmt.Errorf("%w: %s: %s", models.ErrValidation, msg, pgErr.Message)
+		}
+	}
+
+	return fmt.Errorf("%s: %w", msg, err)
+}
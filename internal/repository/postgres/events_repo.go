@@ -0,0 +1,135 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+
+	"github.com/NKV510/subscription-service/internal/models"
+	"github.com/NKV510/subscription-service/internal/reqctx"
+	"github.com/google/uuid"
+)
+
+// insertEvent записывает событие журнала изменений. Инициатор и
+// идентификатор запроса берутся из контекста
+func insertEvent(
+	ctx context.Context,
+	q querier,
+	subscriptionID uuid.UUID,
+	eventType string,
+	oldValues *models.Subscription,
+	newValues *models.Subscription,
+) error {
+	oldJSON, err := marshalSnapshot(oldValues)
+	if err != nil {
+		return err
+	}
+	newJSON, err := marshalSnapshot(newValues)
+	if err != nil {
+		return err
+	}
+
+	query := `
+        INSERT INTO subscription_events (subscription_id, event_type, old_values, new_values, actor, request_id)
+        VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, ''))
+    `
+
+	_, err = q.Exec(ctx, query,
+		subscriptionID,
+		eventType,
+		oldJSON,
+		newJSON,
+		reqctx.Actor(ctx),
+		reqctx.RequestID(ctx),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to write subscription event: %w", err)
+	}
+	return nil
+}
+
+// marshalSnapshot сериализует состояние подписки для журнала; nil - NULL
+func marshalSnapshot(sub *models.Subscription) ([]byte, error) {
+	if sub == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(sub)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode subscription snapshot: %w", err)
+	}
+	return data, nil
+}
+
+// GetHistory возвращает журнал изменений подписки в хронологическом порядке.
+// История удаленной подписки сохраняется
+func (r *SubscriptionRepository) GetHistory(ctx context.Context, id uuid.UUID) ([]models.SubscriptionEvent, error) {
+	query := `
+        SELECT id, subscription_id, event_type, old_values, new_values,
+               COALESCE(actor, ''), COALESCE(request_id, ''), created_at
+        FROM subscription_events
+        WHERE subscription_id = $1
+        ORDER BY id
+    `
+
+	rows, err := r.pool.Query(ctx, query, id)
+	if err != nil {
+		slog.Error("Failed to get subscription history", "id", id, "error", err)
+		return nil, fmt.Errorf("failed to get subscription history: %w", err)
+	}
+	defer rows.Close()
+
+	events := make([]models.SubscriptionEvent, 0)
+	for rows.Next() {
+		var (
+			event     models.SubscriptionEvent
+			oldValues []byte
+			newValues []byte
+		)
+		err := rows.Scan(
+			&event.ID,
+			&event.SubscriptionID,
+			&event.EventType,
+			&oldValues,
+			&newValues,
+			&event.Actor,
+			&event.RequestID,
+			&event.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan subscription event: %w", err)
+		}
+
+		if event.OldValues, err = unmarshalSnapshot(oldValues); err != nil {
+			return nil, err
+		}
+		if event.NewValues, err = unmarshalSnapshot(newValues); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	// Подписки, созданные до появления журнала, не имеют событий
+	if len(events) == 0 {
+		if _, err := r.GetByID(ctx, id); err != nil {
+			return nil, err
+		}
+	}
+
+	return events, nil
+}
+
+func unmarshalSnapshot(data []byte) (*models.Subscription, error) {
+	if data == nil {
+		return nil, nil
+	}
+	var sub models.Subscription
+	if err := json.Unmarshal(data, &sub); err != nil {
+		return nil, fmt.Errorf("failed to decode subscription snapshot: %w", err)
+	}
+	return &sub, nil
+}
@@ -0,0 +1,72 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/NKV510/subscription-service/internal/models"
+)
+
+// UpsertExchangeRates добавляет курсы одним запросом; курс той же пары на
+// ту же дату заменяется. Повторяющихся ключей в rates быть не должно
+func (r *SubscriptionRepository) UpsertExchangeRates(ctx context.Context, rates []models.ExchangeRate) error {
+	query := `
+        INSERT INTO exchange_rates (date, from_currency, to_currency, rate)
+        SELECT * FROM unnest($1::date[], $2::char(3)[], $3::char(3)[], $4::numeric[])
+        ON CONFLICT (from_currency, to_currency, date) DO UPDATE SET rate = EXCLUDED.rate
+    `
+
+	dates := make([]time.Time, len(rates))
+	from := make([]string, len(rates))
+	to := make([]string, len(rates))
+	values := make([]float64, len(rates))
+	for i, rate := range rates {
+		dates[i], from[i], to[i], values[i] = rate.Date, rate.From, rate.To, rate.Rate
+	}
+
+	if _, err := r.pool.Exec(ctx, query, dates, from, to, values); err != nil {
+		slog.Error("Failed to save exchange rates", "count", len(rates), "error", err)
+		return wrapError(err, "failed to save exchange rates")
+	}
+
+	slog.Info("Exchange rates saved", "count", len(rates))
+	return nil
+}
+
+// ListExchangeRates возвращает курсы, отсортированные по паре и дате
+func (r *SubscriptionRepository) ListExchangeRates(
+	ctx context.Context,
+	filter models.ExchangeRateFilter,
+) ([]models.ExchangeRate, error) {
+	query := `
+        SELECT date, from_currency, to_currency, rate
+        FROM exchange_rates
+        WHERE ($1::char(3) IS NULL OR from_currency = $1)
+          AND ($2::char(3) IS NULL OR to_currency = $2)
+        ORDER BY from_currency, to_currency, date
+    `
+
+	rows, err := r.pool.Query(ctx, query, filter.From, filter.To)
+	if err != nil {
+		slog.Error("Failed to list exchange rates", "error", err)
+		return nil, fmt.Errorf("failed to list exchange rates: %w", err)
+	}
+	defer rows.Close()
+
+	rates := make([]models.ExchangeRate, 0)
+	for rows.Next() {
+		var rate models.ExchangeRate
+		if err := rows.Scan(&rate.Date, &rate.From, &rate.To, &rate.Rate); err != nil {
+			return nil, fmt.Errorf("failed to scan exchange rate: %w", err)
+		}
+		rates = append(rates, rate)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return rates, nil
+}
@@ -0,0 +1,65 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/NKV510/subscription-service/internal/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// exportFetchSize сколько строк читается из курсора за один FETCH
+const exportFetchSize = 1000
+
+// Export передает в fn все подписки, удовлетворяющие фильтру, в порядке
+// (SortBy, id). Строки читаются серверным курсором порциями по
+// exportFetchSize, поэтому выгрузка не держит весь результат в памяти.
+// filter.Limit не используется. Ошибка fn прерывает выгрузку
+func (r *SubscriptionRepository) Export(
+	ctx context.Context,
+	filter models.SubscriptionFilter,
+	fn func(sub *models.Subscription) error,
+) error {
+	query, args, err := listQuery(filter)
+	if err != nil {
+		return err
+	}
+
+	var exported int
+	err = r.withTx(ctx, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, "DECLARE export_cursor NO SCROLL CURSOR FOR "+query, args...); err != nil {
+			return fmt.Errorf("failed to declare export cursor: %w", err)
+		}
+
+		fetch := fmt.Sprintf("FETCH FORWARD %d FROM export_cursor", exportFetchSize)
+		for {
+			rows, err := tx.Query(ctx, fetch)
+			if err != nil {
+				return fmt.Errorf("failed to fetch subscriptions: %w", err)
+			}
+			subscriptions, err := scanSubscriptions(rows)
+			if err != nil {
+				return err
+			}
+
+			for _, sub := range subscriptions {
+				if err := fn(sub); err != nil {
+					return err
+				}
+			}
+			exported += len(subscriptions)
+
+			if len(subscriptions) < exportFetchSize {
+				return nil
+			}
+		}
+	})
+	if err != nil {
+		slog.Error("Failed to export subscriptions", "exported", exported, "error", err)
+		return err
+	}
+
+	slog.Info("Exported subscriptions", "count", exported)
+	return nil
+}
@@ -0,0 +1,139 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/NKV510/subscription-service/internal/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// CreateIdempotent создает подписку и сохраняет ее под ключом
+// идемпотентности в одной транзакции. Если ключ уже использован и не истек,
+// подписка не создается и возвращается сохраненный ответ. Запросы с одним
+// ключом выполняются по очереди под advisory lock транзакции
+func (r *SubscriptionRepository) CreateIdempotent(
+	ctx context.Context,
+	sub *models.Subscription,
+	key models.IdempotencyKey,
+) (*models.StoredResponse, error) {
+	var stored *models.StoredResponse
+
+	err := r.withTx(ctx, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtextextended($1, 0))`, key.Key); err != nil {
+			return fmt.Errorf("failed to lock idempotency key: %w", err)
+		}
+
+		var (
+			requestHash string
+			body        []byte
+		)
+		err := tx.QueryRow(ctx, `
+            SELECT request_hash, response_body
+            FROM idempotency_keys
+            WHERE key = $1 AND expires_at > now()
+        `, key.Key).Scan(&requestHash, &body)
+
+		if err == nil {
+			var response models.Subscription
+			if err := json.Unmarshal(body, &response); err != nil {
+				return fmt.Errorf("failed to decode stored response: %w", err)
+			}
+			stored = &models.StoredResponse{RequestHash: requestHash, Subscription: &response}
+			return nil
+		}
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("failed to get idempotency key: %w", err)
+		}
+
+		if err := resolveServices(ctx, tx, sub); err != nil {
+			return err
+		}
+		if err := insertSubscription(ctx, tx, sub); err != nil {
+			return wrapError(err, "failed to create subscription")
+		}
+		if err := insertEvent(ctx, tx, sub.ID, models.EventCreated, nil, sub); err != nil {
+			return err
+		}
+
+		body, err = json.Marshal(sub)
+		if err != nil {
+			return fmt.Errorf("failed to encode response: %w", err)
+		}
+
+		// Истекшая запись с тем же ключом перезаписывается
+		_, err = tx.Exec(ctx, `
+            INSERT INTO idempotency_keys (key, request_hash, response_body, expires_at)
+            VALUES ($1, $2, $3, $4)
+            ON CONFLICT (key) DO UPDATE
+            SET request_hash = EXCLUDED.request_hash,
+                response_body = EXCLUDED.response_body,
+                created_at = now(),
+                expires_at = EXCLUDED.expires_at
+        `, key.Key, key.RequestHash, body, key.ExpiresAt)
+		if err != nil {
+			return fmt.Errorf("failed to store idempotency key: %w", err)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		slog.Error("Failed to create subscription with idempotency key", "key", key.Key, "error", err)
+		return nil, err
+	}
+
+	if stored != nil {
+		slog.Info("Idempotency key already used", "key", key.Key, "id", stored.Subscription.ID)
+		return stored, nil
+	}
+
+	slog.Info("Subscription created successfully", "id", sub.ID, "idempotency_key", key.Key)
+	return nil, nil
+}
+
+// GetIdempotentResponse возвращает сохраненный ответ для неистекшего ключа
+// идемпотентности; nil, если ключ не использован или истек
+func (r *SubscriptionRepository) GetIdempotentResponse(ctx context.Context, key string) (*models.StoredResponse, error) {
+	query := `
+        SELECT request_hash, response_body
+        FROM idempotency_keys
+        WHERE key = $1 AND expires_at > now()
+    `
+
+	var (
+		requestHash string
+		body        []byte
+	)
+	err := r.pool.QueryRow(ctx, query, key).Scan(&requestHash, &body)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		slog.Error("Failed to get idempotency key", "key", key, "error", err)
+		return nil, fmt.Errorf("failed to get idempotency key: %w", err)
+	}
+
+	var response models.Subscription
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("failed to decode stored response: %w", err)
+	}
+	return &models.StoredResponse{RequestHash: requestHash, Subscription: &response}, nil
+}
+
+// PurgeIdempotencyKeys удаляет ключи идемпотентности, истекшие не позже
+// expiredBefore, и возвращает их количество
+func (r *SubscriptionRepository) PurgeIdempotencyKeys(ctx context.Context, expiredBefore time.Time) (int64, error) {
+	tag, err := r.pool.Exec(ctx, `DELETE FROM idempotency_keys WHERE expires_at <= $1`, expiredBefore)
+	if err != nil {
+		slog.Error("Failed to purge expired idempotency keys", "error", err)
+		return 0, fmt.Errorf("failed to purge expired idempotency keys: %w", err)
+	}
+
+	slog.Info("Purged expired idempotency keys", "count", tag.RowsAffected(), "expired_before", expiredBefore)
+	return tag.RowsAffected(), nil
+}
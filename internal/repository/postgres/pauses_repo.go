@@ -0,0 +1,116 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/NKV510/subscription-service/internal/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Pause приостанавливает неудаленную подписку с даты from, увеличивает
+// версию и записывает событие в журнал изменений. Если подписка уже
+// приостановлена, возвращает models.ErrConflict; приостановка не может
+// начинаться раньше окончания предыдущей
+func (r *SubscriptionRepository) Pause(
+	ctx context.Context,
+	id uuid.UUID,
+	from time.Time,
+	expectedVersion *int,
+) (*models.Subscription, error) {
+	query := `
+        INSERT INTO subscription_pauses (subscription_id, paused_from)
+        VALUES ($1, $2)
+    `
+
+	var paused *models.Subscription
+	err := r.withTx(ctx, func(tx pgx.Tx) error {
+		old, err := lockSubscription(ctx, tx, id, expectedVersion)
+		if err != nil {
+			return err
+		}
+		if err := old.CheckPause(from); err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(ctx, query, id, from); err != nil {
+			return wrapError(err, "failed to pause subscription")
+		}
+
+		paused, err = touchSubscription(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		return insertEvent(ctx, tx, id, models.EventPaused, old, paused)
+	})
+	if err != nil {
+		slog.Error("Failed to pause subscription", "id", id, "error", err)
+		return nil, err
+	}
+
+	slog.Info("Subscription paused", "id", id, "from", from)
+	return paused, nil
+}
+
+// Resume завершает бессрочную приостановку подписки датой from,
+// увеличивает версию и записывает событие в журнал изменений. Если подписка
+// не приостановлена, возвращает models.ErrConflict
+func (r *SubscriptionRepository) Resume(
+	ctx context.Context,
+	id uuid.UUID,
+	from time.Time,
+	expectedVersion *int,
+) (*models.Subscription, error) {
+	query := `
+        UPDATE subscription_pauses
+        SET resumed_from = $2
+        WHERE subscription_id = $1 AND resumed_from IS NULL
+    `
+
+	var resumed *models.Subscription
+	err := r.withTx(ctx, func(tx pgx.Tx) error {
+		old, err := lockSubscription(ctx, tx, id, expectedVersion)
+		if err != nil {
+			return err
+		}
+		if err := old.CheckResume(from); err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(ctx, query, id, from); err != nil {
+			return wrapError(err, "failed to resume subscription")
+		}
+
+		resumed, err = touchSubscription(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		return insertEvent(ctx, tx, id, models.EventResumed, old, resumed)
+	})
+	if err != nil {
+		slog.Error("Failed to resume subscription", "id", id, "error", err)
+		return nil, err
+	}
+
+	slog.Info("Subscription resumed", "id", id, "from", from)
+	return resumed, nil
+}
+
+// touchSubscription увеличивает версию подписки после изменения ее
+// приостановок и возвращает ее новое состояние
+func touchSubscription(ctx context.Context, tx pgx.Tx, id uuid.UUID) (*models.Subscription, error) {
+	query := `
+        UPDATE subscriptions
+        SET version = version + 1, updated_at = now()
+        WHERE id = $1
+        RETURNING ` + subscriptionColumns
+
+	sub, err := scanSubscription(tx.QueryRow(ctx, query, id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to update subscription version: %w", err)
+	}
+	return sub, nil
+}
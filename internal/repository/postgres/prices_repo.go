@@ -0,0 +1,100 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/NKV510/subscription-service/internal/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// SchedulePriceChange сохраняет изменение цены неудаленной подписки,
+// увеличивает версию и записывает событие в журнал изменений; изменение с
+// той же даты заменяется
+func (r *SubscriptionRepository) SchedulePriceChange(
+	ctx context.Context,
+	id uuid.UUID,
+	change models.PriceChange,
+	expectedVersion *int,
+) (*models.Subscription, error) {
+	query := `
+        INSERT INTO subscription_prices (subscription_id, effective_from, price)
+        VALUES ($1, $2, $3)
+        ON CONFLICT (subscription_id, effective_from)
+        DO UPDATE SET price = EXCLUDED.price, created_at = now()
+    `
+
+	var repriced *models.Subscription
+	err := r.withTx(ctx, func(tx pgx.Tx) error {
+		old, err := lockSubscription(ctx, tx, id, expectedVersion)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, query, id, change.EffectiveFrom, change.Price); err != nil {
+			return wrapError(err, "failed to schedule price change")
+		}
+
+		repriced, err = touchSubscription(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		return insertEvent(ctx, tx, id, models.EventRepriced, old, repriced)
+	})
+	if err != nil {
+		slog.Error("Failed to schedule price change", "id", id, "error", err)
+		return nil, err
+	}
+
+	slog.Info("Price change scheduled", "id", id, "effective_from", change.EffectiveFrom, "price", change.Price)
+	return repriced, nil
+}
+
+// GetPriceChanges возвращает изменения цены неудаленной подписки в порядке
+// вступления в силу
+func (r *SubscriptionRepository) GetPriceChanges(ctx context.Context, id uuid.UUID) ([]models.PriceChange, error) {
+	query := `
+        SELECT p.effective_from, p.price
+        FROM subscriptions s
+        LEFT JOIN subscription_prices p ON p.subscription_id = s.id
+        WHERE s.id = $1 AND s.deleted_at IS NULL
+        ORDER BY p.effective_from
+    `
+
+	rows, err := r.pool.Query(ctx, query, id)
+	if err != nil {
+		slog.Error("Failed to get price changes", "id", id, "error", err)
+		return nil, fmt.Errorf("failed to get price changes: %w", err)
+	}
+	defer rows.Close()
+
+	// Для подписки без изменений цены LEFT JOIN возвращает одну строку с NULL
+	var (
+		changes []models.PriceChange
+		found   bool
+	)
+	for rows.Next() {
+		var (
+			effectiveFrom *time.Time
+			price         *int
+		)
+		if err := rows.Scan(&effectiveFrom, &price); err != nil {
+			return nil, fmt.Errorf("failed to scan price change: %w", err)
+		}
+		found = true
+		if effectiveFrom != nil {
+			changes = append(changes, models.PriceChange{EffectiveFrom: *effectiveFrom, Price: *price})
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+	if !found {
+		return nil, fmt.Errorf("%w: subscription %s", models.ErrNotFound, id)
+	}
+
+	return changes, nil
+}
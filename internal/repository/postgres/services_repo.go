@@ -0,0 +1,298 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/NKV510/subscription-service/internal/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// serviceColumns колонки сервиса каталога в порядке, который ожидает
+// scanService; псевдонимы - написания, кроме канонического
+const serviceColumns = "s.id, s.name, s.default_price, s.created_at, s.updated_at, " +
+	"ARRAY(SELECT n.name FROM service_names n WHERE n.service_id = s.id AND n.name <> s.name ORDER BY n.name COLLATE \"C\")"
+
+// serviceNameKey выражение ключа названия сервиса в колонке column, как
+// models.ServiceNameKey
+func serviceNameKey(column string) string {
+	return `lower(regexp_replace(btrim(` + column + `), '\s+', ' ', 'g'))`
+}
+
+// CreateService добавляет сервис в каталог вместе с его написаниями и
+// привязывает к нему подписки без сервиса с одним из этих написаний,
+// увеличивая их версию. Написание, которое уже принадлежит другому сервису, - models.ErrConflict
+func (r *SubscriptionRepository) CreateService(ctx context.Context, svc *models.Service) error {
+	query := `
+        INSERT INTO services (name, default_price)
+        VALUES ($1, $2)
+        RETURNING id, created_at, updated_at
+    `
+
+	err := r.withTx(ctx, func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx, query, svc.Name, svc.DefaultPrice).Scan(&svc.ID, &svc.CreatedAt, &svc.UpdatedAt)
+		if err != nil {
+			return wrapError(err, "failed to create service")
+		}
+		return saveServiceNames(ctx, tx, svc)
+	})
+	if err != nil {
+		slog.Error("Failed to create service", "name", svc.Name, "error", err)
+		return err
+	}
+
+	slog.Info("Service created successfully", "id", svc.ID, "name", svc.Name)
+	return nil
+}
+
+// UpdateService заменяет название, псевдонимы и цену по умолчанию сервиса.
+// Подписки сервиса получают новое каноническое название, подписки без
+// сервиса с одним из новых написаний привязываются к нему; версия каждой
+// измененной подписки увеличивается, изменение пишется в журнал
+func (r *SubscriptionRepository) UpdateService(ctx context.Context, svc *models.Service) error {
+	query := `
+        UPDATE services
+        SET name = $1, default_price = $2, updated_at = now()
+        WHERE id = $3
+        RETURNING created_at, updated_at
+    `
+	err := r.withTx(ctx, func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx, query, svc.Name, svc.DefaultPrice, svc.ID).Scan(&svc.CreatedAt, &svc.UpdatedAt)
+		if err != nil {
+			return wrapError(err, fmt.Sprintf("service %s", svc.ID))
+		}
+		if _, err := tx.Exec(ctx, `DELETE FROM service_names WHERE service_id = $1`, svc.ID); err != nil {
+			return fmt.Errorf("failed to delete service names: %w", err)
+		}
+		if err := saveServiceNames(ctx, tx, svc); err != nil {
+			return err
+		}
+		return relinkSubscriptions(ctx, tx, "service_id = $1 AND service_name <> $2",
+			[]interface{}{svc.ID, svc.Name}, &svc.ID, &svc.Name)
+	})
+	if err != nil {
+		slog.Error("Failed to update service", "id", svc.ID, "error", err)
+		return err
+	}
+
+	slog.Info("Service updated successfully", "id", svc.ID, "name", svc.Name)
+	return nil
+}
+
+// saveServiceNames сохраняет каноническое название и псевдонимы сервиса и
+// привязывает к нему подписки без сервиса с этими написаниями
+func saveServiceNames(ctx context.Context, tx pgx.Tx, svc *models.Service) error {
+	insertQuery := `
+        INSERT INTO service_names (name_key, service_id, name)
+        SELECT * FROM unnest($1::varchar[], $2::uuid[], $3::varchar[])
+    `
+
+	names := append([]string{svc.Name}, svc.Aliases...)
+	keys := make([]string, len(names))
+	ids := make([]uuid.UUID, len(names))
+	for i, name := range names {
+		keys[i], ids[i] = models.ServiceNameKey(name), svc.ID
+	}
+
+	if _, err := tx.Exec(ctx, insertQuery, keys, ids, names); err != nil {
+		return wrapError(err, "service name or alias is already in the catalog")
+	}
+	return relinkSubscriptions(ctx, tx, "service_id IS NULL AND "+serviceNameKey("service_name")+" = ANY($1)",
+		[]interface{}{keys}, &svc.ID, &svc.Name)
+}
+
+// resolveServices привязывает подписки к сервисам каталога с их названием
+// или псевдонимом и приводит название к каноническому. Подписки с названием
+// не из каталога сохраняются без сервиса: каталог пополняется только явно.
+// Найденные сервисы блокируются от изменения до конца транзакции
+func resolveServices(ctx context.Context, tx pgx.Tx, subs ...*models.Subscription) error {
+	query := `
+        SELECT n.name_key, s.id, s.name
+        FROM service_names n
+        JOIN services s ON s.id = n.service_id
+        WHERE n.name_key = ANY($1)
+        FOR SHARE OF s
+    `
+
+	keys := make([]string, len(subs))
+	for i, sub := range subs {
+		keys[i] = models.ServiceNameKey(sub.ServiceName)
+	}
+
+	rows, err := tx.Query(ctx, query, keys)
+	if err != nil {
+		return fmt.Errorf("failed to resolve services: %w", err)
+	}
+	defer rows.Close()
+
+	services := make(map[string]models.Service)
+	for rows.Next() {
+		var (
+			key string
+			svc models.Service
+		)
+		if err := rows.Scan(&key, &svc.ID, &svc.Name); err != nil {
+			return fmt.Errorf("failed to scan service: %w", err)
+		}
+		services[key] = svc
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	for i, sub := range subs {
+		svc, ok := services[keys[i]]
+		if !ok {
+			sub.ServiceID = nil
+			continue
+		}
+		sub.ServiceID = &svc.ID
+		sub.ServiceName = svc.Name
+	}
+	return nil
+}
+
+// relinkSubscriptions привязывает подписки, выбранные условием where с
+// аргументами args, к сервису serviceID (nil - отвязывает) под названием
+// name (nil - название не меняется). Версия каждой подписки, в том числе
+// удаленной, увеличивается, а изменение пишется в журнал
+func relinkSubscriptions(
+	ctx context.Context,
+	tx pgx.Tx,
+	where string,
+	args []interface{},
+	serviceID *uuid.UUID,
+	name *string,
+) error {
+	selectQuery := `
+        SELECT ` + subscriptionColumns + `
+        FROM subscriptions
+        WHERE ` + where + `
+        ORDER BY id
+        FOR UPDATE
+    `
+	updateQuery := `
+        UPDATE subscriptions
+        SET service_id = $2, service_name = COALESCE($3, service_name),
+            version = version + 1, updated_at = now()
+        WHERE id = $1
+        RETURNING ` + subscriptionColumns
+
+	rows, err := tx.Query(ctx, selectQuery, args...)
+	if err != nil {
+		return fmt.Errorf("failed to select subscriptions of service: %w", err)
+	}
+	subscriptions, err := scanSubscriptions(rows)
+	if err != nil {
+		return err
+	}
+
+	for _, old := range subscriptions {
+		relinked, err := scanSubscription(tx.QueryRow(ctx, updateQuery, old.ID, serviceID, name))
+		if err != nil {
+			return fmt.Errorf("failed to update service of subscription: %w", err)
+		}
+		if err := insertEvent(ctx, tx, old.ID, models.EventUpdated, old, relinked); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteService удаляет сервис из каталога; подписки сохраняют название,
+// но теряют привязку к сервису, их версия увеличивается
+func (r *SubscriptionRepository) DeleteService(ctx context.Context, id uuid.UUID) error {
+	err := r.withTx(ctx, func(tx pgx.Tx) error {
+		if err := relinkSubscriptions(ctx, tx, "service_id = $1", []interface{}{id}, nil, nil); err != nil {
+			return err
+		}
+		tag, err := tx.Exec(ctx, `DELETE FROM services WHERE id = $1`, id)
+		if err != nil {
+			return fmt.Errorf("failed to delete service: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			return fmt.Errorf("%w: service %s", models.ErrNotFound, id)
+		}
+		return nil
+	})
+	if err != nil {
+		slog.Error("Failed to delete service", "id", id, "error", err)
+		return err
+	}
+
+	slog.Info("Service deleted successfully", "id", id)
+	return nil
+}
+
+func (r *SubscriptionRepository) GetService(ctx context.Context, id uuid.UUID) (*models.Service, error) {
+	query := `
+        SELECT ` + serviceColumns + `
+        FROM services s
+        WHERE s.id = $1
+    `
+
+	svc, err := scanService(r.pool.QueryRow(ctx, query, id))
+	if err != nil {
+		return nil, wrapError(err, fmt.Sprintf("service %s", id))
+	}
+	return svc, nil
+}
+
+// FindService находит сервис по каноническому названию или псевдониму без
+// учета регистра и лишних пробелов
+func (r *SubscriptionRepository) FindService(ctx context.Context, name string) (*models.Service, error) {
+	query := `
+        SELECT ` + serviceColumns + `
+        FROM services s
+        JOIN service_names sn ON sn.service_id = s.id
+        WHERE sn.name_key = $1
+    `
+
+	svc, err := scanService(r.pool.QueryRow(ctx, query, models.ServiceNameKey(name)))
+	if err != nil {
+		return nil, wrapError(err, fmt.Sprintf("service %q", name))
+	}
+	return svc, nil
+}
+
+// ListServices возвращает каталог сервисов по названию
+func (r *SubscriptionRepository) ListServices(ctx context.Context) ([]models.Service, error) {
+	query := `
+        SELECT ` + serviceColumns + `
+        FROM services s
+        ORDER BY s.name COLLATE "C", s.id
+    `
+
+	rows, err := r.pool.Query(ctx, query)
+	if err != nil {
+		slog.Error("Failed to list services", "error", err)
+		return nil, fmt.Errorf("failed to list services: %w", err)
+	}
+	defer rows.Close()
+
+	services := make([]models.Service, 0)
+	for rows.Next() {
+		svc, err := scanService(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan service: %w", err)
+		}
+		services = append(services, *svc)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return services, nil
+}
+
+func scanService(row pgx.Row) (*models.Service, error) {
+	var svc models.Service
+	err := row.Scan(&svc.ID, &svc.Name, &svc.DefaultPrice, &svc.CreatedAt, &svc.UpdatedAt, &svc.Aliases)
+	if err != nil {
+		return nil, err
+	}
+	return &svc, nil
+}
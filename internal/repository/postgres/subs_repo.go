@@ -4,13 +4,29 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"strings"
 	"time"
 
 	"github.com/NKV510/subscription-service/internal/models"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// subscriptionColumns колонки подписки в порядке, который ожидает
+// scanSubscription; приостановки выбираются двумя массивами по paused_from,
+// теги - массивом названий в порядке байтов, как сортирует Go
+const subscriptionColumns = "id, service_name, service_id, price, currency, user_id, start_date, end_date, " +
+	"billing_period, billing_interval_months, trial_months, intro_price, intro_months, " +
+	"version, created_at, updated_at, deleted_at, " +
+	"ARRAY(SELECT p.paused_from FROM subscription_pauses p " +
+	"WHERE p.subscription_id = subscriptions.id ORDER BY p.paused_from), " +
+	"ARRAY(SELECT p.resumed_from FROM subscription_pauses p " +
+	"WHERE p.subscription_id = subscriptions.id ORDER BY p.paused_from), " +
+	"ARRAY(SELECT t.name FROM subscription_tags st JOIN tags t ON t.id = st.tag_id " +
+	"WHERE st.subscription_id = subscriptions.id ORDER BY t.name COLLATE \"C\")"
+
 type SubscriptionRepository struct {
 	pool *pgxpool.Pool
 }
@@ -19,183 +35,424 @@ func NewSubscriptionRepository(pool *pgxpool.Pool) *SubscriptionRepository {
 	return &SubscriptionRepository{pool: pool}
 }
 
+// Create добавляет подписку, привязанную к сервису каталога по названию, и
+// записывает событие в журнал изменений в одной транзакции
 func (r *SubscriptionRepository) Create(ctx context.Context, sub *models.Subscription) error {
+	err := r.withTx(ctx, func(tx pgx.Tx) error {
+		if err := resolveServices(ctx, tx, sub); err != nil {
+			return err
+		}
+		if err := insertSubscription(ctx, tx, sub); err != nil {
+			return wrapError(err, "failed to create subscription")
+		}
+		return insertEvent(ctx, tx, sub.ID, models.EventCreated, nil, sub)
+	})
+	if err != nil {
+		slog.Error("Failed to create subscription", "error", err)
+		return err
+	}
+
+	slog.Info("Subscription created successfully", "id", sub.ID)
+	return nil
+}
+
+// insertSubscription добавляет подписку и заполняет поля, которые выдает база
+func insertSubscription(ctx context.Context, q querier, sub *models.Subscription) error {
 	query := `
-        INSERT INTO subscriptions (service_name, price, user_id, start_date, end_date)
-        VALUES ($1, $2, $3, $4, $5)
-        RETURNING id, created_at, updated_at
+        INSERT INTO subscriptions (service_name, service_id, price, currency, user_id, start_date, end_date,
+                                   billing_period, billing_interval_months, trial_months, intro_price, intro_months)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+        RETURNING id, version, created_at, updated_at
     `
 
-	err := r.pool.QueryRow(
+	return q.QueryRow(
 		ctx,
 		query,
 		sub.ServiceName,
+		sub.ServiceID,
 		sub.Price,
+		sub.Currency,
 		sub.UserID,
 		sub.StartDate,
 		sub.EndDate,
-	).Scan(&sub.ID)
-
-	if err != nil {
-		slog.Error("Failed to create subscription", "error", err)
-		return fmt.Errorf("failed to create subscription: %w", err)
-	}
-
-	slog.Info("Subscription created successfully", "id", sub.ID)
-	return nil
+		sub.BillingPeriod,
+		sub.BillingIntervalMonths,
+		sub.TrialMonths,
+		sub.IntroPrice,
+		sub.IntroMonths,
+	).Scan(&sub.ID, &sub.Version, &sub.CreatedAt, &sub.UpdatedAt)
 }
 
 func (r *SubscriptionRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Subscription, error) {
 	query := `
-        SELECT id, service_name, price, user_id, start_date, end_date, created_at, updated_at
+        SELECT ` + subscriptionColumns + `
         FROM subscriptions 
-        WHERE id = $1
+        WHERE id = $1 AND deleted_at IS NULL
     `
 
-	var sub models.Subscription
-	err := r.pool.QueryRow(ctx, query, id).Scan(
-		&sub.ID,
-		&sub.ServiceName,
-		&sub.Price,
-		&sub.UserID,
-		&sub.StartDate,
-		&sub.EndDate,
-	)
-
+	sub, err := scanSubscription(r.pool.QueryRow(ctx, query, id))
 	if err != nil {
 		slog.Error("Failed to get subscription by ID", "id", id, "error", err)
-		return nil, fmt.Errorf("subscription not found: %w", err)
+		return nil, wrapError(err, fmt.Sprintf("subscription %s", id))
 	}
 
-	return &sub, nil
+	return sub, nil
 }
 
+// Update сохраняет подписку, если ее версия в базе совпадает с sub.Version,
+// привязывает ее к сервису каталога по названию, увеличивает версию и
+// записывает событие в журнал изменений. Иначе
+// возвращает models.ErrPreconditionFailed. Отмена подписки удаляется, если
+// end_date больше не приходится на месяц отмены
 func (r *SubscriptionRepository) Update(ctx context.Context, sub *models.Subscription) error {
 	query := `
         UPDATE subscriptions 
-        SET service_name = $1, price = $2, start_date = $3, end_date = $4
-        WHERE id = $5
-    `
+        SET service_name = $1, service_id = $2, price = $3, currency = $4, start_date = $5, end_date = $6,
+            billing_period = $7, billing_interval_months = $8,
+            trial_months = $9, intro_price = $10, intro_months = $11,
+            version = version + 1, updated_at = now()
+        WHERE id = $12
+        RETURNING ` + subscriptionColumns
+
+	err := r.withTx(ctx, func(tx pgx.Tx) error {
+		old, err := lockSubscription(ctx, tx, sub.ID, &sub.Version)
+		if err != nil {
+			return err
+		}
+		if err := resolveServices(ctx, tx, sub); err != nil {
+			return err
+		}
 
-	result, err := r.pool.Exec(
-		ctx,
-		query,
-		sub.ServiceName,
-		sub.Price,
-		sub.StartDate,
-		sub.EndDate,
-		sub.ID,
-	)
+		updated, err := scanSubscription(tx.QueryRow(
+			ctx,
+			query,
+			sub.ServiceName,
+			sub.ServiceID,
+			sub.Price,
+			sub.Currency,
+			sub.StartDate,
+			sub.EndDate,
+			sub.BillingPeriod,
+			sub.BillingIntervalMonths,
+			sub.TrialMonths,
+			sub.IntroPrice,
+			sub.IntroMonths,
+			sub.ID,
+		))
+		if err != nil {
+			return wrapError(err, "failed to update subscription")
+		}
+		*sub = *updated
 
+		if err := deleteStaleCancellation(ctx, tx, sub); err != nil {
+			return err
+		}
+		return insertEvent(ctx, tx, sub.ID, models.EventUpdated, old, sub)
+	})
 	if err != nil {
 		slog.Error("Failed to update subscription", "id", sub.ID, "error", err)
-		return fmt.Errorf("failed to update subscription: %w", err)
-	}
-
-	if result.RowsAffected() == 0 {
-		return fmt.Errorf("subscription not found")
+		return err
 	}
 
 	slog.Info("Subscription updated successfully", "id", sub.ID)
 	return nil
 }
 
-// Delete удаляет подписку
-func (r *SubscriptionRepository) Delete(ctx context.Context, id uuid.UUID) error {
-	query := `DELETE FROM subscriptions WHERE id = $1`
+// Delete помечает подписку удаленной и записывает событие в журнал
+// изменений. Если expectedVersion задан, подписка удаляется только при
+// совпадении версии. Удаленную подписку можно восстановить до очистки
+func (r *SubscriptionRepository) Delete(ctx context.Context, id uuid.UUID, expectedVersion *int) error {
+	query := `
+        UPDATE subscriptions
+        SET deleted_at = now(), version = version + 1, updated_at = now()
+        WHERE id = $1
+        RETURNING ` + subscriptionColumns
+
+	err := r.withTx(ctx, func(tx pgx.Tx) error {
+		old, err := lockSubscription(ctx, tx, id, expectedVersion)
+		if err != nil {
+			return err
+		}
 
-	result, err := r.pool.Exec(ctx, query, id)
+		deleted, err := scanSubscription(tx.QueryRow(ctx, query, id))
+		if err != nil {
+			return fmt.Errorf("failed to delete subscription: %w", err)
+		}
+
+		return insertEvent(ctx, tx, id, models.EventDeleted, old, deleted)
+	})
 	if err != nil {
 		slog.Error("Failed to delete subscription", "id", id, "error", err)
-		return fmt.Errorf("failed to delete subscription: %w", err)
-	}
-
-	if result.RowsAffected() == 0 {
-		return fmt.Errorf("subscription not found")
+		return err
 	}
 
 	slog.Info("Subscription deleted successfully", "id", id)
 	return nil
 }
 
-// GetByUserID возвращает все подписки пользователя
-func (r *SubscriptionRepository) GetByUserID(ctx context.Context, userID uuid.UUID) ([]*models.Subscription, error) {
+// Restore снимает с подписки пометку об удалении и записывает событие в
+// журнал изменений. Для неудаленной подписки возвращает models.ErrConflict
+func (r *SubscriptionRepository) Restore(ctx context.Context, id uuid.UUID) (*models.Subscription, error) {
 	query := `
-        SELECT id, service_name, price, user_id, start_date, end_date
-        FROM subscriptions 
-        WHERE user_id = $1
-        ORDER BY start_date DESC
+        UPDATE subscriptions
+        SET deleted_at = NULL, version = version + 1, updated_at = now()
+        WHERE id = $1
+        RETURNING ` + subscriptionColumns
+
+	var restored *models.Subscription
+	err := r.withTx(ctx, func(tx pgx.Tx) error {
+		old, err := selectForUpdate(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if old.DeletedAt == nil {
+			return fmt.Errorf("%w: subscription %s is not deleted", models.ErrConflict, id)
+		}
+
+		restored, err = scanSubscription(tx.QueryRow(ctx, query, id))
+		if err != nil {
+			return fmt.Errorf("failed to restore subscription: %w", err)
+		}
+
+		return insertEvent(ctx, tx, id, models.EventRestored, old, restored)
+	})
+	if err != nil {
+		slog.Error("Failed to restore subscription", "id", id, "error", err)
+		return nil, err
+	}
+
+	slog.Info("Subscription restored successfully", "id", id)
+	return restored, nil
+}
+
+// Purge окончательно удаляет подписки, удаленные раньше deletedBefore,
+// и возвращает их количество. Журнал изменений сохраняется
+func (r *SubscriptionRepository) Purge(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	tag, err := r.pool.Exec(ctx, `DELETE FROM subscriptions WHERE deleted_at < $1`, deletedBefore)
+	if err != nil {
+		slog.Error("Failed to purge deleted subscriptions", "error", err)
+		return 0, fmt.Errorf("failed to purge deleted subscriptions: %w", err)
+	}
+
+	slog.Info("Purged deleted subscriptions", "count", tag.RowsAffected(), "deleted_before", deletedBefore)
+	return tag.RowsAffected(), nil
+}
+
+// lockSubscription читает неудаленную подписку с блокировкой строки до
+// конца транзакции. Если expectedVersion задан и не совпадает с текущей
+// версией, возвращает models.ErrPreconditionFailed
+func lockSubscription(
+	ctx context.Context,
+	tx pgx.Tx,
+	id uuid.UUID,
+	expectedVersion *int,
+) (*models.Subscription, error) {
+	sub, err := selectForUpdate(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if sub.DeletedAt != nil {
+		return nil, fmt.Errorf("%w: subscription %s", models.ErrNotFound, id)
+	}
+
+	if expectedVersion != nil && sub.Version != *expectedVersion {
+		return nil, fmt.Errorf("%w: subscription %s was modified, expected version %d",
+			models.ErrPreconditionFailed, id, *expectedVersion)
+	}
+
+	return sub, nil
+}
+
+// selectForUpdate читает подписку, в том числе удаленную, с блокировкой
+// строки до конца транзакции
+func selectForUpdate(ctx context.Context, tx pgx.Tx, id uuid.UUID) (*models.Subscription, error) {
+	query := `
+        SELECT ` + subscriptionColumns + `
+        FROM subscriptions
+        WHERE id = $1
+        FOR UPDATE
     `
 
-	rows, err := r.pool.Query(ctx, query, userID)
+	sub, err := scanSubscription(tx.QueryRow(ctx, query, id))
 	if err != nil {
-		slog.Error("Failed to get subscriptions by user ID", "user_id", userID, "error", err)
-		return nil, fmt.Errorf("failed to get subscriptions: %w", err)
+		return nil, wrapError(err, fmt.Sprintf("subscription %s", id))
 	}
+	return sub, nil
+}
+
+// scanSubscription читает строку, выбранную по subscriptionColumns
+func scanSubscription(row pgx.Row) (*models.Subscription, error) {
+	var (
+		sub         models.Subscription
+		pausedFrom  []time.Time
+		resumedFrom []pgtype.Date
+	)
+	err := row.Scan(
+		&sub.ID,
+		&sub.ServiceName,
+		&sub.ServiceID,
+		&sub.Price,
+		&sub.Currency,
+		&sub.UserID,
+		&sub.StartDate,
+		&sub.EndDate,
+		&sub.BillingPeriod,
+		&sub.BillingIntervalMonths,
+		&sub.TrialMonths,
+		&sub.IntroPrice,
+		&sub.IntroMonths,
+		&sub.Version,
+		&sub.CreatedAt,
+		&sub.UpdatedAt,
+		&sub.DeletedAt,
+		&pausedFrom,
+		&resumedFrom,
+		&sub.Tags,
+	)
+	if err != nil {
+		return nil, err
+	}
+	for i := range pausedFrom {
+		pause := models.Pause{PausedFrom: pausedFrom[i]}
+		if resumedFrom[i].Valid {
+			resumed := resumedFrom[i].Time
+			pause.ResumedFrom = &resumed
+		}
+		sub.Pauses = append(sub.Pauses, pause)
+	}
+	sub.SetComputed(time.Now())
+	return &sub, nil
+}
+
+// scanSubscriptions читает все строки результата и закрывает его
+func scanSubscriptions(rows pgx.Rows) ([]*models.Subscription, error) {
 	defer rows.Close()
 
 	var subscriptions []*models.Subscription
 	for rows.Next() {
-		var sub models.Subscription
-		err := rows.Scan(
-			&sub.ID,
-			&sub.ServiceName,
-			&sub.Price,
-			&sub.UserID,
-			&sub.StartDate,
-			&sub.EndDate,
-		)
+		sub, err := scanSubscription(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan subscription: %w", err)
 		}
-		subscriptions = append(subscriptions, &sub)
+		subscriptions = append(subscriptions, sub)
 	}
 
 	if err := rows.Err(); err != nil {
 		return nil, fmt.Errorf("error iterating rows: %w", err)
 	}
 
-	slog.Info("Retrieved subscriptions by user ID", "user_id", userID, "count", len(subscriptions))
 	return subscriptions, nil
 }
 
-func (r *SubscriptionRepository) GetTotalSpent(
+// sortColumns сопоставляет поля сортировки колонкам и типам для курсора.
+// Названия сравниваются побайтно, как strings.Compare в хранилище в памяти,
+// а не по правилам сортировки базы
+var sortColumns = map[string]string{
+	models.SortByStartDate:   "start_date::date",
+	models.SortByPrice:       "price::integer",
+	models.SortByServiceName: `service_name COLLATE "C"::text`,
+}
+
+// List возвращает страницу подписок, удовлетворяющих фильтру, в порядке
+// (SortBy, id). Следующая страница начинается после filter.After
+func (r *SubscriptionRepository) List(
 	ctx context.Context,
-	from time.Time,
-	to time.Time,
-	userID *uuid.UUID,
-	serviceName *string,
-) (int, error) {
+	filter models.SubscriptionFilter,
+) ([]*models.Subscription, error) {
+	query, args, err := listQuery(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	args = append(args, filter.Limit)
+	query += fmt.Sprintf(" LIMIT $%d", len(args))
+
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		slog.Error("Failed to list subscriptions", "error", err)
+		return nil, fmt.Errorf("failed to list subscriptions: %w", err)
+	}
+
+	subscriptions, err := scanSubscriptions(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("Listed subscriptions", "count", len(subscriptions))
+	return subscriptions, nil
+}
+
+// listQuery собирает запрос подписок по фильтру с сортировкой (SortBy, id),
+// но без LIMIT
+func listQuery(filter models.SubscriptionFilter) (string, []interface{}, error) {
+	sortColumn, ok := sortColumns[filter.SortBy]
+	if !ok {
+		return "", nil, fmt.Errorf("%w: unsupported sort field: %s", models.ErrValidation, filter.SortBy)
+	}
+	column, columnType, _ := strings.Cut(sortColumn, "::")
+
 	query := `
-        SELECT COALESCE(SUM(price), 0)
-        FROM subscriptions 
-        WHERE start_date <= $2 
-          AND (end_date IS NULL OR end_date >= $1)
+        SELECT ` + subscriptionColumns + `
+        FROM subscriptions
+        WHERE deleted_at IS NULL
     `
+	var args []interface{}
+	addCondition := func(condition string, value interface{}) {
+		args = append(args, value)
+		query += fmt.Sprintf(" AND "+condition, len(args))
+	}
 
-	args := []interface{}{from, to}
-	argIndex := 3
-
-	if userID != nil {
-		query += fmt.Sprintf(" AND user_id = $%d", argIndex)
-		args = append(args, *userID)
-		argIndex++
+	if filter.UserID != nil {
+		addCondition("user_id = $%d", *filter.UserID)
+	}
+	if filter.ServiceName != nil {
+		addCondition("service_name = $%d", *filter.ServiceName)
+	}
+	if filter.ActiveFrom != nil {
+		addCondition("(end_date IS NULL OR end_date >= $%d)", *filter.ActiveFrom)
+	}
+	if filter.ActiveTo != nil {
+		addCondition("start_date <= $%d", *filter.ActiveTo)
+	}
+	if filter.MinPrice != nil {
+		addCondition("price >= $%d", *filter.MinPrice)
+	}
+	if filter.MaxPrice != nil {
+		addCondition("price <= $%d", *filter.MaxPrice)
+	}
+	if filter.StartFrom != nil {
+		addCondition("start_date >= $%d", *filter.StartFrom)
+	}
+	if filter.StartTo != nil {
+		addCondition("start_date <= $%d", *filter.StartTo)
+	}
+	if filter.EndFrom != nil {
+		addCondition("end_date >= $%d", *filter.EndFrom)
+	}
+	if filter.EndTo != nil {
+		addCondition("end_date <= $%d", *filter.EndTo)
+	}
+	for _, tag := range filter.Tags {
+		addCondition("EXISTS (SELECT 1 FROM subscription_tags st JOIN tags t ON t.id = st.tag_id "+
+			"WHERE st.subscription_id = subscriptions.id AND t.name_key = $%d)", tag)
+	}
+	if filter.TrialEndFrom != nil && filter.TrialEndTo != nil {
+		// Без пробного периода выражение равно NULL и условие не выполняется
+		addCondition("(start_date + make_interval(months => trial_months))::date - 1 >= $%d", *filter.TrialEndFrom)
+		addCondition("(start_date + make_interval(months => trial_months))::date - 1 <= $%d", *filter.TrialEndTo)
 	}
 
-	if serviceName != nil {
-		query += fmt.Sprintf(" AND service_name = $%d", argIndex)
-		args = append(args, *serviceName)
+	direction, comparison := "ASC", ">"
+	if filter.Desc {
+		direction, comparison = "DESC", "<"
 	}
 
-	var total int
-	err := r.pool.QueryRow(ctx, query, args...).Scan(&total)
-	if err != nil {
-		slog.Error("Failed to calculate total spent",
-			"from", from, "to", to, "user_id", userID, "service_name", serviceName, "error", err)
-		return 0, fmt.Errorf("failed to calculate total spent: %w", err)
+	if filter.After != nil {
+		args = append(args, filter.After.Value, filter.After.ID)
+		query += fmt.Sprintf(" AND (%s, id) %s ($%d::%s, $%d)",
+			column, comparison, len(args)-1, columnType, len(args))
 	}
 
-	slog.Info("Calculated total spent",
-		"from", from, "to", to, "user_id", userID, "service_name", serviceName, "total", total)
-	return total, nil
+	query += fmt.Sprintf(" ORDER BY %s %s, id %s", column, direction, direction)
+	return query, args, nil
 }
@@ -0,0 +1,48 @@
+package postgres
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/NKV510/subscription-service/internal/repository/repotest"
+	"github.com/NKV510/subscription-service/internal/service"
+	"github.com/NKV510/subscription-service/migrations"
+	"github.com/NKV510/subscription-service/pkg/migrator"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// testDatabaseEnv строка подключения к тестовой базе; без нее проверки
+// пропускаются. База должна быть отдельной: миграции применяются к ней
+const testDatabaseEnv = "SUBS_TEST_DATABASE_URL"
+
+func TestSubscriptionRepository(t *testing.T) {
+	dsn := os.Getenv(testDatabaseEnv)
+	if dsn == "" {
+		t.Skipf("%s is not set", testDatabaseEnv)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	pool, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		t.Fatalf("connect to test database: %v", err)
+	}
+	t.Cleanup(pool.Close)
+
+	m, err := migrator.New(pool, migrations.FS, migrations.Funcs)
+	if err != nil {
+		t.Fatalf("load migrations: %v", err)
+	}
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatalf("apply migrations: %v", err)
+	}
+
+	// Проверки работают со своими user_id, поэтому база общая для всех
+	repo := NewSubscriptionRepository(pool)
+	repotest.RunSubscriptionRepositoryTests(t, func(t *testing.T) service.SubscriptionRepository {
+		return repo
+	})
+}
@@ -0,0 +1,208 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/NKV510/subscription-service/internal/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// CreateTag добавляет тег пользователя; тег пользователя с тем же ключом
+// названия - models.ErrConflict
+func (r *SubscriptionRepository) CreateTag(ctx context.Context, tag *models.Tag) error {
+	query := `
+        INSERT INTO tags (user_id, name, name_key)
+        VALUES ($1, $2, $3)
+        RETURNING id, created_at
+    `
+
+	err := r.pool.QueryRow(ctx, query, tag.UserID, tag.Name, models.TagKey(tag.Name)).Scan(&tag.ID, &tag.CreatedAt)
+	if err != nil {
+		slog.Error("Failed to create tag", "user_id", tag.UserID, "name", tag.Name, "error", err)
+		return wrapError(err, "failed to create tag")
+	}
+
+	slog.Info("Tag created successfully", "id", tag.ID, "user_id", tag.UserID, "name", tag.Name)
+	return nil
+}
+
+// RenameTag меняет название тега. Версия каждой отмеченной им подписки
+// увеличивается, изменение пишется в журнал. Тег того же пользователя с тем
+// же ключом названия - models.ErrConflict
+func (r *SubscriptionRepository) RenameTag(ctx context.Context, tag *models.Tag) error {
+	query := `
+        UPDATE tags
+        SET name = $1, name_key = $2
+        WHERE id = $3
+        RETURNING user_id, created_at
+    `
+
+	err := r.withTx(ctx, func(tx pgx.Tx) error {
+		return retagSubscriptions(ctx, tx, tag.ID, func() error {
+			err := tx.QueryRow(ctx, query, tag.Name, models.TagKey(tag.Name), tag.ID).Scan(&tag.UserID, &tag.CreatedAt)
+			if err != nil {
+				return wrapError(err, fmt.Sprintf("tag %s", tag.ID))
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		slog.Error("Failed to rename tag", "id", tag.ID, "error", err)
+		return err
+	}
+
+	slog.Info("Tag renamed successfully", "id", tag.ID, "name", tag.Name)
+	return nil
+}
+
+// DeleteTag удаляет тег и снимает его со всех подписок; версия каждой из
+// них увеличивается, изменение пишется в журнал
+func (r *SubscriptionRepository) DeleteTag(ctx context.Context, id uuid.UUID) error {
+	err := r.withTx(ctx, func(tx pgx.Tx) error {
+		return retagSubscriptions(ctx, tx, id, func() error {
+			result, err := tx.Exec(ctx, `DELETE FROM tags WHERE id = $1`, id)
+			if err != nil {
+				return fmt.Errorf("failed to delete tag: %w", err)
+			}
+			if result.RowsAffected() == 0 {
+				return fmt.Errorf("%w: tag %s", models.ErrNotFound, id)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		slog.Error("Failed to delete tag", "id", id, "error", err)
+		return err
+	}
+
+	slog.Info("Tag deleted successfully", "id", id)
+	return nil
+}
+
+// retagSubscriptions блокирует подписки, отмеченные тегом tagID, в том
+// числе удаленные, выполняет change, меняющий тег, и увеличивает версию
+// каждой подписки с записью события в журнал изменений
+func retagSubscriptions(ctx context.Context, tx pgx.Tx, tagID uuid.UUID, change func() error) error {
+	query := `
+        SELECT ` + subscriptionColumns + `
+        FROM subscriptions
+        WHERE id IN (SELECT subscription_id FROM subscription_tags WHERE tag_id = $1)
+        ORDER BY id
+        FOR UPDATE
+    `
+
+	rows, err := tx.Query(ctx, query, tagID)
+	if err != nil {
+		return fmt.Errorf("failed to select tagged subscriptions: %w", err)
+	}
+	subscriptions, err := scanSubscriptions(rows)
+	if err != nil {
+		return err
+	}
+
+	if err := change(); err != nil {
+		return err
+	}
+
+	for _, old := range subscriptions {
+		retagged, err := touchSubscription(ctx, tx, old.ID)
+		if err != nil {
+			return err
+		}
+		if err := insertEvent(ctx, tx, old.ID, models.EventTagged, old, retagged); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListTags возвращает теги по названию, все или только пользователя userID
+func (r *SubscriptionRepository) ListTags(ctx context.Context, userID *uuid.UUID) ([]models.Tag, error) {
+	query := `
+        SELECT id, user_id, name, created_at
+        FROM tags
+        WHERE $1::uuid IS NULL OR user_id = $1
+        ORDER BY name COLLATE "C", id
+    `
+
+	rows, err := r.pool.Query(ctx, query, userID)
+	if err != nil {
+		slog.Error("Failed to list tags", "user_id", userID, "error", err)
+		return nil, fmt.Errorf("failed to list tags: %w", err)
+	}
+	defer rows.Close()
+
+	tags := make([]models.Tag, 0)
+	for rows.Next() {
+		var tag models.Tag
+		if err := rows.Scan(&tag.ID, &tag.UserID, &tag.Name, &tag.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan tag: %w", err)
+		}
+		tags = append(tags, tag)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return tags, nil
+}
+
+// SetTags заменяет теги неудаленной подписки тегами ее пользователя с
+// названиями names, создавая недостающие, увеличивает версию и записывает
+// событие в журнал изменений. Названия в names не должны совпадать по ключу
+func (r *SubscriptionRepository) SetTags(
+	ctx context.Context,
+	id uuid.UUID,
+	names []string,
+	expectedVersion *int,
+) (*models.Subscription, error) {
+	createQuery := `
+        INSERT INTO tags (user_id, name, name_key)
+        SELECT $1::uuid, * FROM unnest($2::varchar[], $3::varchar[])
+        ON CONFLICT (user_id, name_key) DO NOTHING
+    `
+	attachQuery := `
+        INSERT INTO subscription_tags (subscription_id, tag_id)
+        SELECT $1, id FROM tags WHERE user_id = $2 AND name_key = ANY($3)
+    `
+
+	keys := make([]string, len(names))
+	for i, name := range names {
+		keys[i] = models.TagKey(name)
+	}
+
+	var tagged *models.Subscription
+	err := r.withTx(ctx, func(tx pgx.Tx) error {
+		old, err := lockSubscription(ctx, tx, id, expectedVersion)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(ctx, createQuery, old.UserID, names, keys); err != nil {
+			return wrapError(err, "failed to create tags")
+		}
+		if _, err := tx.Exec(ctx, `DELETE FROM subscription_tags WHERE subscription_id = $1`, id); err != nil {
+			return fmt.Errorf("failed to delete subscription tags: %w", err)
+		}
+		if _, err := tx.Exec(ctx, attachQuery, id, old.UserID, keys); err != nil {
+			return wrapError(err, "failed to set subscription tags")
+		}
+
+		tagged, err = touchSubscription(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		return insertEvent(ctx, tx, id, models.EventTagged, old, tagged)
+	})
+	if err != nil {
+		slog.Error("Failed to set subscription tags", "id", id, "error", err)
+		return nil, err
+	}
+
+	slog.Info("Subscription tags set", "id", id, "tags", names)
+	return tagged, nil
+}
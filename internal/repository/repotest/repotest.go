@@ -0,0 +1,1950 @@
+// Package repotest содержит общий набор проверок, которые должна проходить
+// любая реализация service.SubscriptionRepository. Подключается из тестов
+// конкретного хранилища:
+//
+//	func TestSubscriptionRepository(t *testing.T) {
+//		repotest.RunSubscriptionRepositoryTests(t, func(t *testing.T) service.SubscriptionRepository {
+//			return memory.NewSubscriptionRepository()
+//		})
+//	}
+//
+// Каждая проверка работает со своими user_id, поэтому хранилище может быть
+// общим для всех проверок (например, одна тестовая база postgres).
+package repotest
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NKV510/subscription-service/internal/models"
+	"github.com/NKV510/subscription-service/internal/reqctx"
+	"github.com/NKV510/subscription-service/internal/service"
+	"github.com/google/uuid"
+)
+
+// Factory создает хранилище для одной проверки
+type Factory func(t *testing.T) service.SubscriptionRepository
+
+// RunSubscriptionRepositoryTests запускает набор проверок для хранилища
+func RunSubscriptionRepositoryTests(t *testing.T, newRepo Factory) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, repo service.SubscriptionRepository)
+	}{
+		{"CreateAndGetByID", testCreateAndGetByID},
+		{"GetByIDNotFound", testGetByIDNotFound},
+		{"Update", testUpdate},
+		{"UpdateNotFound", testUpdateNotFound},
+		{"EndDateBeforeStartDate", testEndDateBeforeStartDate},
+		{"Delete", testDelete},
+		{"UpdateStaleVersion", testUpdateStaleVersion},
+		{"DeleteStaleVersion", testDeleteStaleVersion},
+		{"DeletedHiddenFromReads", testDeletedHiddenFromReads},
+		{"Restore", testRestore},
+		{"Purge", testPurge},
+		{"CreateIdempotent", testCreateIdempotent},
+		{"PurgeIdempotencyKeys", testPurgeIdempotencyKeys},
+		{"CreateBatch", testCreateBatch},
+		{"History", testHistory},
+		{"ListPagination", testListPagination},
+		{"ListSortByServiceName", testListSortByServiceName},
+		{"ListFilters", testListFilters},
+		{"Export", testExport},
+		{"TotalSpentCountsBilledMonths", testTotalSpentCountsBilledMonths},
+		{"TotalSpentOverlap", testTotalSpentOverlap},
+		{"TotalSpentFilters", testTotalSpentFilters},
+		{"TotalSpentProratesPartialMonths", testTotalSpentProratesPartialMonths},
+		{"BillingPeriods", testBillingPeriods},
+		{"MidMonthBillingCycles", testMidMonthBillingCycles},
+		{"ExchangeRates", testExchangeRates},
+		{"TotalSpentConverted", testTotalSpentConverted},
+		{"PriceChanges", testPriceChanges},
+		{"ListCharges", testListCharges},
+		{"NextChargeDate", testNextChargeDate},
+		{"TrialAndIntroPrice", testTrialAndIntroPrice},
+		{"PauseResume", testPauseResume},
+		{"Cancellations", testCancellations},
+		{"ServiceCatalog", testServiceCatalog},
+		{"MonthlySpent", testMonthlySpent},
+		{"SpentBreakdown", testSpentBreakdown},
+		{"Tags", testTags},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.run(t, newRepo(t))
+		})
+	}
+}
+
+func testCreateAndGetByID(t *testing.T, repo service.SubscriptionRepository) {
+	ctx := context.Background()
+	sub := newSubscription(uuid.New(), "Yandex Plus", 400, month(2025, 7), nil)
+
+	mustCreate(t, repo, sub)
+	if sub.ID == uuid.Nil {
+		t.Fatal("Create did not assign an ID")
+	}
+
+	got, err := repo.GetByID(ctx, sub.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	assertSubscription(t, got, sub)
+}
+
+func testGetByIDNotFound(t *testing.T, repo service.SubscriptionRepository) {
+	_, err := repo.GetByID(context.Background(), uuid.New())
+	assertNotFound(t, err)
+}
+
+func testUpdate(t *testing.T, repo service.SubscriptionRepository) {
+	ctx := context.Background()
+	sub := newSubscription(uuid.New(), "Netflix", 700, month(2025, 1), nil)
+	mustCreate(t, repo, sub)
+
+	endDate := monthEnd(2025, 6)
+	sub.ServiceName = "Netflix Premium"
+	sub.Price = 999
+	sub.StartDate = month(2025, 2)
+	sub.EndDate = &endDate
+
+	if err := repo.Update(ctx, sub); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	got, err := repo.GetByID(ctx, sub.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	assertSubscription(t, got, sub)
+}
+
+func testUpdateNotFound(t *testing.T, repo service.SubscriptionRepository) {
+	sub := newSubscription(uuid.New(), "Netflix", 700, month(2025, 1), nil)
+	sub.ID = uuid.New()
+
+	assertNotFound(t, repo.Update(context.Background(), sub))
+}
+
+func testEndDateBeforeStartDate(t *testing.T, repo service.SubscriptionRepository) {
+	ctx := context.Background()
+	end := monthEnd(2024, 12)
+
+	invalid := newSubscription(uuid.New(), "Netflix", 700, month(2025, 1), &end)
+	if err := repo.Create(ctx, invalid); !errors.Is(err, models.ErrValidation) {
+		t.Fatalf("Create with end_date before start_date: error = %v, want models.ErrValidation", err)
+	}
+
+	sub := newSubscription(uuid.New(), "Netflix", 700, month(2025, 1), nil)
+	mustCreate(t, repo, sub)
+	updated := *sub
+	updated.EndDate = &end
+	if err := repo.Update(ctx, &updated); !errors.Is(err, models.ErrValidation) {
+		t.Fatalf("Update with end_date before start_date: error = %v, want models.ErrValidation", err)
+	}
+
+	got, err := repo.GetByID(ctx, sub.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	assertSubscription(t, got, sub)
+}
+
+func testDelete(t *testing.T, repo service.SubscriptionRepository) {
+	ctx := context.Background()
+	sub := newSubscription(uuid.New(), "Spotify", 300, month(2025, 1), nil)
+	mustCreate(t, repo, sub)
+
+	if err := repo.Delete(ctx, sub.ID, nil); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	_, err := repo.GetByID(ctx, sub.ID)
+	assertNotFound(t, err)
+	assertNotFound(t, repo.Delete(ctx, sub.ID, nil))
+}
+
+func testUpdateStaleVersion(t *testing.T, repo service.SubscriptionRepository) {
+	ctx := context.Background()
+	sub := newSubscription(uuid.New(), "Netflix", 700, month(2025, 1), nil)
+	mustCreate(t, repo, sub)
+	if sub.Version != 1 {
+		t.Fatalf("version after Create = %d, want 1", sub.Version)
+	}
+
+	first, err := repo.GetByID(ctx, sub.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	second, err := repo.GetByID(ctx, sub.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+
+	first.Price = 800
+	if err := repo.Update(ctx, first); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if first.Version != 2 {
+		t.Fatalf("version after Update = %d, want 2", first.Version)
+	}
+
+	second.Price = 900
+	if err := repo.Update(ctx, second); !errors.Is(err, models.ErrPreconditionFailed) {
+		t.Fatalf("Update with a stale version: error = %v, want models.ErrPreconditionFailed", err)
+	}
+
+	got, err := repo.GetByID(ctx, sub.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if got.Price != 800 || got.Version != 2 {
+		t.Fatalf("subscription after conflicting updates = %+v, want price 800 and version 2", got)
+	}
+}
+
+func testDeleteStaleVersion(t *testing.T, repo service.SubscriptionRepository) {
+	ctx := context.Background()
+	sub := newSubscription(uuid.New(), "Netflix", 700, month(2025, 1), nil)
+	mustCreate(t, repo, sub)
+
+	stale := sub.Version + 1
+	if err := repo.Delete(ctx, sub.ID, &stale); !errors.Is(err, models.ErrPreconditionFailed) {
+		t.Fatalf("Delete with a stale version: error = %v, want models.ErrPreconditionFailed", err)
+	}
+	if err := repo.Delete(ctx, sub.ID, &sub.Version); err != nil {
+		t.Fatalf("Delete with the current version: %v", err)
+	}
+	assertNotFound(t, repo.Delete(ctx, sub.ID, &sub.Version))
+}
+
+func testDeletedHiddenFromReads(t *testing.T, repo service.SubscriptionRepository) {
+	ctx := context.Background()
+	userID := uuid.New()
+	kept := newSubscription(userID, "Netflix", 700, month(2025, 1), nil)
+	deleted := newSubscription(userID, "Spotify", 300, month(2025, 1), nil)
+	mustCreate(t, repo, kept)
+	mustCreate(t, repo, deleted)
+
+	if err := repo.Delete(ctx, deleted.ID, nil); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	listed, err := repo.List(ctx, models.SubscriptionFilter{
+		UserID: &userID,
+		SortBy: models.SortByStartDate,
+		Limit:  10,
+	})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(listed) != 1 || listed[0].ID != kept.ID {
+		t.Errorf("List returned %d subscriptions, want only %s", len(listed), kept.ID)
+	}
+
+	updated := *deleted
+	updated.Price = 400
+	assertNotFound(t, repo.Update(ctx, &updated))
+
+	assertTotal(t, repo, spendFilter(month(2025, 1), monthEnd(2025, 1), &userID, nil), 700)
+}
+
+func testRestore(t *testing.T, repo service.SubscriptionRepository) {
+	ctx := context.Background()
+	userID := uuid.New()
+	sub := newSubscription(userID, "Netflix", 700, month(2025, 1), nil)
+	mustCreate(t, repo, sub)
+
+	if _, err := repo.Restore(ctx, sub.ID); !errors.Is(err, models.ErrConflict) {
+		t.Fatalf("Restore of a live subscription: error = %v, want models.ErrConflict", err)
+	}
+
+	if err := repo.Delete(ctx, sub.ID, nil); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	restored, err := repo.Restore(ctx, sub.ID)
+	if err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if restored.DeletedAt != nil || restored.Version != sub.Version+2 {
+		t.Errorf("restored subscription = %+v, want no deleted_at and version %d", restored, sub.Version+2)
+	}
+
+	got, err := repo.GetByID(ctx, sub.ID)
+	if err != nil {
+		t.Fatalf("GetByID after Restore: %v", err)
+	}
+	assertSubscription(t, got, restored)
+	assertTotal(t, repo, spendFilter(month(2025, 1), monthEnd(2025, 1), &userID, nil), 700)
+
+	_, err = repo.Restore(ctx, uuid.New())
+	assertNotFound(t, err)
+}
+
+func testPurge(t *testing.T, repo service.SubscriptionRepository) {
+	ctx := context.Background()
+	live := newSubscription(uuid.New(), "Netflix", 700, month(2025, 1), nil)
+	deleted := newSubscription(uuid.New(), "Spotify", 300, month(2025, 1), nil)
+	mustCreate(t, repo, live)
+	mustCreate(t, repo, deleted)
+	if err := repo.Delete(ctx, deleted.ID, nil); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	// Подписка удалена только что и еще не попадает в срок очистки
+	if _, err := repo.Purge(ctx, time.Now().Add(-time.Hour)); err != nil {
+		t.Fatalf("Purge: %v", err)
+	}
+	if _, err := repo.Restore(ctx, deleted.ID); err != nil {
+		t.Fatalf("Restore of a recently deleted subscription: %v", err)
+	}
+	if err := repo.Delete(ctx, deleted.ID, nil); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	purged, err := repo.Purge(ctx, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Purge: %v", err)
+	}
+	if purged < 1 {
+		t.Errorf("Purge removed %d subscriptions, want at least 1", purged)
+	}
+
+	_, err = repo.Restore(ctx, deleted.ID)
+	assertNotFound(t, err)
+	if _, err := repo.GetByID(ctx, live.ID); err != nil {
+		t.Errorf("GetByID of a live subscription after Purge: %v", err)
+	}
+
+	// Журнал изменений очищенной подписки сохраняется
+	events, err := repo.GetHistory(ctx, deleted.ID)
+	if err != nil {
+		t.Fatalf("GetHistory after Purge: %v", err)
+	}
+	if len(events) == 0 {
+		t.Error("GetHistory after Purge returned no events")
+	}
+}
+
+func testCreateIdempotent(t *testing.T, repo service.SubscriptionRepository) {
+	ctx := context.Background()
+	userID := uuid.New()
+	key := models.IdempotencyKey{
+		Key:         uuid.NewString(),
+		RequestHash: strings.Repeat("a", 64),
+		ExpiresAt:   time.Now().Add(time.Hour),
+	}
+
+	first := newSubscription(userID, "Netflix", 700, month(2025, 1), nil)
+	stored, err := repo.CreateIdempotent(ctx, first, key)
+	if err != nil {
+		t.Fatalf("CreateIdempotent: %v", err)
+	}
+	if stored != nil {
+		t.Fatal("first CreateIdempotent returned a stored response")
+	}
+
+	retry := newSubscription(userID, "Netflix", 700, month(2025, 1), nil)
+	stored, err = repo.CreateIdempotent(ctx, retry, key)
+	if err != nil {
+		t.Fatalf("CreateIdempotent: %v", err)
+	}
+	if stored == nil || stored.Subscription.ID != first.ID || stored.RequestHash != key.RequestHash {
+		t.Fatalf("retry returned %+v, want the stored response of subscription %s", stored, first.ID)
+	}
+
+	if subscriptions := listUser(t, repo, userID); len(subscriptions) != 1 {
+		t.Fatalf("retry created a duplicate: %d subscriptions", len(subscriptions))
+	}
+
+	stored, err = repo.GetIdempotentResponse(ctx, key.Key)
+	if err != nil {
+		t.Fatalf("GetIdempotentResponse: %v", err)
+	}
+	if stored == nil || stored.Subscription.ID != first.ID || stored.RequestHash != key.RequestHash {
+		t.Fatalf("GetIdempotentResponse = %+v, want the stored response of subscription %s", stored, first.ID)
+	}
+	if stored, err = repo.GetIdempotentResponse(ctx, uuid.NewString()); err != nil || stored != nil {
+		t.Fatalf("GetIdempotentResponse of an unused key = %+v, %v, want nil", stored, err)
+	}
+
+	expired := models.IdempotencyKey{
+		Key:         uuid.NewString(),
+		RequestHash: key.RequestHash,
+		ExpiresAt:   time.Now().Add(-time.Hour),
+	}
+	mustCreateIdempotent(t, repo, newSubscription(userID, "Spotify", 300, month(2025, 1), nil), expired)
+	mustCreateIdempotent(t, repo, newSubscription(userID, "Spotify", 300, month(2025, 1), nil), expired)
+	if subscriptions := listUser(t, repo, userID); len(subscriptions) != 3 {
+		t.Fatalf("expired key must not be replayed: %d subscriptions, want 3", len(subscriptions))
+	}
+	if stored, err = repo.GetIdempotentResponse(ctx, expired.Key); err != nil || stored != nil {
+		t.Fatalf("GetIdempotentResponse of an expired key = %+v, %v, want nil", stored, err)
+	}
+}
+
+func testPurgeIdempotencyKeys(t *testing.T, repo service.SubscriptionRepository) {
+	ctx := context.Background()
+	userID := uuid.New()
+	live := models.IdempotencyKey{
+		Key:         uuid.NewString(),
+		RequestHash: strings.Repeat("a", 64),
+		ExpiresAt:   time.Now().Add(time.Hour),
+	}
+	expired := models.IdempotencyKey{
+		Key:         uuid.NewString(),
+		RequestHash: live.RequestHash,
+		ExpiresAt:   time.Now().Add(-time.Hour),
+	}
+	first := newSubscription(userID, "Netflix", 700, month(2025, 1), nil)
+	mustCreateIdempotent(t, repo, first, live)
+	mustCreateIdempotent(t, repo, newSubscription(userID, "Spotify", 300, month(2025, 1), nil), expired)
+
+	// Хранилище может быть общим с другими тестами, поэтому проверяется
+	// только нижняя граница
+	purged, err := repo.PurgeIdempotencyKeys(ctx, time.Now())
+	if err != nil {
+		t.Fatalf("PurgeIdempotencyKeys: %v", err)
+	}
+	if purged < 1 {
+		t.Errorf("PurgeIdempotencyKeys = %d, want at least the expired key", purged)
+	}
+
+	stored, err := repo.GetIdempotentResponse(ctx, live.Key)
+	if err != nil || stored == nil || stored.Subscription.ID != first.ID {
+		t.Fatalf("GetIdempotentResponse of a live key after purge = %+v, %v, want subscription %s", stored, err, first.ID)
+	}
+
+	// Удаленный ключ принимается заново с другим запросом
+	reused := expired
+	reused.RequestHash = strings.Repeat("b", 64)
+	reused.ExpiresAt = time.Now().Add(time.Hour)
+	sub := newSubscription(userID, "Kinopoisk", 400, month(2025, 1), nil)
+	mustCreateIdempotent(t, repo, sub, reused)
+	stored, err = repo.GetIdempotentResponse(ctx, reused.Key)
+	if err != nil || stored == nil || stored.Subscription.ID != sub.ID || stored.RequestHash != reused.RequestHash {
+		t.Fatalf("GetIdempotentResponse of a reused key = %+v, %v, want subscription %s", stored, err, sub.ID)
+	}
+}
+
+func testCreateBatch(t *testing.T, repo service.SubscriptionRepository) {
+	ctx := context.Background()
+	userID := uuid.New()
+	end := monthEnd(2025, 3)
+	subs := []*models.Subscription{
+		newSubscription(userID, "Netflix", 700, month(2025, 1), nil),
+		newSubscription(userID, "Spotify", 300, month(2025, 2), &end),
+	}
+
+	if err := repo.CreateBatch(ctx, subs); err != nil {
+		t.Fatalf("CreateBatch: %v", err)
+	}
+
+	for _, sub := range subs {
+		if sub.ID == uuid.Nil || sub.Version != 1 {
+			t.Fatalf("CreateBatch left id %s and version %d, want a new id and version 1", sub.ID, sub.Version)
+		}
+		got, err := repo.GetByID(ctx, sub.ID)
+		if err != nil {
+			t.Fatalf("GetByID: %v", err)
+		}
+		assertSubscription(t, got, sub)
+
+		events, err := repo.GetHistory(ctx, sub.ID)
+		if err != nil {
+			t.Fatalf("GetHistory: %v", err)
+		}
+		if len(events) != 1 || events[0].EventType != models.EventCreated {
+			t.Errorf("history of an imported subscription = %+v, want one created event", events)
+		}
+	}
+}
+
+func testHistory(t *testing.T, repo service.SubscriptionRepository) {
+	ctx := reqctx.WithActor(reqctx.WithRequestID(context.Background(), "req-1"), "alice")
+	sub := newSubscription(uuid.New(), "Netflix", 700, month(2025, 1), nil)
+	if err := repo.Create(ctx, sub); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	updated := *sub
+	updated.Price = 800
+	if err := repo.Update(ctx, &updated); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if err := repo.Delete(ctx, sub.ID, nil); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	// История удаленной подписки остается доступной
+	events, err := repo.GetHistory(ctx, sub.ID)
+	if err != nil {
+		t.Fatalf("GetHistory: %v", err)
+	}
+
+	wantTypes := []string{models.EventCreated, models.EventUpdated, models.EventDeleted}
+	if len(events) != len(wantTypes) {
+		t.Fatalf("GetHistory returned %d events, want %d", len(events), len(wantTypes))
+	}
+	for i, event := range events {
+		if event.EventType != wantTypes[i] || event.SubscriptionID != sub.ID {
+			t.Errorf("event %d = %s for %s, want %s for %s",
+				i, event.EventType, event.SubscriptionID, wantTypes[i], sub.ID)
+		}
+		if event.Actor != "alice" || event.RequestID != "req-1" {
+			t.Errorf("event %d actor/request = %q/%q, want alice/req-1", i, event.Actor, event.RequestID)
+		}
+		if i > 0 && event.ID <= events[i-1].ID {
+			t.Errorf("event IDs are not increasing: %d after %d", event.ID, events[i-1].ID)
+		}
+	}
+
+	created, changed, deleted := events[0], events[1], events[2]
+	if created.OldValues != nil || created.NewValues == nil || created.NewValues.Price != 700 {
+		t.Errorf("created event values = %+v -> %+v, want nil -> price 700", created.OldValues, created.NewValues)
+	}
+	if changed.OldValues == nil || changed.NewValues == nil ||
+		changed.OldValues.Price != 700 || changed.NewValues.Price != 800 || changed.NewValues.Version != 2 {
+		t.Errorf("updated event values = %+v -> %+v, want price 700 -> 800 at version 2",
+			changed.OldValues, changed.NewValues)
+	}
+	if deleted.OldValues == nil || deleted.NewValues == nil ||
+		deleted.OldValues.DeletedAt != nil || deleted.NewValues.DeletedAt == nil {
+		t.Errorf("deleted event values = %+v -> %+v, want deleted_at set", deleted.OldValues, deleted.NewValues)
+	}
+
+	_, err = repo.GetHistory(ctx, uuid.New())
+	assertNotFound(t, err)
+}
+
+func mustCreateIdempotent(
+	t *testing.T,
+	repo service.SubscriptionRepository,
+	sub *models.Subscription,
+	key models.IdempotencyKey,
+) {
+	t.Helper()
+	stored, err := repo.CreateIdempotent(context.Background(), sub, key)
+	if err != nil {
+		t.Fatalf("CreateIdempotent: %v", err)
+	}
+	if stored != nil {
+		t.Fatalf("CreateIdempotent replayed subscription %s", stored.Subscription.ID)
+	}
+}
+
+func testListPagination(t *testing.T, repo service.SubscriptionRepository) {
+	ctx := context.Background()
+	userID := uuid.New()
+	for _, price := range []int{500, 100, 300, 300, 200} {
+		mustCreate(t, repo, newSubscription(userID, "Netflix", price, month(2025, 1), nil))
+	}
+
+	filter := models.SubscriptionFilter{UserID: &userID, SortBy: models.SortByPrice, Limit: 2}
+	var prices []int
+	seen := make(map[uuid.UUID]bool)
+	for page := 0; page < 5; page++ {
+		got, err := repo.List(ctx, filter)
+		if err != nil {
+			t.Fatalf("List: %v", err)
+		}
+		for _, sub := range got {
+			if seen[sub.ID] {
+				t.Fatalf("subscription %s returned twice", sub.ID)
+			}
+			seen[sub.ID] = true
+			prices = append(prices, sub.Price)
+		}
+		if len(got) < filter.Limit {
+			break
+		}
+
+		last := got[len(got)-1]
+		filter.After = &models.ListCursor{
+			SortBy: filter.SortBy,
+			Value:  last.SortValue(filter.SortBy),
+			ID:     last.ID,
+		}
+	}
+
+	want := []int{100, 200, 300, 300, 500}
+	if len(prices) != len(want) {
+		t.Fatalf("walked %d subscriptions, want %d", len(prices), len(want))
+	}
+	for i := range want {
+		if prices[i] != want[i] {
+			t.Fatalf("prices = %v, want %v", prices, want)
+		}
+	}
+
+	filter = models.SubscriptionFilter{UserID: &userID, SortBy: models.SortByPrice, Desc: true, Limit: 1}
+	got, err := repo.List(ctx, filter)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(got) != 1 || got[0].Price != 500 {
+		t.Fatalf("List desc returned %+v, want the 500 subscription", got)
+	}
+}
+
+// Названия сортируются побайтно: заглавные латинские буквы раньше строчных,
+// кириллица после латиницы, независимо от правил сортировки базы
+func testListSortByServiceName(t *testing.T, repo service.SubscriptionRepository) {
+	ctx := context.Background()
+	userID := uuid.New()
+	for _, name := range []string{"ivi", "apple", "Яндекс", "Cherry", "banana", "Banana"} {
+		mustCreate(t, repo, newSubscription(userID, name, 100, month(2025, 1), nil))
+	}
+
+	for _, desc := range []bool{false, true} {
+		filter := models.SubscriptionFilter{UserID: &userID, SortBy: models.SortByServiceName, Desc: desc, Limit: 2}
+		var names []string
+		for page := 0; page < 5; page++ {
+			got, err := repo.List(ctx, filter)
+			if err != nil {
+				t.Fatalf("List: %v", err)
+			}
+			for _, sub := range got {
+				names = append(names, sub.ServiceName)
+			}
+			if len(got) < filter.Limit {
+				break
+			}
+
+			last := got[len(got)-1]
+			filter.After = &models.ListCursor{
+				SortBy: filter.SortBy,
+				Desc:   desc,
+				Value:  last.SortValue(filter.SortBy),
+				ID:     last.ID,
+			}
+		}
+
+		want := []string{"Banana", "Cherry", "apple", "banana", "ivi", "Яндекс"}
+		if desc {
+			slices.Reverse(want)
+		}
+		if !slices.Equal(names, want) {
+			t.Errorf("List by service_name (desc %t) = %v, want %v", desc, names, want)
+		}
+	}
+}
+
+func testExport(t *testing.T, repo service.SubscriptionRepository) {
+	ctx := context.Background()
+	userID := uuid.New()
+	for _, price := range []int{500, 100, 300} {
+		mustCreate(t, repo, newSubscription(userID, "Netflix", price, month(2025, 1), nil))
+	}
+	deleted := newSubscription(userID, "Netflix", 400, month(2025, 1), nil)
+	mustCreate(t, repo, deleted)
+	if err := repo.Delete(ctx, deleted.ID, nil); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	// Limit не ограничивает выгрузку
+	filter := models.SubscriptionFilter{UserID: &userID, SortBy: models.SortByPrice, Limit: 1}
+	var prices []int
+	err := repo.Export(ctx, filter, func(sub *models.Subscription) error {
+		prices = append(prices, sub.Price)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	if len(prices) != 3 || prices[0] != 100 || prices[1] != 300 || prices[2] != 500 {
+		t.Fatalf("exported prices = %v, want [100 300 500]", prices)
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	err = repo.Export(ctx, filter, func(sub *models.Subscription) error {
+		calls++
+		return stop
+	})
+	if !errors.Is(err, stop) || calls != 1 {
+		t.Fatalf("Export with a failing callback: error = %v after %d calls, want stop after 1 call", err, calls)
+	}
+}
+
+func testListFilters(t *testing.T, repo service.SubscriptionRepository) {
+	ctx := context.Background()
+	userID := uuid.New()
+	endDate := monthEnd(2024, 6)
+
+	ended := newSubscription(userID, "Spotify", 300, month(2024, 1), &endDate)
+	open := newSubscription(userID, "Netflix", 700, month(2024, 9), nil)
+	mustCreate(t, repo, ended)
+	mustCreate(t, repo, open)
+
+	activeFrom, activeTo := month(2024, 8), monthEnd(2024, 8)
+	minPrice := 500
+	tests := []struct {
+		name   string
+		filter models.SubscriptionFilter
+		want   []uuid.UUID
+	}{
+		{"all", models.SubscriptionFilter{}, []uuid.UUID{open.ID, ended.ID}},
+		{"active_at", models.SubscriptionFilter{ActiveFrom: &activeFrom, ActiveTo: &activeTo}, nil},
+		{"min_price", models.SubscriptionFilter{MinPrice: &minPrice}, []uuid.UUID{open.ID}},
+		{"end_from", models.SubscriptionFilter{EndFrom: &activeFrom}, nil},
+		{"end_to", models.SubscriptionFilter{EndTo: &activeTo}, []uuid.UUID{ended.ID}},
+	}
+
+	for _, tt := range tests {
+		filter := tt.filter
+		filter.UserID = &userID
+		filter.SortBy = models.SortByStartDate
+		filter.Desc = true
+		filter.Limit = 10
+
+		got, err := repo.List(ctx, filter)
+		if err != nil {
+			t.Fatalf("%s: List: %v", tt.name, err)
+		}
+		if len(got) != len(tt.want) {
+			t.Fatalf("%s: List returned %d subscriptions, want %d", tt.name, len(got), len(tt.want))
+		}
+		for i := range tt.want {
+			if got[i].ID != tt.want[i] {
+				t.Fatalf("%s: subscription %d = %s, want %s", tt.name, i, got[i].ID, tt.want[i])
+			}
+		}
+	}
+}
+
+func testTotalSpentCountsBilledMonths(t *testing.T, repo service.SubscriptionRepository) {
+	userID := uuid.New()
+	endDate := monthEnd(2024, 12)
+	mustCreate(t, repo, newSubscription(userID, "Yandex Plus", 100, month(2024, 1), &endDate))
+
+	assertTotal(t, repo, spendFilter(month(2024, 1), monthEnd(2024, 12), &userID, nil), 1200)
+	assertTotal(t, repo, spendFilter(month(2024, 3), monthEnd(2024, 5), &userID, nil), 300)
+	assertTotal(t, repo, spendFilter(month(2024, 12), monthEnd(2025, 6), &userID, nil), 100)
+}
+
+func testTotalSpentOverlap(t *testing.T, repo service.SubscriptionRepository) {
+	userID := uuid.New()
+	endedBefore := monthEnd(2023, 12)
+	startsAfter := month(2025, 1)
+
+	// Закончилась до окна и началась после окна - не учитываются
+	mustCreate(t, repo, newSubscription(userID, "Old", 1000, month(2023, 1), &endedBefore))
+	mustCreate(t, repo, newSubscription(userID, "Future", 1000, startsAfter, nil))
+	// Бессрочная, началась внутри окна: июнь-декабрь
+	mustCreate(t, repo, newSubscription(userID, "Open", 10, month(2024, 6), nil))
+	// Началась до окна и закончилась внутри: январь-февраль
+	endsInside := monthEnd(2024, 2)
+	mustCreate(t, repo, newSubscription(userID, "Ending", 1, month(2023, 6), &endsInside))
+
+	assertTotal(t, repo, spendFilter(month(2024, 1), monthEnd(2024, 12), &userID, nil), 72)
+}
+
+func testTotalSpentFilters(t *testing.T, repo service.SubscriptionRepository) {
+	userID := uuid.New()
+	otherUserID := uuid.New()
+	mustCreate(t, repo, newSubscription(userID, "Netflix", 700, month(2024, 1), nil))
+	mustCreate(t, repo, newSubscription(userID, "Spotify", 300, month(2024, 1), nil))
+	mustCreate(t, repo, newSubscription(otherUserID, "Netflix", 500, month(2024, 1), nil))
+
+	netflix := "Netflix"
+	from, to := month(2024, 1), monthEnd(2024, 2)
+
+	assertTotal(t, repo, spendFilter(from, to, &userID, nil), 2000)
+	assertTotal(t, repo, spendFilter(from, to, &userID, &netflix), 1400)
+	assertTotal(t, repo, spendFilter(from, to, &otherUserID, &netflix), 1000)
+}
+
+func testTotalSpentProratesPartialMonths(t *testing.T, repo service.SubscriptionRepository) {
+	userID := uuid.New()
+	// Период с 16 января по 15 февраля оплачен по 14 февраля: 30 из 31 дня
+	end := day(2025, 2, 14)
+	mustCreate(t, repo, newSubscription(userID, "Netflix", 310, day(2025, 1, 16), &end))
+
+	assertTotal(t, repo, spendFilter(month(2025, 1), monthEnd(2025, 2), &userID, nil), 300)
+	// Окно тоже может покрывать период не целиком: 16-20 января и 1-14 февраля
+	assertTotal(t, repo, spendFilter(month(2025, 1), day(2025, 1, 20), &userID, nil), 50)
+	assertTotal(t, repo, spendFilter(month(2025, 2), monthEnd(2025, 2), &userID, nil), 140)
+
+	months, err := repo.GetMonthlySpent(context.Background(),
+		spendFilter(month(2025, 1), monthEnd(2025, 3), &userID, nil))
+	if err != nil {
+		t.Fatalf("GetMonthlySpent: %v", err)
+	}
+	// Часть периода в окне относится к месяцу, в котором она начинается
+	want := []int{300, 0, 0}
+	if len(months) != len(want) {
+		t.Fatalf("GetMonthlySpent returned %d months, want %d", len(months), len(want))
+	}
+	for i, m := range months {
+		if m.Total != want[i] {
+			t.Errorf("month %s total = %d, want %d", m.Month, m.Total, want[i])
+		}
+	}
+}
+
+func testBillingPeriods(t *testing.T, repo service.SubscriptionRepository) {
+	ctx := context.Background()
+	userID := uuid.New()
+	twoMonths := 2
+
+	tests := []struct {
+		name              string
+		sub               *models.Subscription
+		from, to          time.Time
+		total             int
+		monthlyEquivalent int
+	}{
+		{
+			// 1, 8, 15, 22 и 29 января, последний период по 4 февраля;
+			// 70 * 52 / 12 = 303.3
+			name:              "Weekly",
+			sub:               newBilledSubscription(userID, "Weekly", 70, month(2024, 1), models.BillingWeekly, nil),
+			from:              month(2024, 1),
+			to:                day(2024, 2, 4),
+			total:             350,
+			monthlyEquivalent: 303,
+		},
+		{
+			// 31 января, 30 апреля, 31 июля и 31 октября, от последнего
+			// периода в окне 62 из 92 дней
+			name:              "Quarterly",
+			sub:               newBilledSubscription(userID, "Quarterly", 300, day(2024, 1, 31), models.BillingQuarterly, nil),
+			from:              month(2024, 1),
+			to:                monthEnd(2024, 12),
+			total:             900 + 202,
+			monthlyEquivalent: 100,
+		},
+		{
+			// Март 2024 и март 2025
+			name:              "Yearly",
+			sub:               newBilledSubscription(userID, "Yearly", 1200, month(2024, 3), models.BillingYearly, nil),
+			from:              month(2024, 1),
+			to:                monthEnd(2026, 2),
+			total:             2400,
+			monthlyEquivalent: 100,
+		},
+		{
+			// 15 января и 15 марта, от второго периода в окне 47 из 61 дня
+			name:              "Custom",
+			sub:               newBilledSubscription(userID, "Custom", 500, day(2024, 1, 15), models.BillingCustom, &twoMonths),
+			from:              month(2024, 1),
+			to:                monthEnd(2024, 4),
+			total:             500 + 385,
+			monthlyEquivalent: 250,
+		},
+	}
+
+	for _, tt := range tests {
+		mustCreate(t, repo, tt.sub)
+
+		got, err := repo.GetByID(ctx, tt.sub.ID)
+		if err != nil {
+			t.Fatalf("%s: GetByID: %v", tt.name, err)
+		}
+		if got.BillingPeriod != tt.sub.BillingPeriod || got.MonthlyEquivalent != tt.monthlyEquivalent {
+			t.Errorf("%s: billing_period = %q, monthly_equivalent = %d, want %q and %d",
+				tt.name, got.BillingPeriod, got.MonthlyEquivalent, tt.sub.BillingPeriod, tt.monthlyEquivalent)
+		}
+
+		serviceName := tt.sub.ServiceName
+		assertTotal(t, repo, spendFilter(tt.from, tt.to, &userID, &serviceName), tt.total)
+	}
+
+	// Годовая подписка активна и в месяцы без списаний
+	yearly := "Yearly"
+	months, err := repo.GetMonthlySpent(ctx, spendFilter(month(2024, 3), monthEnd(2025, 2), &userID, &yearly))
+	if err != nil {
+		t.Fatalf("GetMonthlySpent: %v", err)
+	}
+	if len(months) != 12 || months[0].Total != 1200 || months[1].Total != 0 ||
+		months[1].ActiveSubscriptions != 1 || months[1].MonthlyEquivalent != 100 {
+		t.Errorf("GetMonthlySpent = %+v, want 1200 in March and 0 with one active subscription in April", months)
+	}
+
+	groups, err := repo.GetSpentBreakdown(ctx, spendFilter(month(2024, 4), monthEnd(2024, 6), &userID, nil),
+		[]string{models.GroupByUserID}, 10)
+	if err != nil {
+		t.Fatalf("GetSpentBreakdown: %v", err)
+	}
+	// Во втором квартале: 13 недель; 29 из 90 дней квартала с 31 января и
+	// 62 из 92 дней квартала с 30 апреля; 91 из 365 дней годового периода;
+	// 44 из 61 дня периода с 15 марта и 47 из 61 дня периода с 15 мая
+	if len(groups) != 1 || groups[0].Total != 13*70+97+202+299+361+385 || groups[0].Subscriptions != 4 ||
+		groups[0].MonthlyEquivalent != 303+100+100+250 {
+		t.Errorf("GetSpentBreakdown = %+v, want total 2254, 4 subscriptions and monthly equivalent 753", groups)
+	}
+
+	invalid := newBilledSubscription(userID, "Invalid", 100, month(2024, 1), models.BillingCustom, nil)
+	if err := repo.Create(ctx, invalid); !errors.Is(err, models.ErrValidation) {
+		t.Errorf("Create custom period without interval error = %v, want models.ErrValidation", err)
+	}
+}
+
+func testMidMonthBillingCycles(t *testing.T, repo service.SubscriptionRepository) {
+	ctx := context.Background()
+	userID := uuid.New()
+	quarterly := newBilledSubscription(userID, "Quarterly", 300, day(2024, 2, 15), models.BillingQuarterly, nil)
+	yearly := newBilledSubscription(userID, "Yearly", 1200, day(2024, 3, 10), models.BillingYearly, nil)
+	mustCreate(t, repo, quarterly)
+	mustCreate(t, repo, yearly)
+
+	tests := []struct {
+		name     string
+		sub      *models.Subscription
+		from, to time.Time
+		dates    []time.Time // списания в окне, каждое по полной цене
+		total    int
+	}{
+		{
+			// Последний период с 15 ноября: 47 из 92 дней в окне
+			name:  "Quarterly",
+			sub:   quarterly,
+			from:  month(2024, 1),
+			to:    monthEnd(2024, 12),
+			dates: []time.Time{day(2024, 2, 15), day(2024, 5, 15), day(2024, 8, 15), day(2024, 11, 15)},
+			total: 900 + 153,
+		},
+		{
+			// Март - 31 из 90 дней периода с 15 февраля, списания в окне нет
+			name:  "QuarterlyInsideCycle",
+			sub:   quarterly,
+			from:  month(2024, 3),
+			to:    monthEnd(2024, 3),
+			total: 103,
+		},
+		{
+			// Второй период с 10 марта 2025: 297 из 365 дней в окне
+			name:  "Yearly",
+			sub:   yearly,
+			from:  month(2024, 1),
+			to:    monthEnd(2025, 12),
+			dates: []time.Time{day(2024, 3, 10), day(2025, 3, 10)},
+			total: 1200 + 976,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serviceName := tt.sub.ServiceName
+			filter := spendFilter(tt.from, tt.to, &userID, &serviceName)
+
+			charges, err := repo.ListCharges(ctx, filter)
+			if err != nil {
+				t.Fatalf("ListCharges: %v", err)
+			}
+			if len(charges) != len(tt.dates) {
+				t.Fatalf("ListCharges returned %d charges, want %d: %+v", len(charges), len(tt.dates), charges)
+			}
+			for i, date := range tt.dates {
+				if !charges[i].Date.Equal(date) || charges[i].Amount != tt.sub.Price {
+					t.Errorf("charge %d = %s %d, want %s %d",
+						i, charges[i].Date.Format(time.DateOnly), charges[i].Amount, date.Format(time.DateOnly), tt.sub.Price)
+				}
+			}
+
+			assertTotal(t, repo, filter, tt.total)
+		})
+	}
+}
+
+func testExchangeRates(t *testing.T, repo service.SubscriptionRepository) {
+	ctx := context.Background()
+	err := repo.UpsertExchangeRates(ctx, []models.ExchangeRate{
+		{Date: month(2024, 2), From: "USD", To: "RUB", Rate: 90},
+		{Date: month(2024, 1), From: "USD", To: "RUB", Rate: 88},
+		{Date: month(2024, 1), From: "EUR", To: "RUB", Rate: 95},
+	})
+	if err != nil {
+		t.Fatalf("UpsertExchangeRates: %v", err)
+	}
+	// Курс на ту же дату заменяется
+	if err := repo.UpsertExchangeRates(ctx, []models.ExchangeRate{
+		{Date: month(2024, 2), From: "USD", To: "RUB", Rate: 91.5},
+	}); err != nil {
+		t.Fatalf("UpsertExchangeRates: %v", err)
+	}
+
+	usd := "USD"
+	got, err := repo.ListExchangeRates(ctx, models.ExchangeRateFilter{From: &usd})
+	if err != nil {
+		t.Fatalf("ListExchangeRates: %v", err)
+	}
+	if len(got) != 2 || got[0].Rate != 88 || got[1].Rate != 91.5 ||
+		!got[0].Date.Equal(month(2024, 1)) || got[1].From != "USD" || got[1].To != "RUB" {
+		t.Errorf("ListExchangeRates = %+v, want USD->RUB 88 from 01-2024 and 91.5 from 02-2024", got)
+	}
+
+	all, err := repo.ListExchangeRates(ctx, models.ExchangeRateFilter{})
+	if err != nil {
+		t.Fatalf("ListExchangeRates: %v", err)
+	}
+	if len(all) != 3 || all[0].From != "EUR" {
+		t.Errorf("ListExchangeRates = %+v, want 3 rates starting with EUR", all)
+	}
+}
+
+func testTotalSpentConverted(t *testing.T, repo service.SubscriptionRepository) {
+	ctx := context.Background()
+	userID := uuid.New()
+	usd := newSubscription(userID, "Netflix", 10, month(2024, 1), nil)
+	usd.Currency = "USD"
+	mustCreate(t, repo, usd)
+	eur := newSubscription(userID, "Spotify", 5, month(2024, 1), nil)
+	eur.Currency = "EUR"
+	mustCreate(t, repo, eur)
+	mustCreate(t, repo, newSubscription(userID, "Kinopoisk", 300, month(2024, 1), nil))
+
+	// Курс USD меняется с середины февраля и действует до конца марта;
+	// для EUR есть только обратный курс
+	err := repo.UpsertExchangeRates(ctx, []models.ExchangeRate{
+		{Date: day(2023, 12, 31), From: "USD", To: "RUB", Rate: 88.5},
+		{Date: day(2024, 2, 15), From: "USD", To: "RUB", Rate: 90.04},
+		{Date: month(2024, 1), From: "RUB", To: "EUR", Rate: 0.01},
+	})
+	if err != nil {
+		t.Fatalf("UpsertExchangeRates: %v", err)
+	}
+
+	rub := "RUB"
+	filter := spendFilter(month(2024, 1), monthEnd(2024, 3), &userID, nil)
+	filter.Currency = &rub
+	// USD: 885 + 900 + 900 (900.4 округляется за месяц); EUR: 3 * 500; RUB: 3 * 300
+	assertTotal(t, repo, filter, 885+900+900+1500+900)
+
+	currencies, err := repo.GetSpendCurrencies(ctx, filter)
+	if err != nil {
+		t.Fatalf("GetSpendCurrencies: %v", err)
+	}
+	if strings.Join(currencies, ",") != "EUR,RUB,USD" {
+		t.Errorf("GetSpendCurrencies = %v, want [EUR RUB USD]", currencies)
+	}
+	netflix := "Netflix"
+	currencies, err = repo.GetSpendCurrencies(ctx, spendFilter(month(2024, 1), monthEnd(2024, 3), &userID, &netflix))
+	if err != nil {
+		t.Fatalf("GetSpendCurrencies: %v", err)
+	}
+	if len(currencies) != 1 || currencies[0] != "USD" {
+		t.Errorf("GetSpendCurrencies for Netflix = %v, want [USD]", currencies)
+	}
+
+	// Курса EUR за декабрь 2023 нет, пересчет невозможен
+	old := newSubscription(userID, "Old", 1, month(2023, 12), nil)
+	old.Currency = "EUR"
+	mustCreate(t, repo, old)
+	filter = spendFilter(month(2023, 12), monthEnd(2024, 1), &userID, nil)
+	filter.Currency = &rub
+	if _, err := repo.GetTotalSpent(ctx, filter); !errors.Is(err, models.ErrValidation) {
+		t.Errorf("GetTotalSpent without exchange rate error = %v, want models.ErrValidation", err)
+	}
+}
+
+func testPriceChanges(t *testing.T, repo service.SubscriptionRepository) {
+	ctx := context.Background()
+	userID := uuid.New()
+	sub := newSubscription(userID, "Netflix", 700, month(2024, 1), nil)
+	mustCreate(t, repo, sub)
+
+	stale := sub.Version + 1
+	_, err := repo.SchedulePriceChange(ctx, sub.ID, models.PriceChange{EffectiveFrom: month(2024, 3), Price: 800}, &stale)
+	if !errors.Is(err, models.ErrPreconditionFailed) {
+		t.Errorf("SchedulePriceChange with stale version error = %v, want models.ErrPreconditionFailed", err)
+	}
+
+	version := sub.Version
+	for _, change := range []models.PriceChange{
+		{EffectiveFrom: month(2024, 4), Price: 900},
+		{EffectiveFrom: month(2024, 3), Price: 800},
+		// Изменение с той же даты заменяет запланированное
+		{EffectiveFrom: month(2024, 4), Price: 1000},
+	} {
+		repriced, err := repo.SchedulePriceChange(ctx, sub.ID, change, &version)
+		if err != nil {
+			t.Fatalf("SchedulePriceChange: %v", err)
+		}
+		if repriced.Version != version+1 {
+			t.Errorf("version after SchedulePriceChange = %d, want %d", repriced.Version, version+1)
+		}
+		version = repriced.Version
+	}
+
+	events, err := repo.GetHistory(ctx, sub.ID)
+	if err != nil {
+		t.Fatalf("GetHistory: %v", err)
+	}
+	if len(events) != 4 || events[3].EventType != models.EventRepriced {
+		t.Errorf("GetHistory = %+v, want created and three repriced events", events)
+	}
+
+	changes, err := repo.GetPriceChanges(ctx, sub.ID)
+	if err != nil {
+		t.Fatalf("GetPriceChanges: %v", err)
+	}
+	if len(changes) != 2 ||
+		!changes[0].EffectiveFrom.Equal(month(2024, 3)) || changes[0].Price != 800 ||
+		!changes[1].EffectiveFrom.Equal(month(2024, 4)) || changes[1].Price != 1000 {
+		t.Fatalf("GetPriceChanges = %+v, want 800 from 03-2024 and 1000 from 04-2024", changes)
+	}
+
+	// Цена сохраненной подписки не меняется
+	got, err := repo.GetByID(ctx, sub.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if got.Price != 700 {
+		t.Errorf("price = %d, want 700", got.Price)
+	}
+
+	// Январь и февраль по 700, март 800, апрель и май по 1000
+	assertTotal(t, repo, spendFilter(month(2024, 1), monthEnd(2024, 5), &userID, nil), 4200)
+
+	months, err := repo.GetMonthlySpent(ctx, spendFilter(month(2024, 2), monthEnd(2024, 4), &userID, nil))
+	if err != nil {
+		t.Fatalf("GetMonthlySpent: %v", err)
+	}
+	for i, want := range []int{700, 800, 1000} {
+		if months[i].Total != want || months[i].MonthlyEquivalent != want {
+			t.Errorf("month %s = %+v, want total and monthly equivalent %d", months[i].Month, months[i], want)
+		}
+	}
+
+	// Ежемесячный эквивалент группы считается по цене на конец окна
+	groups, err := repo.GetSpentBreakdown(ctx,
+		spendFilter(month(2024, 1), monthEnd(2024, 3), &userID, nil), []string{models.GroupByServiceName}, 10)
+	if err != nil {
+		t.Fatalf("GetSpentBreakdown: %v", err)
+	}
+	if len(groups) != 1 || groups[0].Total != 2200 || groups[0].MonthlyEquivalent != 800 {
+		t.Errorf("GetSpentBreakdown = %+v, want total 2200 and monthly equivalent 800", groups)
+	}
+
+	_, err = repo.SchedulePriceChange(ctx, uuid.New(), models.PriceChange{EffectiveFrom: month(2024, 2), Price: 100}, nil)
+	assertNotFound(t, err)
+	_, err = repo.GetPriceChanges(ctx, uuid.New())
+	assertNotFound(t, err)
+
+	if err := repo.Delete(ctx, sub.ID, nil); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	_, err = repo.GetPriceChanges(ctx, sub.ID)
+	assertNotFound(t, err)
+}
+
+func testListCharges(t *testing.T, repo service.SubscriptionRepository) {
+	ctx := context.Background()
+	userID := uuid.New()
+	endDate := day(2024, 3, 14)
+	netflix := newSubscription(userID, "Netflix", 700, day(2024, 1, 20), nil)
+	spotify := newBilledSubscription(userID, "Spotify", 100, day(2024, 2, 26), models.BillingWeekly, nil)
+	yandex := newSubscription(userID, "Yandex Plus", 310, day(2024, 1, 1), &endDate)
+	for _, sub := range []*models.Subscription{netflix, spotify, yandex} {
+		mustCreate(t, repo, sub)
+	}
+	if _, err := repo.SchedulePriceChange(ctx, netflix.ID, models.PriceChange{EffectiveFrom: day(2024, 3, 1), Price: 800}, nil); err != nil {
+		t.Fatalf("SchedulePriceChange: %v", err)
+	}
+
+	got, err := repo.ListCharges(ctx, spendFilter(day(2024, 3, 1), day(2024, 3, 20), &userID, nil))
+	if err != nil {
+		t.Fatalf("ListCharges: %v", err)
+	}
+
+	// Периоды отсчитываются от start_date, последний период Yandex Plus
+	// оплачен за 14 дней из 31, Netflix списывается 20-го по новой цене
+	want := []models.Charge{
+		{SubscriptionID: yandex.ID, Date: day(2024, 3, 1), Amount: 140},
+		{SubscriptionID: spotify.ID, Date: day(2024, 3, 4), Amount: 100},
+		{SubscriptionID: spotify.ID, Date: day(2024, 3, 11), Amount: 100},
+		{SubscriptionID: spotify.ID, Date: day(2024, 3, 18), Amount: 100},
+		{SubscriptionID: netflix.ID, Date: day(2024, 3, 20), Amount: 800},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("ListCharges returned %d charges, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i].SubscriptionID != want[i].SubscriptionID ||
+			!got[i].Date.Equal(want[i].Date) ||
+			got[i].Amount != want[i].Amount ||
+			got[i].Currency != models.DefaultCurrency {
+			t.Errorf("charge %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func testNextChargeDate(t *testing.T, repo service.SubscriptionRepository) {
+	ctx := context.Background()
+	userID := uuid.New()
+	now := time.Now()
+	today := day(now.Year(), now.Month(), now.Day())
+
+	weekly := newBilledSubscription(userID, "Spotify", 100, today.AddDate(0, 0, -10), models.BillingWeekly, nil)
+	startsToday := newSubscription(userID, "Netflix", 700, today, nil)
+	endDate := today.AddDate(0, 0, -1)
+	ended := newSubscription(userID, "Kinopoisk", 200, today.AddDate(-1, 0, 0), &endDate)
+
+	scheduled := newSubscription(userID, "Yandex Plus", 300, today.AddDate(0, 1, 0), nil)
+
+	// Подписки с середины месяца списываются 15-го числа, а не первого
+	monthly := newSubscription(userID, "Ivi", 400, day(today.Year(), today.Month()-2, 15), nil)
+	monthlyNext := day(today.Year(), today.Month(), 15)
+	if today.Day() > 15 {
+		monthlyNext = day(today.Year(), today.Month()+1, 15)
+	}
+	quarterly := newBilledSubscription(userID, "Okko", 900, day(today.Year(), today.Month()-4, 15), models.BillingQuarterly, nil)
+
+	for _, tt := range []struct {
+		sub    *models.Subscription
+		want   *time.Time
+		status string
+	}{
+		{weekly, ptr(today.AddDate(0, 0, 4)), models.StatusActive},
+		{startsToday, &today, models.StatusActive},
+		{ended, nil, models.StatusEnded},
+		{scheduled, &scheduled.StartDate, models.StatusScheduled},
+		{monthly, &monthlyNext, models.StatusActive},
+		{quarterly, ptr(day(today.Year(), today.Month()+2, 15)), models.StatusActive},
+	} {
+		mustCreate(t, repo, tt.sub)
+		got, err := repo.GetByID(ctx, tt.sub.ID)
+		if err != nil {
+			t.Fatalf("GetByID: %v", err)
+		}
+		if (got.NextChargeDate == nil) != (tt.want == nil) ||
+			(tt.want != nil && !got.NextChargeDate.Equal(*tt.want)) {
+			t.Errorf("%s next_charge_date = %v, want %v", got.ServiceName, got.NextChargeDate, tt.want)
+		}
+		if got.Status != tt.status {
+			t.Errorf("%s status = %q, want %q", got.ServiceName, got.Status, tt.status)
+		}
+	}
+}
+
+func testTrialAndIntroPrice(t *testing.T, repo service.SubscriptionRepository) {
+	ctx := context.Background()
+	userID := uuid.New()
+	promo := newSubscription(userID, "Netflix", 1000, day(2024, 1, 31), nil)
+	promo.TrialMonths = ptr(1)
+	promo.IntroPrice = ptr(500)
+	promo.IntroMonths = ptr(2)
+	longTrial := newSubscription(userID, "Spotify", 300, month(2024, 1), nil)
+	longTrial.TrialMonths = ptr(3)
+	regular := newSubscription(userID, "Yandex Plus", 200, month(2024, 1), nil)
+	for _, sub := range []*models.Subscription{promo, longTrial, regular} {
+		mustCreate(t, repo, sub)
+	}
+	if _, err := repo.SchedulePriceChange(ctx, promo.ID, models.PriceChange{EffectiveFrom: day(2024, 3, 1), Price: 1200}, nil); err != nil {
+		t.Fatalf("SchedulePriceChange: %v", err)
+	}
+
+	got, err := repo.GetByID(ctx, promo.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if got.TrialMonths == nil || *got.TrialMonths != 1 || got.IntroPrice == nil || *got.IntroPrice != 500 ||
+		got.IntroMonths == nil || *got.IntroMonths != 2 ||
+		got.TrialEndDate == nil || !got.TrialEndDate.Equal(day(2024, 2, 28)) {
+		t.Errorf("subscription = %+v, want trial of 1 month ending 2024-02-28 and intro price 500 for 2 months", got)
+	}
+
+	// Списание 31 января приходится на пробный месяц до 29 февраля, два
+	// следующих - на месяцы по вводной цене, затем по запланированному
+	// изменению цены; в месяцах без 31-го числа списание в последний день
+	service := "Netflix"
+	charges, err := repo.ListCharges(ctx, spendFilter(month(2024, 1), monthEnd(2024, 5), &userID, &service))
+	if err != nil {
+		t.Fatalf("ListCharges: %v", err)
+	}
+	want := []models.Charge{
+		{Date: day(2024, 1, 31), Amount: 0},
+		{Date: day(2024, 2, 29), Amount: 500},
+		{Date: day(2024, 3, 31), Amount: 500},
+		{Date: day(2024, 4, 30), Amount: 1200},
+		{Date: day(2024, 5, 31), Amount: 1200},
+	}
+	if len(charges) != len(want) {
+		t.Fatalf("ListCharges returned %d charges, want %d: %+v", len(charges), len(want), charges)
+	}
+	for i := range want {
+		if !charges[i].Date.Equal(want[i].Date) || charges[i].Amount != want[i].Amount {
+			t.Errorf("charge %d = %+v, want %+v", i, charges[i], want[i])
+		}
+	}
+	// Из периода с 31 марта в окне 1 день из 30
+	assertTotal(t, repo, spendFilter(month(2024, 1), monthEnd(2024, 3), &userID, nil), 500+17+600+0)
+
+	trialEndFrom, trialEndTo := day(2024, 2, 28), day(2024, 3, 30)
+	list, err := repo.List(ctx, models.SubscriptionFilter{
+		UserID:       &userID,
+		TrialEndFrom: &trialEndFrom,
+		TrialEndTo:   &trialEndTo,
+		SortBy:       models.SortByStartDate,
+		Limit:        10,
+	})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(list) != 1 || list[0].ID != promo.ID {
+		t.Errorf("List by trial end returned %d subscriptions, want only %s", len(list), promo.ID)
+	}
+}
+
+func testPauseResume(t *testing.T, repo service.SubscriptionRepository) {
+	ctx := context.Background()
+	userID := uuid.New()
+	sub := newSubscription(userID, "World Class", 100, month(2024, 1), nil)
+	mustCreate(t, repo, sub)
+
+	stale := sub.Version + 1
+	if _, err := repo.Pause(ctx, sub.ID, month(2024, 3), &stale); !errors.Is(err, models.ErrPreconditionFailed) {
+		t.Errorf("Pause with stale version error = %v, want models.ErrPreconditionFailed", err)
+	}
+	if _, err := repo.Resume(ctx, sub.ID, month(2024, 3), nil); !errors.Is(err, models.ErrConflict) {
+		t.Errorf("Resume of active subscription error = %v, want models.ErrConflict", err)
+	}
+
+	paused, err := repo.Pause(ctx, sub.ID, month(2024, 3), &sub.Version)
+	if err != nil {
+		t.Fatalf("Pause: %v", err)
+	}
+	if paused.Version != sub.Version+1 || paused.Status != models.StatusPaused || paused.NextChargeDate != nil {
+		t.Errorf("paused subscription = %+v, want next version, status paused and no next charge", paused)
+	}
+	if _, err := repo.Pause(ctx, sub.ID, month(2024, 4), nil); !errors.Is(err, models.ErrConflict) {
+		t.Errorf("second Pause error = %v, want models.ErrConflict", err)
+	}
+	if _, err := repo.Resume(ctx, sub.ID, month(2024, 3), nil); !errors.Is(err, models.ErrValidation) {
+		t.Errorf("Resume on pause start error = %v, want models.ErrValidation", err)
+	}
+
+	resumed, err := repo.Resume(ctx, sub.ID, day(2024, 5, 15), nil)
+	if err != nil {
+		t.Fatalf("Resume: %v", err)
+	}
+	if resumed.Version != paused.Version+1 || resumed.Status != models.StatusActive || len(resumed.Pauses) != 1 ||
+		resumed.Pauses[0].ResumedFrom == nil || !resumed.Pauses[0].ResumedFrom.Equal(day(2024, 5, 15)) {
+		t.Errorf("resumed subscription = %+v, want next version, status active and one finished pause", resumed)
+	}
+	if _, err := repo.Pause(ctx, sub.ID, month(2024, 5), nil); !errors.Is(err, models.ErrValidation) {
+		t.Errorf("Pause overlapping previous pause error = %v, want models.ErrValidation", err)
+	}
+
+	// Изменение подписки сохраняет приостановки
+	resumed.Price = 200
+	if err := repo.Update(ctx, resumed); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	got, err := repo.GetByID(ctx, sub.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if len(got.Pauses) != 1 || !got.Pauses[0].PausedFrom.Equal(month(2024, 3)) {
+		t.Errorf("pauses after Update = %+v, want the pause from 03-2024", got.Pauses)
+	}
+
+	// Списания 1 марта, 1 апреля и 1 мая пропущены
+	assertTotal(t, repo, spendFilter(month(2024, 1), monthEnd(2024, 6), &userID, nil), 600)
+
+	months, err := repo.GetMonthlySpent(ctx, spendFilter(month(2024, 3), monthEnd(2024, 5), &userID, nil))
+	if err != nil {
+		t.Fatalf("GetMonthlySpent: %v", err)
+	}
+	for i, want := range []int{0, 0, 1} {
+		if months[i].Total != 0 || months[i].ActiveSubscriptions != want {
+			t.Errorf("month %s = %+v, want no charges and %d active subscriptions", months[i].Month, months[i], want)
+		}
+	}
+
+	events, err := repo.GetHistory(ctx, sub.ID)
+	if err != nil {
+		t.Fatalf("GetHistory: %v", err)
+	}
+	var types []string
+	for _, event := range events {
+		types = append(types, event.EventType)
+	}
+	if got := strings.Join(types, ","); got != "created,paused,resumed,updated" {
+		t.Errorf("event types = %s, want created,paused,resumed,updated", got)
+	}
+}
+
+func testCancellations(t *testing.T, repo service.SubscriptionRepository) {
+	ctx := context.Background()
+	userID := uuid.New()
+	netflix := newSubscription(userID, "Netflix", 700, month(2024, 1), nil)
+	family := newSubscription(userID, "Netflix", 900, month(2024, 1), nil)
+	spotify := newSubscription(userID, "Spotify", 300, month(2024, 2), nil)
+	for _, sub := range []*models.Subscription{netflix, family, spotify} {
+		mustCreate(t, repo, sub)
+	}
+
+	text := "found a cheaper plan"
+	cancelled, err := repo.Cancel(ctx, netflix.ID, models.Cancellation{
+		EffectiveMonth: month(2024, 3),
+		ReasonCode:     models.CancelReasonTooExpensive,
+		ReasonText:     &text,
+	}, &netflix.Version)
+	if err != nil {
+		t.Fatalf("Cancel: %v", err)
+	}
+	if cancelled.Version != netflix.Version+1 || cancelled.EndDate == nil || !cancelled.EndDate.Equal(monthEnd(2024, 3)) {
+		t.Errorf("cancelled subscription = %+v, want next version ending 2024-03-31", cancelled)
+	}
+
+	for _, tt := range []struct {
+		id     uuid.UUID
+		month  time.Time
+		reason string
+	}{
+		{family.ID, month(2024, 3), models.CancelReasonNotUsing},
+		{spotify.ID, month(2024, 4), models.CancelReasonTooExpensive},
+	} {
+		if _, err := repo.Cancel(ctx, tt.id, models.Cancellation{EffectiveMonth: tt.month, ReasonCode: tt.reason}, nil); err != nil {
+			t.Fatalf("Cancel: %v", err)
+		}
+	}
+	_, err = repo.Cancel(ctx, spotify.ID, models.Cancellation{EffectiveMonth: month(2024, 4), ReasonCode: "bored"}, nil)
+	if !errors.Is(err, models.ErrValidation) {
+		t.Errorf("Cancel with unsupported reason error = %v, want models.ErrValidation", err)
+	}
+	_, err = repo.Cancel(ctx, uuid.New(), models.Cancellation{EffectiveMonth: month(2024, 4), ReasonCode: models.CancelReasonOther}, nil)
+	assertNotFound(t, err)
+
+	assertCancellations := func(want []models.CancellationCount) {
+		t.Helper()
+		got, err := repo.GetCancellations(ctx, spendFilter(month(2024, 1), monthEnd(2024, 4), &userID, nil))
+		if err != nil {
+			t.Fatalf("GetCancellations: %v", err)
+		}
+		if len(got) != len(want) {
+			t.Fatalf("GetCancellations = %+v, want %+v", got, want)
+		}
+		for i := range want {
+			if !got[i].Month.Equal(want[i].Month) || got[i].ServiceName != want[i].ServiceName ||
+				got[i].ReasonCode != want[i].ReasonCode || got[i].Count != want[i].Count {
+				t.Errorf("cancellations %d = %+v, want %+v", i, got[i], want[i])
+			}
+		}
+	}
+
+	assertCancellations([]models.CancellationCount{
+		{Month: month(2024, 3), ServiceName: "Netflix", ReasonCode: models.CancelReasonNotUsing, Count: 1},
+		{Month: month(2024, 3), ServiceName: "Netflix", ReasonCode: models.CancelReasonTooExpensive, Count: 1},
+		{Month: month(2024, 4), ServiceName: "Spotify", ReasonCode: models.CancelReasonTooExpensive, Count: 1},
+	})
+
+	// Повторная отмена заменяет причину, продление и удаление подписки
+	// исключают ее из оттока
+	if _, err := repo.Cancel(ctx, netflix.ID, models.Cancellation{EffectiveMonth: month(2024, 2), ReasonCode: models.CancelReasonOther}, nil); err != nil {
+		t.Fatalf("Cancel: %v", err)
+	}
+	extended, err := repo.GetByID(ctx, family.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	extended.EndDate = nil
+	if err := repo.Update(ctx, extended); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if err := repo.Delete(ctx, spotify.ID, nil); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	assertCancellations([]models.CancellationCount{
+		{Month: month(2024, 2), ServiceName: "Netflix", ReasonCode: models.CancelReasonOther, Count: 1},
+	})
+
+	events, err := repo.GetHistory(ctx, netflix.ID)
+	if err != nil {
+		t.Fatalf("GetHistory: %v", err)
+	}
+	if last := events[len(events)-1]; last.EventType != models.EventCancelled {
+		t.Errorf("last event = %s, want %s", last.EventType, models.EventCancelled)
+	}
+}
+
+func testServiceCatalog(t *testing.T, repo service.SubscriptionRepository) {
+	ctx := context.Background()
+	// Каталог общий для всех подписок, названия уникальны для каждого запуска
+	suffix := uuid.NewString()[:8]
+	name, alias := "Yandex Plus "+suffix, "Яндекс Плюс "+suffix
+
+	orphan := newSubscription(uuid.New(), "  yandex   PLUS "+suffix, 299, month(2024, 1), nil)
+	mustCreate(t, repo, orphan)
+
+	svc := &models.Service{Name: name, Aliases: []string{alias}, DefaultPrice: ptr(299)}
+	if err := repo.CreateService(ctx, svc); err != nil {
+		t.Fatalf("CreateService: %v", err)
+	}
+	if err := repo.CreateService(ctx, &models.Service{Name: strings.ToUpper(alias)}); !errors.Is(err, models.ErrConflict) {
+		t.Errorf("CreateService with a taken alias error = %v, want models.ErrConflict", err)
+	}
+
+	found, err := repo.FindService(ctx, " ЯНДЕКС  плюс "+suffix)
+	if err != nil {
+		t.Fatalf("FindService: %v", err)
+	}
+	if found.ID != svc.ID || found.Name != name || len(found.Aliases) != 1 || found.Aliases[0] != alias ||
+		found.DefaultPrice == nil || *found.DefaultPrice != 299 {
+		t.Errorf("FindService = %+v, want %+v", found, svc)
+	}
+	_, err = repo.FindService(ctx, "Unknown "+suffix)
+	assertNotFound(t, err)
+
+	// Подписка без сервиса с тем же написанием привязывается к нему
+	got, err := repo.GetByID(ctx, orphan.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if got.ServiceID == nil || *got.ServiceID != svc.ID || got.ServiceName != name || got.Version != orphan.Version+1 {
+		t.Errorf("subscription service = %v %q, version %d, want %s %q and version %d",
+			got.ServiceID, got.ServiceName, got.Version, svc.ID, name, orphan.Version+1)
+	}
+
+	renamed := name + " Multi"
+	svc.Name, svc.Aliases, svc.DefaultPrice = renamed, []string{alias, name}, nil
+	if err := repo.UpdateService(ctx, svc); err != nil {
+		t.Fatalf("UpdateService: %v", err)
+	}
+	got, err = repo.GetByID(ctx, orphan.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if got.ServiceName != renamed || got.Version != orphan.Version+2 {
+		t.Errorf("subscription after rename = %q, version %d, want %q and version %d",
+			got.ServiceName, got.Version, renamed, orphan.Version+2)
+	}
+	if found, err = repo.FindService(ctx, strings.ToLower(name)); err != nil || found.ID != svc.ID || found.DefaultPrice != nil {
+		t.Errorf("FindService by the old name = %+v, %v, want renamed service without default price", found, err)
+	}
+
+	services, err := repo.ListServices(ctx)
+	if err != nil {
+		t.Fatalf("ListServices: %v", err)
+	}
+	if !slices.ContainsFunc(services, func(s models.Service) bool { return s.ID == svc.ID }) {
+		t.Errorf("ListServices does not contain service %s", svc.ID)
+	}
+
+	// Хранилище привязывает подписку к сервису по написанию при сохранении,
+	// название не из каталога сохраняется без сервиса и каталог не пополняет
+	byAlias := newSubscription(uuid.New(), strings.ToUpper(alias), 100, month(2024, 1), nil)
+	byAlias.ServiceID = ptr(uuid.New())
+	mustCreate(t, repo, byAlias)
+	if byAlias.ServiceID == nil || *byAlias.ServiceID != svc.ID || byAlias.ServiceName != renamed {
+		t.Errorf("subscription created by alias = %v %q, want %s %q", byAlias.ServiceID, byAlias.ServiceName, svc.ID, renamed)
+	}
+	unknown := newSubscription(uuid.New(), "Unknown "+suffix, 100, month(2024, 1), nil)
+	unknown.ServiceID = ptr(svc.ID)
+	mustCreate(t, repo, unknown)
+	if unknown.ServiceID != nil || unknown.ServiceName != "Unknown "+suffix {
+		t.Errorf("subscription outside the catalog = %v %q, want no service", unknown.ServiceID, unknown.ServiceName)
+	}
+	_, err = repo.FindService(ctx, unknown.ServiceName)
+	assertNotFound(t, err)
+
+	if err := repo.DeleteService(ctx, svc.ID); err != nil {
+		t.Fatalf("DeleteService: %v", err)
+	}
+	got, err = repo.GetByID(ctx, orphan.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if got.ServiceID != nil || got.ServiceName != renamed {
+		t.Errorf("subscription after service deletion = %v %q, want no service and %q", got.ServiceID, got.ServiceName, renamed)
+	}
+
+	// Привязка, переименование и отвязка сервиса записаны в журнал подписки
+	events, err := repo.GetHistory(ctx, orphan.ID)
+	if err != nil {
+		t.Fatalf("GetHistory: %v", err)
+	}
+	var types []string
+	for _, event := range events {
+		types = append(types, event.EventType)
+	}
+	if got := strings.Join(types, ","); got != "created,updated,updated,updated" {
+		t.Errorf("event types = %s, want created,updated,updated,updated", got)
+	}
+	_, err = repo.GetService(ctx, svc.ID)
+	assertNotFound(t, err)
+	assertNotFound(t, repo.DeleteService(ctx, svc.ID))
+}
+
+func testMonthlySpent(t *testing.T, repo service.SubscriptionRepository) {
+	ctx := context.Background()
+	userID := uuid.New()
+	endDate := monthEnd(2024, 2)
+	mustCreate(t, repo, newSubscription(userID, "Netflix", 700, month(2024, 1), &endDate))
+	mustCreate(t, repo, newSubscription(userID, "Spotify", 300, month(2024, 2), nil))
+
+	got, err := repo.GetMonthlySpent(ctx, spendFilter(month(2023, 12), monthEnd(2024, 3), &userID, nil))
+	if err != nil {
+		t.Fatalf("GetMonthlySpent: %v", err)
+	}
+
+	want := []models.MonthlySpent{
+		{Month: models.MonthYear(month(2023, 12)), Total: 0, ActiveSubscriptions: 0},
+		{Month: models.MonthYear(month(2024, 1)), Total: 700, ActiveSubscriptions: 1},
+		{Month: models.MonthYear(month(2024, 2)), Total: 1000, ActiveSubscriptions: 2},
+		{Month: models.MonthYear(month(2024, 3)), Total: 300, ActiveSubscriptions: 1},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("GetMonthlySpent returned %d months, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].Month.String() != want[i].Month.String() ||
+			got[i].Total != want[i].Total ||
+			got[i].ActiveSubscriptions != want[i].ActiveSubscriptions {
+			t.Errorf("month %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func testSpentBreakdown(t *testing.T, repo service.SubscriptionRepository) {
+	ctx := context.Background()
+	userID := uuid.New()
+	mustCreate(t, repo, newSubscription(userID, "Netflix", 700, month(2024, 1), nil))
+	mustCreate(t, repo, newSubscription(userID, "Netflix", 100, month(2024, 1), nil))
+	mustCreate(t, repo, newSubscription(userID, "Spotify", 300, month(2024, 1), nil))
+	mustCreate(t, repo, newSubscription(userID, "Kinopoisk", 200, month(2024, 1), nil))
+
+	filter := spendFilter(month(2024, 1), monthEnd(2024, 2), &userID, nil)
+	got, err := repo.GetSpentBreakdown(ctx, filter, []string{models.GroupByServiceName}, 2)
+	if err != nil {
+		t.Fatalf("GetSpentBreakdown: %v", err)
+	}
+
+	if len(got) != 2 {
+		t.Fatalf("GetSpentBreakdown returned %d groups, want 2", len(got))
+	}
+	if got[0].ServiceName == nil || *got[0].ServiceName != "Netflix" || got[0].Total != 1600 || got[0].Subscriptions != 2 {
+		t.Errorf("first group = %+v, want Netflix with total 1600 and 2 subscriptions", got[0])
+	}
+	if got[1].ServiceName == nil || *got[1].ServiceName != "Spotify" || got[1].Total != 600 {
+		t.Errorf("second group = %+v, want Spotify with total 600", got[1])
+	}
+	if got[0].UserID != nil {
+		t.Error("user_id must be empty when not grouping by it")
+	}
+}
+
+func testTags(t *testing.T, repo service.SubscriptionRepository) {
+	ctx := context.Background()
+	userID := uuid.New()
+	// Теги принадлежат пользователю, поэтому названия не пересекаются с другими запусками
+	fun, work := "fun", "work"
+
+	netflix := newSubscription(userID, "Netflix", 700, month(2024, 1), nil)
+	github := newSubscription(userID, "GitHub", 400, month(2024, 1), nil)
+	spotify := newSubscription(userID, "Spotify", 300, month(2024, 1), nil)
+	for _, sub := range []*models.Subscription{netflix, github, spotify} {
+		mustCreate(t, repo, sub)
+	}
+
+	tag := &models.Tag{UserID: userID, Name: fun}
+	if err := repo.CreateTag(ctx, tag); err != nil {
+		t.Fatalf("CreateTag: %v", err)
+	}
+	if err := repo.CreateTag(ctx, &models.Tag{UserID: userID, Name: strings.ToUpper(fun)}); !errors.Is(err, models.ErrConflict) {
+		t.Errorf("CreateTag with a taken name error = %v, want models.ErrConflict", err)
+	}
+	// Такое же название у другого пользователя - отдельный тег
+	otherUserID := uuid.New()
+	otherTag := &models.Tag{UserID: otherUserID, Name: fun}
+	if err := repo.CreateTag(ctx, otherTag); err != nil {
+		t.Fatalf("CreateTag for another user: %v", err)
+	}
+	other := newSubscription(otherUserID, "Netflix", 500, month(2024, 1), nil)
+	mustCreate(t, repo, other)
+	if _, err := repo.SetTags(ctx, other.ID, []string{fun}, nil); err != nil {
+		t.Fatalf("SetTags: %v", err)
+	}
+
+	stale := netflix.Version + 1
+	if _, err := repo.SetTags(ctx, netflix.ID, []string{fun}, &stale); !errors.Is(err, models.ErrPreconditionFailed) {
+		t.Errorf("SetTags with a stale version error = %v, want models.ErrPreconditionFailed", err)
+	}
+	// Существующий тег находится без учета регистра, недостающий создается
+	tagged, err := repo.SetTags(ctx, netflix.ID, []string{work, "FUN "}, &netflix.Version)
+	if err != nil {
+		t.Fatalf("SetTags: %v", err)
+	}
+	if tagged.Version != netflix.Version+1 || !slices.Equal(tagged.Tags, []string{fun, work}) {
+		t.Errorf("SetTags = version %d, tags %v, want version %d, tags %v",
+			tagged.Version, tagged.Tags, netflix.Version+1, []string{fun, work})
+	}
+	if _, err := repo.SetTags(ctx, github.ID, []string{work}, nil); err != nil {
+		t.Fatalf("SetTags: %v", err)
+	}
+	_, err = repo.SetTags(ctx, uuid.New(), []string{work}, nil)
+	assertNotFound(t, err)
+	github, err = repo.GetByID(ctx, github.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+
+	listed, err := repo.List(ctx, models.SubscriptionFilter{
+		UserID: &userID,
+		Tags:   []string{models.TagKey(work), models.TagKey(fun)},
+		SortBy: models.SortByPrice,
+		Limit:  10,
+	})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(listed) != 1 || listed[0].ID != netflix.ID {
+		t.Errorf("List by both tags returned %d subscriptions, want only %s", len(listed), netflix.ID)
+	}
+
+	// Подписка с двумя тегами учитывается в каждом, без тегов - в группе без тега
+	filter := spendFilter(month(2024, 1), monthEnd(2024, 1), &userID, nil)
+	groups, err := repo.GetSpentBreakdown(ctx, filter, []string{models.GroupByTag}, 10)
+	if err != nil {
+		t.Fatalf("GetSpentBreakdown: %v", err)
+	}
+	type tagTotal struct {
+		tag         string
+		total, subs int
+	}
+	var totals []tagTotal
+	for _, group := range groups {
+		total := tagTotal{total: group.Total, subs: group.Subscriptions}
+		if group.Tag != nil {
+			total.tag = *group.Tag
+		}
+		totals = append(totals, total)
+	}
+	want := []tagTotal{{work, 1100, 2}, {fun, 700, 1}, {"", 300, 1}}
+	if !slices.Equal(totals, want) {
+		t.Errorf("GetSpentBreakdown by tag = %+v, want %+v", totals, want)
+	}
+
+	// Теги разных пользователей с одним ключом - одна группа под наименьшим
+	// побайтово написанием; название сервиса отделяет эти подписки от
+	// подписок других проверок
+	serviceName := "Tagged " + uuid.NewString()
+	for _, owner := range []struct {
+		name  string
+		price int
+	}{{"fun", 200}, {"Fun", 100}} {
+		ownerID := uuid.New()
+		sub := newSubscription(ownerID, serviceName, owner.price, month(2024, 1), nil)
+		mustCreate(t, repo, sub)
+		if err := repo.CreateTag(ctx, &models.Tag{UserID: ownerID, Name: owner.name}); err != nil {
+			t.Fatalf("CreateTag: %v", err)
+		}
+		if _, err := repo.SetTags(ctx, sub.ID, []string{owner.name}, nil); err != nil {
+			t.Fatalf("SetTags: %v", err)
+		}
+	}
+	groups, err = repo.GetSpentBreakdown(ctx, spendFilter(month(2024, 1), monthEnd(2024, 1), nil, &serviceName),
+		[]string{models.GroupByTag}, 10)
+	if err != nil {
+		t.Fatalf("GetSpentBreakdown: %v", err)
+	}
+	if len(groups) != 1 || groups[0].Tag == nil || *groups[0].Tag != "Fun" ||
+		groups[0].Total != 300 || groups[0].Subscriptions != 2 {
+		t.Errorf("GetSpentBreakdown by tag across users = %+v, want one group Fun with 300 and 2 subscriptions", groups)
+	}
+
+	renamed := "entertainment"
+	tag.Name = renamed
+	if err := repo.RenameTag(ctx, tag); err != nil {
+		t.Fatalf("RenameTag: %v", err)
+	}
+	if err := repo.RenameTag(ctx, &models.Tag{ID: tag.ID, Name: work}); !errors.Is(err, models.ErrConflict) {
+		t.Errorf("RenameTag to a taken name error = %v, want models.ErrConflict", err)
+	}
+	got, err := repo.GetByID(ctx, netflix.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	// Переименование меняет теги подписки, поэтому дает новую версию
+	if !slices.Equal(got.Tags, []string{renamed, work}) || got.Version != tagged.Version+1 {
+		t.Errorf("subscription after rename = tags %v, version %d, want tags %v, version %d",
+			got.Tags, got.Version, []string{renamed, work}, tagged.Version+1)
+	}
+	untouched, err := repo.GetByID(ctx, github.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if untouched.Version != github.Version {
+		t.Errorf("version of a subscription without the renamed tag = %d, want %d", untouched.Version, github.Version)
+	}
+	otherGot, err := repo.GetByID(ctx, other.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if !slices.Equal(otherGot.Tags, []string{fun}) {
+		t.Errorf("tags of another user after rename = %v, want %v", otherGot.Tags, []string{fun})
+	}
+
+	tags, err := repo.ListTags(ctx, &userID)
+	if err != nil {
+		t.Fatalf("ListTags: %v", err)
+	}
+	var names []string
+	for _, tg := range tags {
+		names = append(names, tg.Name)
+	}
+	if !slices.Equal(names, []string{renamed, work}) {
+		t.Errorf("ListTags of the user = %v, want %v", names, []string{renamed, work})
+	}
+	tags, err = repo.ListTags(ctx, nil)
+	if err != nil {
+		t.Fatalf("ListTags: %v", err)
+	}
+	if !slices.ContainsFunc(tags, func(tg models.Tag) bool { return tg.ID == otherTag.ID }) {
+		t.Errorf("ListTags of all users does not contain tag %s", otherTag.ID)
+	}
+
+	if err := repo.DeleteTag(ctx, tag.ID); err != nil {
+		t.Fatalf("DeleteTag: %v", err)
+	}
+	assertNotFound(t, repo.DeleteTag(ctx, tag.ID))
+	got, err = repo.GetByID(ctx, netflix.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if !slices.Equal(got.Tags, []string{work}) || got.Version != tagged.Version+2 {
+		t.Errorf("subscription after tag deletion = tags %v, version %d, want tags %v, version %d",
+			got.Tags, got.Version, []string{work}, tagged.Version+2)
+	}
+	events, err := repo.GetHistory(ctx, netflix.ID)
+	if err != nil {
+		t.Fatalf("GetHistory: %v", err)
+	}
+	var types []string
+	for _, event := range events {
+		types = append(types, event.EventType)
+	}
+	wantTypes := []string{models.EventCreated, models.EventTagged, models.EventTagged, models.EventTagged}
+	if !slices.Equal(types, wantTypes) {
+		t.Errorf("GetHistory = %v, want %v", types, wantTypes)
+	}
+
+	// Пустой список снимает все теги
+	cleared, err := repo.SetTags(ctx, netflix.ID, nil, nil)
+	if err != nil {
+		t.Fatalf("SetTags: %v", err)
+	}
+	if len(cleared.Tags) != 0 {
+		t.Errorf("tags after clearing = %v, want none", cleared.Tags)
+	}
+}
+
+func newSubscription(
+	userID uuid.UUID,
+	serviceName string,
+	price int,
+	startDate time.Time,
+	endDate *time.Time,
+) *models.Subscription {
+	return &models.Subscription{
+		ServiceName:   serviceName,
+		Price:         price,
+		Currency:      models.DefaultCurrency,
+		UserID:        userID,
+		StartDate:     startDate,
+		EndDate:       endDate,
+		BillingPeriod: models.BillingMonthly,
+	}
+}
+
+// newBilledSubscription создает бессрочную подписку с периодом оплаты
+func newBilledSubscription(
+	userID uuid.UUID,
+	serviceName string,
+	price int,
+	startDate time.Time,
+	period string,
+	intervalMonths *int,
+) *models.Subscription {
+	sub := newSubscription(userID, serviceName, price, startDate, nil)
+	sub.BillingPeriod = period
+	sub.BillingIntervalMonths = intervalMonths
+	return sub
+}
+
+func spendFilter(from, to time.Time, userID *uuid.UUID, serviceName *string) models.SpendFilter {
+	return models.SpendFilter{From: from, To: to, UserID: userID, ServiceName: serviceName}
+}
+
+func mustCreate(t *testing.T, repo service.SubscriptionRepository, sub *models.Subscription) {
+	t.Helper()
+	if err := repo.Create(context.Background(), sub); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+}
+
+// listUser возвращает неудаленные подписки пользователя по убыванию start_date
+func listUser(t *testing.T, repo service.SubscriptionRepository, userID uuid.UUID) []*models.Subscription {
+	t.Helper()
+	subscriptions, err := repo.List(context.Background(), models.SubscriptionFilter{
+		UserID: &userID,
+		SortBy: models.SortByStartDate,
+		Desc:   true,
+		Limit:  100,
+	})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	return subscriptions
+}
+
+func assertTotal(t *testing.T, repo service.SubscriptionRepository, filter models.SpendFilter, want int) {
+	t.Helper()
+	got, err := repo.GetTotalSpent(context.Background(), filter)
+	if err != nil {
+		t.Fatalf("GetTotalSpent: %v", err)
+	}
+	if got != want {
+		t.Errorf("GetTotalSpent(%s..%s) = %d, want %d",
+			filter.From.Format("01-2006"), filter.To.Format("01-2006"), got, want)
+	}
+}
+
+func assertNotFound(t *testing.T, err error) {
+	t.Helper()
+	if !errors.Is(err, models.ErrNotFound) {
+		t.Fatalf("error = %v, want models.ErrNotFound", err)
+	}
+}
+
+func assertSubscription(t *testing.T, got, want *models.Subscription) {
+	t.Helper()
+	if got.ID != want.ID ||
+		got.ServiceName != want.ServiceName ||
+		got.Price != want.Price ||
+		got.UserID != want.UserID ||
+		got.Version != want.Version ||
+		!got.StartDate.Equal(want.StartDate) {
+		t.Fatalf("subscription = %+v, want %+v", got, want)
+	}
+	if (got.EndDate == nil) != (want.EndDate == nil) ||
+		(got.EndDate != nil && !got.EndDate.Equal(*want.EndDate)) {
+		t.Fatalf("end_date = %v, want %v", got.EndDate, want.EndDate)
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+// month возвращает первый день месяца
+func month(year int, m time.Month) time.Time {
+	return time.Date(year, m, 1, 0, 0, 0, 0, time.UTC)
+}
+
+// monthEnd возвращает последний день месяца
+func monthEnd(year int, m time.Month) time.Time {
+	return time.Date(year, m+1, 0, 0, 0, 0, 0, time.UTC)
+}
+
+func day(year int, m time.Month, d int) time.Time {
+	return time.Date(year, m, d, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,48 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/NKV510/subscription-service/internal/models"
+)
+
+// checkBillingPeriod добавляет ошибки периода оплаты: поддерживаемый период
+// и число месяцев, которое задается только для периода custom
+func checkBillingPeriod(validationErr *models.ValidationError, period string, intervalMonths *int) {
+	if !models.IsBillingPeriod(period) {
+		validationErr.Add("billing_period", "expected weekly, monthly, quarterly, yearly or custom")
+		return
+	}
+
+	switch {
+	case period == models.BillingCustom && intervalMonths == nil:
+		validationErr.Add("billing_interval_months", "is required for custom billing period")
+	case period != models.BillingCustom && intervalMonths != nil:
+		validationErr.Add("billing_interval_months", "is allowed only for custom billing period")
+	case intervalMonths != nil && (*intervalMonths < 1 || *intervalMonths > models.MaxBillingIntervalMonths):
+		validationErr.Add("billing_interval_months",
+			fmt.Sprintf("must be from 1 to %d", models.MaxBillingIntervalMonths))
+	}
+}
+
+// checkPromo добавляет ошибки пробного периода и вводной цены: длины
+// периодов и вводная цена, которая задается только вместе с числом месяцев
+func checkPromo(validationErr *models.ValidationError, trialMonths, introPrice, introMonths *int) {
+	monthsMessage := fmt.Sprintf("must be from 1 to %d", models.MaxPromoMonths)
+	if trialMonths != nil && (*trialMonths < 1 || *trialMonths > models.MaxPromoMonths) {
+		validationErr.Add("trial_months", monthsMessage)
+	}
+
+	switch {
+	case introPrice != nil && introMonths == nil:
+		validationErr.Add("intro_months", "is required with intro_price")
+	case introPrice == nil && introMonths != nil:
+		validationErr.Add("intro_price", "is required with intro_months")
+	}
+	if introPrice != nil && *introPrice < 0 {
+		validationErr.Add("intro_price", "must not be negative")
+	}
+	if introMonths != nil && (*introMonths < 1 || *introMonths > models.MaxPromoMonths) {
+		validationErr.Add("intro_months", monthsMessage)
+	}
+}
@@ -0,0 +1,109 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/NKV510/subscription-service/internal/models"
+	"github.com/google/uuid"
+)
+
+// CancelSubscription отменяет подписку: она заканчивается в последний день
+// месяца отмены (по умолчанию текущего), причина сохраняется для аналитики
+// оттока. Отмена может только сократить подписку, но не продлить ее
+func (s *SubscriptionService) CancelSubscription(
+	ctx context.Context,
+	id uuid.UUID,
+	req models.CancelSubscriptionRequest,
+	expectedVersion *int,
+) (*models.Subscription, error) {
+	subscription, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	validationErr := &models.ValidationError{}
+
+	now := time.Now()
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	if req.EffectiveMonth != nil {
+		parsed, err := time.Parse(monthLayout, *req.EffectiveMonth)
+		if err != nil {
+			validationErr.Add("effective_month", "invalid format, expected MM-YYYY")
+		}
+		month = parsed
+	}
+
+	if !models.IsCancelReason(req.ReasonCode) {
+		validationErr.Add("reason_code", "unsupported cancellation reason")
+	}
+	if req.ReasonText != nil && len([]rune(*req.ReasonText)) > models.MaxCancelReasonTextLength {
+		validationErr.Add("reason_text", "must be at most 1000 characters")
+	}
+
+	if len(validationErr.Fields) == 0 {
+		endDate := month.AddDate(0, 1, -1)
+		switch {
+		case endDate.Before(subscription.StartDate):
+			validationErr.Add("effective_month", "must not be before the month of start_date")
+		case subscription.EndDate != nil && endDate.After(*subscription.EndDate):
+			validationErr.Add("effective_month", "must not be after end_date")
+		}
+	}
+	if err := validationErr.Err(); err != nil {
+		return nil, err
+	}
+
+	return s.repo.Cancel(ctx, id, models.Cancellation{
+		EffectiveMonth: month,
+		ReasonCode:     req.ReasonCode,
+		ReasonText:     req.ReasonText,
+	}, expectedVersion)
+}
+
+// GetChurn возвращает отмены подписок, вступившие в силу в каждом месяце
+// периода, по причинам и по сервисам; месяцы без отмен тоже возвращаются
+func (s *SubscriptionService) GetChurn(ctx context.Context, req models.ChurnRequest) (*models.ChurnResponse, error) {
+	filter, err := s.spendFilter(ctx, req.From, req.To, req.UserID, req.ServiceName)
+	if err != nil {
+		return nil, err
+	}
+
+	counts, err := s.repo.GetCancellations(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &models.ChurnResponse{Months: make([]models.ChurnMonth, 0)}
+	last := time.Date(filter.To.Year(), filter.To.Month(), 1, 0, 0, 0, 0, time.UTC)
+	month := time.Date(filter.From.Year(), filter.From.Month(), 1, 0, 0, 0, 0, time.UTC)
+	for ; !month.After(last); month = month.AddDate(0, 1, 0) {
+		item := models.ChurnMonth{
+			Month:    models.MonthYear(month),
+			Reasons:  make(map[string]int),
+			Services: make([]models.ChurnService, 0),
+		}
+
+		// counts упорядочены по месяцу и сервису
+		for len(counts) > 0 && counts[0].Month.Equal(month) {
+			count := counts[0]
+			counts = counts[1:]
+
+			if n := len(item.Services); n == 0 || item.Services[n-1].ServiceName != count.ServiceName {
+				item.Services = append(item.Services, models.ChurnService{
+					ServiceName: count.ServiceName,
+					Reasons:     make(map[string]int),
+				})
+			}
+			group := &item.Services[len(item.Services)-1]
+			group.Cancellations += count.Count
+			group.Reasons[count.ReasonCode] += count.Count
+			item.Cancellations += count.Count
+			item.Reasons[count.ReasonCode] += count.Count
+		}
+
+		response.Months = append(response.Months, item)
+	}
+
+	return response, nil
+}
@@ -0,0 +1,162 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/NKV510/subscription-service/internal/models"
+	"github.com/google/uuid"
+)
+
+// CreateService добавляет сервис в каталог. Подписки без сервиса с его
+// названием или псевдонимом привязываются к нему
+func (s *SubscriptionService) CreateService(
+	ctx context.Context,
+	req models.CreateServiceRequest,
+) (*models.Service, error) {
+	validationErr := &models.ValidationError{}
+	name, aliases := checkServiceNames(validationErr, req.Name, req.Aliases)
+	if req.DefaultPrice != nil && *req.DefaultPrice < 1 {
+		validationErr.Add("default_price", "must be at least 1")
+	}
+	if err := validationErr.Err(); err != nil {
+		return nil, err
+	}
+
+	svc := &models.Service{Name: name, Aliases: aliases, DefaultPrice: req.DefaultPrice}
+	if err := s.repo.CreateService(ctx, svc); err != nil {
+		return nil, err
+	}
+	return svc, nil
+}
+
+func (s *SubscriptionService) GetService(ctx context.Context, id uuid.UUID) (*models.Service, error) {
+	return s.repo.GetService(ctx, id)
+}
+
+func (s *SubscriptionService) ListServices(ctx context.Context) ([]models.Service, error) {
+	return s.repo.ListServices(ctx)
+}
+
+// UpdateService меняет сервис каталога. Новое название получают и все
+// подписки сервиса; псевдонимы, если заданы, заменяются целиком
+func (s *SubscriptionService) UpdateService(
+	ctx context.Context,
+	id uuid.UUID,
+	req models.UpdateServiceRequest,
+) (*models.Service, error) {
+	svc, err := s.repo.GetService(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Name != nil {
+		svc.Name = *req.Name
+	}
+	if req.Aliases != nil {
+		svc.Aliases = *req.Aliases
+	}
+
+	validationErr := &models.ValidationError{}
+	svc.Name, svc.Aliases = checkServiceNames(validationErr, svc.Name, svc.Aliases)
+
+	// Ноль убирает цену по умолчанию
+	if req.DefaultPrice != nil {
+		svc.DefaultPrice = req.DefaultPrice
+		switch {
+		case *req.DefaultPrice == 0:
+			svc.DefaultPrice = nil
+		case *req.DefaultPrice < 1:
+			validationErr.Add("default_price", "must be at least 1")
+		}
+	}
+	if err := validationErr.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.UpdateService(ctx, svc); err != nil {
+		return nil, err
+	}
+	return svc, nil
+}
+
+// DeleteService удаляет сервис из каталога. Подписки сохраняют название, но
+// остаются без сервиса, как и новые подписки с этим названием
+func (s *SubscriptionService) DeleteService(ctx context.Context, id uuid.UUID) error {
+	return s.repo.DeleteService(ctx, id)
+}
+
+// checkServiceNames проверяет название и псевдонимы сервиса и возвращает их
+// без лишних пробелов. Псевдонимы, совпадающие с названием или друг с другом
+// без учета регистра, отбрасываются
+func checkServiceNames(validationErr *models.ValidationError, name string, aliases []string) (string, []string) {
+	name = models.CleanServiceName(name)
+	switch {
+	case name == "":
+		validationErr.Add("name", "is required")
+	case utf8.RuneCountInString(name) > models.MaxServiceNameLength:
+		validationErr.Add("name", fmt.Sprintf("must be at most %d characters", models.MaxServiceNameLength))
+	}
+
+	seen := map[string]bool{models.ServiceNameKey(name): true}
+	cleaned := make([]string, 0, len(aliases))
+	for _, alias := range aliases {
+		alias = models.CleanServiceName(alias)
+		switch {
+		case alias == "":
+			validationErr.Add("aliases", "must not contain empty names")
+			continue
+		case utf8.RuneCountInString(alias) > models.MaxServiceNameLength:
+			validationErr.Add("aliases", fmt.Sprintf("must be at most %d characters", models.MaxServiceNameLength))
+			continue
+		}
+
+		key := models.ServiceNameKey(alias)
+		if !seen[key] {
+			seen[key] = true
+			cleaned = append(cleaned, alias)
+		}
+	}
+	return name, cleaned
+}
+
+// findService ищет сервис каталога по названию или псевдониму; nil, если
+// такого сервиса в каталоге нет
+func (s *SubscriptionService) findService(ctx context.Context, name string) (*models.Service, error) {
+	if models.CleanServiceName(name) == "" {
+		return nil, nil
+	}
+
+	svc, err := s.repo.FindService(ctx, name)
+	if errors.Is(err, models.ErrNotFound) {
+		return nil, nil
+	}
+	return svc, err
+}
+
+// withDefaultPrice подставляет цену сервиса из каталога, если в запросе
+// цена не указана. Сам сервис подписки определяет хранилище в транзакции
+// ее сохранения
+func withDefaultPrice(req models.CreateSubscriptionRequest, svc *models.Service) models.CreateSubscriptionRequest {
+	if req.Price == 0 && svc != nil && svc.DefaultPrice != nil {
+		req.Price = *svc.DefaultPrice
+	}
+	return req
+}
+
+// canonicalServiceName приводит название сервиса из фильтра к названию из
+// каталога, под которым хранятся подписки. Название не из каталога
+// возвращается как есть
+func (s *SubscriptionService) canonicalServiceName(ctx context.Context, name *string) (*string, error) {
+	if name == nil {
+		return nil, nil
+	}
+
+	svc, err := s.findService(ctx, *name)
+	if err != nil || svc == nil {
+		return name, err
+	}
+	return &svc.Name, nil
+}
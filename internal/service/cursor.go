@@ -0,0 +1,46 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/NKV510/subscription-service/internal/models"
+)
+
+// encodeCursor упаковывает позицию в списке в непрозрачную для клиента строку
+func encodeCursor(cursor models.ListCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor разбирает курсор и проверяет, что он выдан для той же сортировки
+func decodeCursor(value, sortBy string, desc bool) (*models.ListCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid cursor", models.ErrValidation)
+	}
+
+	var cursor models.ListCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, fmt.Errorf("%w: invalid cursor", models.ErrValidation)
+	}
+
+	if cursor.SortBy != sortBy || cursor.Desc != desc {
+		return nil, fmt.Errorf("%w: cursor was issued for a different sort order", models.ErrValidation)
+	}
+
+	switch cursor.SortBy {
+	case models.SortByStartDate:
+		_, err = time.Parse("2006-01-02", cursor.Value)
+	case models.SortByPrice:
+		_, err = strconv.Atoi(cursor.Value)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid cursor", models.ErrValidation)
+	}
+
+	return &cursor, nil
+}
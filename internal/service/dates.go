@@ -0,0 +1,52 @@
+package service
+
+import (
+	"time"
+
+	"github.com/NKV510/subscription-service/internal/models"
+)
+
+// Форматы дат во входных данных: день в ISO 8601 или месяц целиком
+const (
+	dayLayout   = "2006-01-02"
+	monthLayout = "01-2006"
+)
+
+// dateFormatMessage текст ошибки для даты в неподдерживаемом формате
+const dateFormatMessage = "invalid format, expected YYYY-MM-DD or MM-YYYY"
+
+// parseStartDate разбирает дату начала периода: YYYY-MM-DD - этот день,
+// MM-YYYY - первый день месяца
+func parseStartDate(field, value string) (time.Time, error) {
+	if day, err := time.Parse(dayLayout, value); err == nil {
+		return day, nil
+	}
+
+	month, err := time.Parse(monthLayout, value)
+	if err != nil {
+		return time.Time{}, models.NewValidationError(field, dateFormatMessage)
+	}
+	return time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, time.UTC), nil
+}
+
+// parseEndDate разбирает дату конца периода: YYYY-MM-DD - этот день,
+// MM-YYYY - последний день месяца
+func parseEndDate(field, value string) (time.Time, error) {
+	if day, err := time.Parse(dayLayout, value); err == nil {
+		return day, nil
+	}
+
+	start, err := parseStartDate(field, value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return start.AddDate(0, 1, -1), nil
+}
+
+// checkDateOrder добавляет ошибку end_date, если подписка заканчивается
+// раньше, чем начинается
+func checkDateOrder(validationErr *models.ValidationError, start time.Time, end *time.Time) {
+	if end != nil && end.Before(start) {
+		validationErr.Add("end_date", "must not be before start_date")
+	}
+}
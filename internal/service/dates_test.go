@@ -0,0 +1,96 @@
+package service
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/NKV510/subscription-service/internal/models"
+)
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func TestParseDates(t *testing.T) {
+	tests := []struct {
+		value      string
+		start, end time.Time // нулевые - формат не поддерживается
+	}{
+		{"2025-07-15", date(2025, 7, 15), date(2025, 7, 15)},
+		{"07-2025", date(2025, 7, 1), date(2025, 7, 31)},
+		{"04-2025", date(2025, 4, 1), date(2025, 4, 30)},
+		{"12-2025", date(2025, 12, 1), date(2025, 12, 31)},
+		{"02-2024", date(2024, 2, 1), date(2024, 2, 29)},
+		{"02-2025", date(2025, 2, 1), date(2025, 2, 28)},
+		{"2024-02-29", date(2024, 2, 29), date(2024, 2, 29)},
+		{"2025-02-29", time.Time{}, time.Time{}},
+		{"13-2025", time.Time{}, time.Time{}},
+		{"7-2025", time.Time{}, time.Time{}},
+		{"2025-07", time.Time{}, time.Time{}},
+		{"15.07.2025", time.Time{}, time.Time{}},
+		{"2025-07-15T00:00:00Z", time.Time{}, time.Time{}},
+		{"", time.Time{}, time.Time{}},
+	}
+
+	parsers := []struct {
+		name  string
+		parse func(field, value string) (time.Time, error)
+		want  func(start, end time.Time) time.Time
+	}{
+		{"Start", parseStartDate, func(start, _ time.Time) time.Time { return start }},
+		{"End", parseEndDate, func(_, end time.Time) time.Time { return end }},
+	}
+
+	for _, parser := range parsers {
+		for _, tt := range tests {
+			t.Run(parser.name+"/"+tt.value, func(t *testing.T) {
+				got, err := parser.parse("field", tt.value)
+				want := parser.want(tt.start, tt.end)
+				if want.IsZero() {
+					if names := fieldNames(t, err); !slices.Equal(names, []string{"field"}) {
+						t.Errorf("invalid fields = %v, want [field]", names)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("parse %q: %v", tt.value, err)
+				}
+				if !got.Equal(want) {
+					t.Errorf("parse %q = %s, want %s", tt.value, got.Format(dayLayout), want.Format(dayLayout))
+				}
+			})
+		}
+	}
+}
+
+func TestCheckDateOrder(t *testing.T) {
+	start := date(2025, 7, 15)
+	tests := []struct {
+		name  string
+		end   *time.Time
+		valid bool
+	}{
+		{"NoEnd", nil, true},
+		{"SameDay", ptr(start), true},
+		{"NextDay", ptr(start.AddDate(0, 0, 1)), true},
+		{"DayBefore", ptr(start.AddDate(0, 0, -1)), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			validationErr := &models.ValidationError{}
+			checkDateOrder(validationErr, start, tt.end)
+			err := validationErr.Err()
+			if tt.valid {
+				if err != nil {
+					t.Errorf("checkDateOrder error = %v, want nil", err)
+				}
+				return
+			}
+			if names := fieldNames(t, err); !slices.Equal(names, []string{"end_date"}) {
+				t.Errorf("invalid fields = %v, want [end_date]", names)
+			}
+		})
+	}
+}
@@ -0,0 +1,232 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/NKV510/subscription-service/internal/models"
+)
+
+// currencyPattern код валюты ISO 4217 после приведения к верхнему регистру
+var currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// normalizeCurrency приводит код валюты к верхнему регистру и добавляет
+// ошибку поля, если это не код ISO 4217
+func normalizeCurrency(validationErr *models.ValidationError, field, value string) string {
+	currency := strings.ToUpper(strings.TrimSpace(value))
+	if !currencyPattern.MatchString(currency) {
+		validationErr.Add(field, "must be an ISO 4217 code")
+	}
+	return currency
+}
+
+// exchangeRateColumns колонки CSV с курсами, все обязательные
+var exchangeRateColumns = []string{"date", "from", "to", "rate"}
+
+// exchangeRateRow строка загрузки курсов; line - номер строки во входных данных
+type exchangeRateRow struct {
+	line int
+	req  models.ExchangeRateRequest
+}
+
+// ImportExchangeRates загружает курсы из CSV (с заголовком date, from, to,
+// rate) или NDJSON с одним ExchangeRateRequest в строке. Загрузка атомарна:
+// при ошибке хотя бы в одной строке ничего не сохраняется. Курс той же пары
+// на ту же дату заменяется, в том числе повторенный в самой загрузке
+func (s *SubscriptionService) ImportExchangeRates(
+	ctx context.Context,
+	format string,
+	r io.Reader,
+) (*models.ImportExchangeRatesResponse, error) {
+	var (
+		rows []exchangeRateRow
+		err  error
+	)
+	switch format {
+	case models.FormatCSV:
+		rows, err = readExchangeRatesCSV(r)
+	case models.FormatNDJSON:
+		rows, err = readExchangeRatesNDJSON(r)
+	default:
+		return nil, fmt.Errorf("%w: unsupported import format: %q", models.ErrValidation, format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("%w: import contains no rows", models.ErrValidation)
+	}
+
+	validationErr := &models.ValidationError{}
+	rates := make([]models.ExchangeRate, 0, len(rows))
+	positions := make(map[models.ExchangeRate]int, len(rows))
+	for _, row := range rows {
+		rate, ok := newExchangeRate(validationErr, row.line, row.req)
+		if !ok {
+			continue
+		}
+
+		key := rate
+		key.Rate = 0
+		if position, ok := positions[key]; ok {
+			rates[position] = rate
+			continue
+		}
+		positions[key] = len(rates)
+		rates = append(rates, rate)
+	}
+	if err := validationErr.Err(); err != nil {
+		slog.Warn("Invalid exchange rates", "error", err)
+		return nil, err
+	}
+
+	if err := s.repo.UpsertExchangeRates(ctx, rates); err != nil {
+		return nil, err
+	}
+
+	return &models.ImportExchangeRatesResponse{Imported: len(rates)}, nil
+}
+
+// newExchangeRate проверяет строку загрузки курсов. Ошибки добавляются в
+// validationErr с номером строки в тексте
+func newExchangeRate(
+	validationErr *models.ValidationError,
+	line int,
+	req models.ExchangeRateRequest,
+) (models.ExchangeRate, bool) {
+	rowErr := &models.ValidationError{}
+
+	date, err := parseStartDate("date", req.Date)
+	if err != nil {
+		rowErr.Merge(err)
+	}
+	from := normalizeCurrency(rowErr, "from", req.From)
+	to := normalizeCurrency(rowErr, "to", req.To)
+	if from == to && len(rowErr.Fields) == 0 {
+		rowErr.Add("to", "must differ from from")
+	}
+	if req.Rate <= 0 {
+		rowErr.Add("rate", "must be a positive number")
+	}
+
+	for _, field := range rowErr.Fields {
+		validationErr.Add(field.Field, fmt.Sprintf("line %d: %s", line, field.Message))
+	}
+	return models.ExchangeRate{Date: date, From: from, To: to, Rate: req.Rate}, len(rowErr.Fields) == 0
+}
+
+// readExchangeRatesCSV читает курсы из CSV с заголовком; порядок колонок
+// произвольный
+func readExchangeRatesCSV(r io.Reader) ([]exchangeRateRow, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid CSV header: %v", models.ErrValidation, err)
+	}
+
+	positions := make(map[string]int, len(header))
+	for i, name := range header {
+		positions[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	for _, name := range exchangeRateColumns {
+		if _, ok := positions[name]; !ok {
+			return nil, fmt.Errorf("%w: missing CSV column %q", models.ErrValidation, name)
+		}
+	}
+
+	var rows []exchangeRateRow
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid CSV: %v", models.ErrValidation, err)
+		}
+
+		field := func(name string) string {
+			return strings.TrimSpace(record[positions[name]])
+		}
+		row := exchangeRateRow{
+			req: models.ExchangeRateRequest{Date: field("date"), From: field("from"), To: field("to")},
+		}
+		row.line, _ = reader.FieldPos(0)
+		// Нечисловой курс остается нулевым и отклоняется проверкой строки
+		row.req.Rate, _ = strconv.ParseFloat(field("rate"), 64)
+
+		rows = append(rows, row)
+		if len(rows) > maxImportRows {
+			return nil, fmt.Errorf("%w: import is limited to %d rows", models.ErrValidation, maxImportRows)
+		}
+	}
+
+	return rows, nil
+}
+
+// readExchangeRatesNDJSON читает по одному ExchangeRateRequest в строке.
+// Пустые строки пропускаются
+func readExchangeRatesNDJSON(r io.Reader) ([]exchangeRateRow, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 4096), maxNDJSONLineSize)
+
+	var rows []exchangeRateRow
+	for line := 1; scanner.Scan(); line++ {
+		data := strings.TrimSpace(scanner.Text())
+		if data == "" {
+			continue
+		}
+
+		row := exchangeRateRow{line: line}
+		if err := json.Unmarshal([]byte(data), &row.req); err != nil {
+			return nil, fmt.Errorf("%w: line %d: invalid JSON: %v", models.ErrValidation, line, err)
+		}
+
+		rows = append(rows, row)
+		if len(rows) > maxImportRows {
+			return nil, fmt.Errorf("%w: import is limited to %d rows", models.ErrValidation, maxImportRows)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%w: failed to read NDJSON: %v", models.ErrValidation, err)
+	}
+
+	return rows, nil
+}
+
+// ListExchangeRates возвращает загруженные курсы, при необходимости только
+// для указанных валют
+func (s *SubscriptionService) ListExchangeRates(
+	ctx context.Context,
+	req models.ListExchangeRatesRequest,
+) ([]models.ExchangeRate, error) {
+	validationErr := &models.ValidationError{}
+	filter := models.ExchangeRateFilter{}
+	if req.From != nil {
+		from := normalizeCurrency(validationErr, "from", *req.From)
+		filter.From = &from
+	}
+	if req.To != nil {
+		to := normalizeCurrency(validationErr, "to", *req.To)
+		filter.To = &to
+	}
+	if err := validationErr.Err(); err != nil {
+		return nil, err
+	}
+
+	return s.repo.ListExchangeRates(ctx, filter)
+}
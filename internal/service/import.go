@@ -0,0 +1,300 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/NKV510/subscription-service/internal/models"
+	"github.com/google/uuid"
+)
+
+// maxImportRows максимальное число строк в одном импорте
+const maxImportRows = 10000
+
+// importColumns обязательные колонки CSV, совпадающие с полями
+// CreateSubscriptionRequest; optionalImportColumns - необязательные
+var (
+	importColumns         = []string{"service_name", "price", "user_id", "start_date"}
+	optionalImportColumns = []string{
+		"currency", "end_date", "billing_period", "billing_interval_months", "trial_months", "intro_price", "intro_months",
+	}
+)
+
+// importRow строка импорта: запрос на создание или ошибка разбора строки
+type importRow struct {
+	line int
+	req  models.CreateSubscriptionRequest
+	err  error
+}
+
+// ImportSubscriptions создает подписки из CSV (с заголовком) или NDJSON.
+// Каждая строка проверяется так же, как запрос на создание. В режиме atomic
+// при ошибке хотя бы в одной строке ничего не сохраняется, в режиме
+// best_effort сохраняются все корректные строки. Ошибки отдельных строк
+// возвращаются в отчете, ошибка - только если импорт не удалось выполнить
+func (s *SubscriptionService) ImportSubscriptions(
+	ctx context.Context,
+	format string,
+	mode string,
+	r io.Reader,
+) (*models.ImportSubscriptionsResponse, error) {
+	if mode == "" {
+		mode = models.ImportModeAtomic
+	}
+	if mode != models.ImportModeAtomic && mode != models.ImportModeBestEffort {
+		return nil, fmt.Errorf("%w: unsupported import mode: %s", models.ErrValidation, mode)
+	}
+
+	var (
+		rows []importRow
+		err  error
+	)
+	switch format {
+	case models.FormatCSV:
+		rows, err = readCSVRows(r)
+	case models.FormatNDJSON:
+		rows, err = readNDJSONRows(r)
+	default:
+		return nil, fmt.Errorf("%w: unsupported import format: %q", models.ErrValidation, format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("%w: import contains no rows", models.ErrValidation)
+	}
+
+	result := &models.ImportSubscriptionsResponse{
+		Mode:  mode,
+		Total: len(rows),
+		Rows:  make([]models.ImportRowResult, len(rows)),
+	}
+
+	// valid индексы строк, подписки которых будут сохранены; catalog сервисы
+	// каталога по ключу названия, nil - сервиса в каталоге нет
+	var (
+		subscriptions []*models.Subscription
+		valid         []int
+		catalog       = make(map[string]*models.Service)
+	)
+	for i, row := range rows {
+		result.Rows[i].Line = row.line
+
+		key := models.ServiceNameKey(row.req.ServiceName)
+		svc, found := catalog[key]
+		if !found && row.err == nil {
+			if svc, err = s.findService(ctx, row.req.ServiceName); err != nil {
+				return nil, err
+			}
+			catalog[key] = svc
+		}
+
+		sub, err := row.subscription(svc)
+		if err != nil {
+			result.Rows[i].Error = err.Error()
+			var validationErr *models.ValidationError
+			if errors.As(err, &validationErr) {
+				result.Rows[i].Fields = validationErr.Fields
+			}
+			result.Failed++
+			continue
+		}
+		subscriptions = append(subscriptions, sub)
+		valid = append(valid, i)
+	}
+
+	if len(subscriptions) == 0 || (mode == models.ImportModeAtomic && result.Failed > 0) {
+		slog.Warn("Import rejected", "mode", mode, "total", result.Total, "failed", result.Failed)
+		return result, nil
+	}
+
+	if err := s.repo.CreateBatch(ctx, subscriptions); err != nil {
+		return nil, err
+	}
+
+	for i, sub := range subscriptions {
+		id := sub.ID
+		result.Rows[valid[i]].ID = &id
+	}
+	result.Imported = len(subscriptions)
+
+	slog.Info("Subscriptions imported", "mode", mode, "imported", result.Imported, "failed", result.Failed)
+	return result, nil
+}
+
+// subscription собирает подписку строки; svc - сервис строки из каталога,
+// цена которого подставляется, если в строке она не указана
+func (row importRow) subscription(svc *models.Service) (*models.Subscription, error) {
+	if row.err != nil {
+		return nil, row.err
+	}
+	return newSubscription(withDefaultPrice(row.req, svc))
+}
+
+// readCSVRows читает CSV с заголовком. Порядок колонок произвольный,
+// все колонки importColumns обязательны
+func readCSVRows(r io.Reader) ([]importRow, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid CSV header: %v", models.ErrValidation, err)
+	}
+
+	positions := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if !slices.Contains(importColumns, name) && !slices.Contains(optionalImportColumns, name) {
+			return nil, fmt.Errorf("%w: unknown CSV column %q", models.ErrValidation, name)
+		}
+		positions[name] = i
+	}
+	for _, name := range importColumns {
+		if _, ok := positions[name]; !ok {
+			return nil, fmt.Errorf("%w: missing CSV column %q", models.ErrValidation, name)
+		}
+	}
+
+	var rows []importRow
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		var (
+			row      importRow
+			parseErr *csv.ParseError
+		)
+		switch {
+		case errors.As(err, &parseErr) && errors.Is(parseErr.Err, csv.ErrFieldCount):
+			// Строка с другим числом полей - ошибка строки, а не всего файла
+			row.line = parseErr.StartLine
+			row.err = fmt.Errorf("%w: expected %d fields, got %d", models.ErrValidation, len(header), len(record))
+		case err != nil:
+			return nil, fmt.Errorf("%w: invalid CSV: %v", models.ErrValidation, err)
+		default:
+			row.line, _ = reader.FieldPos(0)
+			row.req, row.err = parseCSVRecord(record, positions)
+		}
+
+		rows = append(rows, row)
+		if len(rows) > maxImportRows {
+			return nil, fmt.Errorf("%w: import is limited to %d rows", models.ErrValidation, maxImportRows)
+		}
+	}
+
+	return rows, nil
+}
+
+func parseCSVRecord(record []string, positions map[string]int) (models.CreateSubscriptionRequest, error) {
+	field := func(name string) string {
+		return strings.TrimSpace(record[positions[name]])
+	}
+
+	optional := func(name string) string {
+		if _, ok := positions[name]; !ok {
+			return ""
+		}
+		return field(name)
+	}
+
+	req := models.CreateSubscriptionRequest{
+		ServiceName:   field("service_name"),
+		Currency:      optional("currency"),
+		StartDate:     field("start_date"),
+		BillingPeriod: optional("billing_period"),
+	}
+
+	if endDate := optional("end_date"); endDate != "" {
+		req.EndDate = &endDate
+	}
+
+	validationErr := &models.ValidationError{}
+
+	optionalInts := []struct {
+		name string
+		dest **int
+	}{
+		{"billing_interval_months", &req.BillingIntervalMonths},
+		{"trial_months", &req.TrialMonths},
+		{"intro_price", &req.IntroPrice},
+		{"intro_months", &req.IntroMonths},
+	}
+	for _, column := range optionalInts {
+		value := optional(column.name)
+		if value == "" {
+			continue
+		}
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			validationErr.Add(column.name, "must be an integer")
+			continue
+		}
+		*column.dest = &parsed
+	}
+
+	// Пустая цена заменяется ценой сервиса из каталога
+	if price := field("price"); price != "" {
+		parsed, err := strconv.Atoi(price)
+		if err != nil {
+			validationErr.Add("price", "must be an integer")
+		}
+		req.Price = parsed
+	}
+
+	userID, err := uuid.Parse(field("user_id"))
+	if err != nil {
+		validationErr.Add("user_id", "must be a UUID")
+	}
+	req.UserID = userID
+
+	return req, validationErr.Err()
+}
+
+// maxNDJSONLineSize максимальная длина строки NDJSON
+const maxNDJSONLineSize = 64 * 1024
+
+// readNDJSONRows читает по одному объекту CreateSubscriptionRequest в строке.
+// Пустые строки пропускаются
+func readNDJSONRows(r io.Reader) ([]importRow, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 4096), maxNDJSONLineSize)
+
+	var rows []importRow
+	for line := 1; scanner.Scan(); line++ {
+		data := strings.TrimSpace(scanner.Text())
+		if data == "" {
+			continue
+		}
+
+		row := importRow{line: line}
+		if err := json.Unmarshal([]byte(data), &row.req); err != nil {
+			row.err = fmt.Errorf("%w: invalid JSON: %v", models.ErrValidation, err)
+		}
+
+		rows = append(rows, row)
+		if len(rows) > maxImportRows {
+			return nil, fmt.Errorf("%w: import is limited to %d rows", models.ErrValidation, maxImportRows)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%w: failed to read NDJSON: %v", models.ErrValidation, err)
+	}
+
+	return rows, nil
+}
@@ -0,0 +1,312 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/NKV510/subscription-service/internal/models"
+	"github.com/google/uuid"
+)
+
+const importUserID = "7c9e6679-7425-40de-944b-e07fc1f90ae7"
+
+// csvRows возвращает n одинаковых строк CSV без заголовка
+func csvRows(n int) string {
+	return strings.Repeat("Netflix,700,"+importUserID+",01-2025\n", n)
+}
+
+func TestReadCSVRows(t *testing.T) {
+	header := "service_name,price,user_id,start_date\n"
+
+	tests := []struct {
+		name    string
+		input   string
+		lines   []int
+		invalid []int // номера строк с ошибкой
+		count   int   // число строк, если lines не проверяются
+		wantErr string
+	}{
+		{name: "Empty", input: ""},
+		{name: "HeaderOnly", input: header},
+		{
+			name:  "BOM",
+			input: "\ufeff" + header + csvRows(1),
+			lines: []int{2},
+		},
+		{
+			name:  "ReorderedColumns",
+			input: "Start_Date, USER_ID ,price,service_name,currency\n01-2025," + importUserID + ",700,Netflix,usd\n",
+			lines: []int{2},
+		},
+		{
+			name:    "UnknownColumn",
+			input:   "service_name,price,user_id,start_date,comment\n",
+			wantErr: `unknown CSV column "comment"`,
+		},
+		{
+			name:    "MissingColumn",
+			input:   "service_name,user_id,start_date\n",
+			wantErr: `missing CSV column "price"`,
+		},
+		{
+			name:    "FieldCount",
+			input:   header + csvRows(1) + "Netflix,700\n" + csvRows(1),
+			lines:   []int{2, 3, 4},
+			invalid: []int{3},
+		},
+		{
+			name:    "InvalidRow",
+			input:   header + "Netflix,abc," + importUserID + ",01-2025\n",
+			lines:   []int{2},
+			invalid: []int{2},
+		},
+		{
+			name:    "BrokenQuotes",
+			input:   header + `"Netflix,700,` + importUserID + ",01-2025\n",
+			wantErr: "invalid CSV",
+		},
+		{
+			name:  "RowLimit",
+			input: header + csvRows(maxImportRows),
+			count: maxImportRows,
+		},
+		{
+			name:    "OverRowLimit",
+			input:   header + csvRows(maxImportRows+1),
+			wantErr: "import is limited to 10000 rows",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := readCSVRows(strings.NewReader(tt.input))
+			if tt.wantErr != "" {
+				if !errors.Is(err, models.ErrValidation) || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("readCSVRows error = %v, want validation error %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readCSVRows: %v", err)
+			}
+
+			if tt.count > 0 {
+				if len(rows) != tt.count {
+					t.Errorf("rows = %d, want %d", len(rows), tt.count)
+				}
+				return
+			}
+
+			var lines, invalid []int
+			for _, row := range rows {
+				lines = append(lines, row.line)
+				if row.err != nil {
+					invalid = append(invalid, row.line)
+					if !errors.Is(row.err, models.ErrValidation) {
+						t.Errorf("line %d error = %v, want models.ErrValidation", row.line, row.err)
+					}
+				}
+			}
+			if !slices.Equal(lines, tt.lines) || !slices.Equal(invalid, tt.invalid) {
+				t.Errorf("lines = %v with errors in %v, want %v with errors in %v", lines, invalid, tt.lines, tt.invalid)
+			}
+		})
+	}
+}
+
+func TestParseCSVRecord(t *testing.T) {
+	positions := map[string]int{
+		"service_name": 0, "price": 1, "user_id": 2, "start_date": 3, "end_date": 4, "trial_months": 5,
+	}
+
+	tests := []struct {
+		name   string
+		record []string
+		want   models.CreateSubscriptionRequest
+		fields []string
+	}{
+		{
+			name:   "Valid",
+			record: []string{" Netflix ", "700", importUserID, "01-2025", "03-2025", "1"},
+			want: models.CreateSubscriptionRequest{
+				ServiceName: "Netflix",
+				Price:       700,
+				UserID:      uuid.MustParse(importUserID),
+				StartDate:   "01-2025",
+				EndDate:     ptr("03-2025"),
+				TrialMonths: ptr(1),
+			},
+		},
+		{
+			// Пустая цена остается нулевой, ее подставит каталог
+			name:   "EmptyPrice",
+			record: []string{"Netflix", "", importUserID, "01-2025", "", ""},
+			want: models.CreateSubscriptionRequest{
+				ServiceName: "Netflix",
+				UserID:      uuid.MustParse(importUserID),
+				StartDate:   "01-2025",
+			},
+		},
+		{
+			name:   "InvalidNumbers",
+			record: []string{"Netflix", "7e2", "user", "01-2025", "", "one"},
+			fields: []string{"trial_months", "price", "user_id"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := parseCSVRecord(tt.record, positions)
+			if tt.fields != nil {
+				if got := fieldNames(t, err); !slices.Equal(got, tt.fields) {
+					t.Errorf("invalid fields = %v, want %v", got, tt.fields)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseCSVRecord: %v", err)
+			}
+			if req.ServiceName != tt.want.ServiceName || req.Price != tt.want.Price || req.UserID != tt.want.UserID ||
+				req.StartDate != tt.want.StartDate {
+				t.Errorf("request = %+v, want %+v", req, tt.want)
+			}
+			if !equalPtr(req.EndDate, tt.want.EndDate) || !equalPtr(req.TrialMonths, tt.want.TrialMonths) {
+				t.Errorf("end_date, trial_months = %v, %v, want %v, %v",
+					req.EndDate, req.TrialMonths, tt.want.EndDate, tt.want.TrialMonths)
+			}
+		})
+	}
+}
+
+func equalPtr[T comparable](a, b *T) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func TestReadNDJSONRows(t *testing.T) {
+	row := `{"service_name": "Netflix", "price": 700, "user_id": "` + importUserID + `", "start_date": "01-2025"}` + "\n"
+
+	tests := []struct {
+		name    string
+		input   string
+		lines   []int
+		invalid []int
+		wantErr string
+	}{
+		{name: "Empty", input: "\n \n"},
+		{name: "BlankLines", input: row + "\n" + row, lines: []int{1, 3}},
+		{name: "InvalidJSON", input: row + `{"service_name": ` + "\n" + row, lines: []int{1, 2, 3}, invalid: []int{2}},
+		{name: "WrongType", input: `{"price": "700"}`, lines: []int{1}, invalid: []int{1}},
+		{name: "LongLine", input: `{"service_name": "` + strings.Repeat("a", maxNDJSONLineSize) + `"}`, wantErr: "failed to read NDJSON"},
+		{name: "OverRowLimit", input: strings.Repeat(row, maxImportRows+1), wantErr: "import is limited to 10000 rows"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := readNDJSONRows(strings.NewReader(tt.input))
+			if tt.wantErr != "" {
+				if !errors.Is(err, models.ErrValidation) || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("readNDJSONRows error = %v, want validation error %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readNDJSONRows: %v", err)
+			}
+
+			var lines, invalid []int
+			for _, row := range rows {
+				lines = append(lines, row.line)
+				if row.err != nil {
+					invalid = append(invalid, row.line)
+				}
+			}
+			if !slices.Equal(lines, tt.lines) || !slices.Equal(invalid, tt.invalid) {
+				t.Errorf("lines = %v with errors in %v, want %v with errors in %v", lines, invalid, tt.lines, tt.invalid)
+			}
+		})
+	}
+}
+
+func TestImportSubscriptions(t *testing.T) {
+	input := "service_name,price,user_id,start_date\n" +
+		"Yandex Plus,," + importUserID + ",01-2025\n" +
+		"Netflix,700," + importUserID + ",01-2025\n" +
+		"Netflix,700," + importUserID + ",2025\n" +
+		"Spotify,," + importUserID + ",01-2025\n"
+
+	tests := []struct {
+		name     string
+		mode     string
+		imported int
+		prices   []int // цены сохраненных подписок в порядке строк
+	}{
+		{name: "DefaultAtomic", mode: "", imported: 0},
+		{name: "Atomic", mode: models.ImportModeAtomic, imported: 0},
+		{name: "BestEffort", mode: models.ImportModeBestEffort, imported: 2, prices: []int{299, 700}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			s := newTestService(t)
+			if _, err := s.CreateService(ctx, models.CreateServiceRequest{Name: "Yandex Plus", DefaultPrice: ptr(299)}); err != nil {
+				t.Fatalf("CreateService: %v", err)
+			}
+
+			result, err := s.ImportSubscriptions(ctx, models.FormatCSV, tt.mode, strings.NewReader(input))
+			if err != nil {
+				t.Fatalf("ImportSubscriptions: %v", err)
+			}
+			if result.Total != 4 || result.Failed != 2 || result.Imported != tt.imported {
+				t.Errorf("result = total %d, failed %d, imported %d, want 4, 2, %d",
+					result.Total, result.Failed, result.Imported, tt.imported)
+			}
+
+			// В строке 4 неверная дата, у строки 5 нет цены ни в файле, ни в каталоге
+			var failed []int
+			for _, row := range result.Rows {
+				if row.Error != "" {
+					failed = append(failed, row.Line)
+				}
+			}
+			if !slices.Equal(failed, []int{4, 5}) {
+				t.Errorf("failed lines = %v, want [4 5]", failed)
+			}
+
+			var prices []int
+			for _, row := range result.Rows {
+				if row.ID == nil {
+					continue
+				}
+				sub, err := s.GetSubscriptionByID(ctx, *row.ID)
+				if err != nil {
+					t.Fatalf("GetSubscriptionByID: %v", err)
+				}
+				prices = append(prices, sub.Price)
+			}
+			if !slices.Equal(prices, tt.prices) {
+				t.Errorf("imported prices = %v, want %v", prices, tt.prices)
+			}
+
+			userID := uuid.MustParse(importUserID)
+			subs, _, err := s.ListSubscriptions(ctx, models.ListSubscriptionsRequest{UserID: &userID})
+			if err != nil {
+				t.Fatalf("ListSubscriptions: %v", err)
+			}
+			if len(subs) != tt.imported {
+				t.Errorf("stored subscriptions = %d, want %d", len(subs), tt.imported)
+			}
+		})
+	}
+
+	_, err := newTestService(t).ImportSubscriptions(context.Background(), models.FormatCSV, "partial", strings.NewReader(input))
+	if !errors.Is(err, models.ErrValidation) {
+		t.Errorf("ImportSubscriptions with an unknown mode error = %v, want models.ErrValidation", err)
+	}
+}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/NKV510/subscription-service/internal/models"
+	"github.com/google/uuid"
+)
+
+// PauseSubscription приостанавливает подписку с указанной даты (для
+// MM-YYYY - с первого дня месяца), по умолчанию с сегодняшнего дня.
+// Списания, приходящиеся на приостановку, не учитываются в аналитике
+func (s *SubscriptionService) PauseSubscription(
+	ctx context.Context,
+	id uuid.UUID,
+	req models.PauseSubscriptionRequest,
+	expectedVersion *int,
+) (*models.Subscription, error) {
+	subscription, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	from, err := pauseDate(req.From)
+	if err != nil {
+		return nil, err
+	}
+
+	validationErr := &models.ValidationError{}
+	switch {
+	case from.Before(subscription.StartDate):
+		validationErr.Add("from", "must not be before start_date")
+	case subscription.EndDate != nil && from.After(*subscription.EndDate):
+		validationErr.Add("from", "must not be after end_date")
+	}
+	if err := validationErr.Err(); err != nil {
+		return nil, err
+	}
+
+	return s.repo.Pause(ctx, id, from, expectedVersion)
+}
+
+// ResumeSubscription возобновляет приостановленную подписку с указанной
+// даты, по умолчанию с сегодняшнего дня. Списания продолжаются с ближайшего
+// начала периода оплаты, считая от start_date
+func (s *SubscriptionService) ResumeSubscription(
+	ctx context.Context,
+	id uuid.UUID,
+	req models.ResumeSubscriptionRequest,
+	expectedVersion *int,
+) (*models.Subscription, error) {
+	from, err := pauseDate(req.From)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.repo.Resume(ctx, id, from, expectedVersion)
+}
+
+// pauseDate разбирает дату приостановки или возобновления; без значения -
+// сегодняшний день
+func pauseDate(value *string) (time.Time, error) {
+	if value == nil {
+		now := time.Now()
+		return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC), nil
+	}
+	return parseStartDate("from", *value)
+}
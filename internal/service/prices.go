@@ -0,0 +1,75 @@
+package service
+
+import (
+	"context"
+
+	"github.com/NKV510/subscription-service/internal/models"
+	"github.com/google/uuid"
+)
+
+// SchedulePriceChange планирует изменение цены подписки с указанной даты
+// (для MM-YYYY - с первого дня месяца). Дата может быть и в прошлом, чтобы
+// задним числом отразить уже случившееся повышение. Изменение с той же
+// даты заменяет ранее запланированное. Возвращает все цены подписки и ее
+// новое состояние
+func (s *SubscriptionService) SchedulePriceChange(
+	ctx context.Context,
+	id uuid.UUID,
+	req models.SchedulePriceChangeRequest,
+	expectedVersion *int,
+) ([]models.PriceChange, *models.Subscription, error) {
+	subscription, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	validationErr := &models.ValidationError{}
+	if req.Price < 1 {
+		validationErr.Add("price", "must be at least 1")
+	}
+	effectiveFrom, err := parseStartDate("effective_from", req.EffectiveFrom)
+	if err != nil {
+		validationErr.Merge(err)
+	} else {
+		// Цену с start_date задает сама подписка
+		switch {
+		case !effectiveFrom.After(subscription.StartDate):
+			validationErr.Add("effective_from", "must be after start_date")
+		case subscription.EndDate != nil && effectiveFrom.After(*subscription.EndDate):
+			validationErr.Add("effective_from", "must not be after end_date")
+		}
+	}
+	if err := validationErr.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	change := models.PriceChange{EffectiveFrom: effectiveFrom, Price: req.Price}
+	repriced, err := s.repo.SchedulePriceChange(ctx, id, change, expectedVersion)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	prices, err := s.GetSubscriptionPrices(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	return prices, repriced, nil
+}
+
+// GetSubscriptionPrices возвращает цены подписки в порядке вступления в
+// силу: цену на start_date и все запланированные изменения
+func (s *SubscriptionService) GetSubscriptionPrices(ctx context.Context, id uuid.UUID) ([]models.PriceChange, error) {
+	subscription, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := s.repo.GetPriceChanges(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	prices := make([]models.PriceChange, 0, len(changes)+1)
+	prices = append(prices, models.PriceChange{EffectiveFrom: subscription.StartDate, Price: subscription.Price})
+	return append(prices, changes...), nil
+}
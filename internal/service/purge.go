@@ -0,0 +1,48 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// PurgeDeletedSubscriptions окончательно удаляет подписки, удаленные
+// больше retention назад, и возвращает их количество. Заодно удаляет
+// истекшие ключи идемпотентности: они уже не защищают от повторов
+func (s *SubscriptionService) PurgeDeletedSubscriptions(ctx context.Context, retention time.Duration) (int64, error) {
+	if retention <= 0 {
+		return 0, fmt.Errorf("purge retention must be positive, got %s", retention)
+	}
+
+	now := time.Now()
+	purged, err := s.repo.Purge(ctx, now.Add(-retention))
+	if err != nil {
+		return 0, err
+	}
+	if _, err := s.repo.PurgeIdempotencyKeys(ctx, now); err != nil {
+		return purged, err
+	}
+	return purged, nil
+}
+
+// RunPurge очищает удаленные подписки каждые interval, пока не отменен ctx.
+// Ошибки очистки логируются, следующая попытка будет на следующем тике
+func (s *SubscriptionService) RunPurge(ctx context.Context, interval, retention time.Duration) {
+	slog.Info("Starting purge of deleted subscriptions", "interval", interval, "retention", retention)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info("Purge of deleted subscriptions stopped")
+			return
+		case <-ticker.C:
+			if _, err := s.PurgeDeletedSubscriptions(ctx, retention); err != nil && ctx.Err() == nil {
+				slog.Error("Failed to purge deleted subscriptions", "error", err)
+			}
+		}
+	}
+}
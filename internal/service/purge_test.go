@@ -0,0 +1,44 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/NKV510/subscription-service/internal/models"
+	"github.com/NKV510/subscription-service/internal/repository/memory"
+	"github.com/google/uuid"
+)
+
+func TestPurgeDeletedSubscriptions(t *testing.T) {
+	ctx := context.Background()
+	repo := memory.NewSubscriptionRepository()
+	req := models.CreateSubscriptionRequest{ServiceName: "Netflix", Price: 700, UserID: uuid.New(), StartDate: "01-2025"}
+
+	expired := NewSubscriptionService(repo, -time.Second)
+	if _, _, err := expired.CreateSubscriptionIdempotent(ctx, uuid.NewString(), req); err != nil {
+		t.Fatalf("CreateSubscriptionIdempotent: %v", err)
+	}
+	s := NewSubscriptionService(repo, time.Hour)
+	liveKey := uuid.NewString()
+	live, _, err := s.CreateSubscriptionIdempotent(ctx, liveKey, req)
+	if err != nil {
+		t.Fatalf("CreateSubscriptionIdempotent: %v", err)
+	}
+
+	if _, err := s.PurgeDeletedSubscriptions(ctx, 0); err == nil {
+		t.Error("PurgeDeletedSubscriptions with zero retention succeeded")
+	}
+	if _, err := s.PurgeDeletedSubscriptions(ctx, time.Hour); err != nil {
+		t.Fatalf("PurgeDeletedSubscriptions: %v", err)
+	}
+
+	// Истекший ключ удален, неистекший продолжает отвечать на повторы
+	if purged, err := repo.PurgeIdempotencyKeys(ctx, time.Now()); err != nil || purged != 0 {
+		t.Errorf("expired keys left after purge = %d, %v, want 0", purged, err)
+	}
+	sub, replayed, err := s.CreateSubscriptionIdempotent(ctx, liveKey, req)
+	if err != nil || !replayed || sub.ID != live.ID {
+		t.Errorf("retry with a live key = %v, replayed %t, %v, want the replay of %s", sub, replayed, err, live.ID)
+	}
+}
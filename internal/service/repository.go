@@ -0,0 +1,69 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/NKV510/subscription-service/internal/models"
+	"github.com/google/uuid"
+)
+
+// SubscriptionRepository хранилище подписок, с которым работает сервис.
+// Реализации: postgres.SubscriptionRepository и memory.SubscriptionRepository
+type SubscriptionRepository interface {
+	Create(ctx context.Context, sub *models.Subscription) error
+	CreateIdempotent(
+		ctx context.Context,
+		sub *models.Subscription,
+		key models.IdempotencyKey,
+	) (*models.StoredResponse, error)
+	GetIdempotentResponse(ctx context.Context, key string) (*models.StoredResponse, error)
+	PurgeIdempotencyKeys(ctx context.Context, expiredBefore time.Time) (int64, error)
+	CreateBatch(ctx context.Context, subs []*models.Subscription) error
+	GetByID(ctx context.Context, id uuid.UUID) (*models.Subscription, error)
+	Update(ctx context.Context, sub *models.Subscription) error
+	Delete(ctx context.Context, id uuid.UUID, expectedVersion *int) error
+	Restore(ctx context.Context, id uuid.UUID) (*models.Subscription, error)
+	Purge(ctx context.Context, deletedBefore time.Time) (int64, error)
+	List(ctx context.Context, filter models.SubscriptionFilter) ([]*models.Subscription, error)
+	Export(ctx context.Context, filter models.SubscriptionFilter, fn func(sub *models.Subscription) error) error
+	GetHistory(ctx context.Context, id uuid.UUID) ([]models.SubscriptionEvent, error)
+	Pause(ctx context.Context, id uuid.UUID, from time.Time, expectedVersion *int) (*models.Subscription, error)
+	Resume(ctx context.Context, id uuid.UUID, from time.Time, expectedVersion *int) (*models.Subscription, error)
+	Cancel(ctx context.Context, id uuid.UUID, cancellation models.Cancellation, expectedVersion *int) (*models.Subscription, error)
+	SchedulePriceChange(
+		ctx context.Context,
+		id uuid.UUID,
+		change models.PriceChange,
+		expectedVersion *int,
+	) (*models.Subscription, error)
+	GetPriceChanges(ctx context.Context, id uuid.UUID) ([]models.PriceChange, error)
+
+	GetTotalSpent(ctx context.Context, filter models.SpendFilter) (int, error)
+	GetSpendCurrencies(ctx context.Context, filter models.SpendFilter) ([]string, error)
+	ListCharges(ctx context.Context, filter models.SpendFilter) ([]models.Charge, error)
+	GetMonthlySpent(ctx context.Context, filter models.SpendFilter) ([]models.MonthlySpent, error)
+	GetCancellations(ctx context.Context, filter models.SpendFilter) ([]models.CancellationCount, error)
+	GetSpentBreakdown(
+		ctx context.Context,
+		filter models.SpendFilter,
+		groupBy []string,
+		limit int,
+	) ([]models.SpentGroup, error)
+
+	CreateService(ctx context.Context, svc *models.Service) error
+	GetService(ctx context.Context, id uuid.UUID) (*models.Service, error)
+	FindService(ctx context.Context, name string) (*models.Service, error)
+	ListServices(ctx context.Context) ([]models.Service, error)
+	UpdateService(ctx context.Context, svc *models.Service) error
+	DeleteService(ctx context.Context, id uuid.UUID) error
+
+	CreateTag(ctx context.Context, tag *models.Tag) error
+	RenameTag(ctx context.Context, tag *models.Tag) error
+	DeleteTag(ctx context.Context, id uuid.UUID) error
+	ListTags(ctx context.Context, userID *uuid.UUID) ([]models.Tag, error)
+	SetTags(ctx context.Context, id uuid.UUID, names []string, expectedVersion *int) (*models.Subscription, error)
+
+	UpsertExchangeRates(ctx context.Context, rates []models.ExchangeRate) error
+	ListExchangeRates(ctx context.Context, filter models.ExchangeRateFilter) ([]models.ExchangeRate, error)
+}
@@ -2,44 +2,41 @@ package service
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"log/slog"
+	"strings"
 	"time"
 
 	"github.com/NKV510/subscription-service/internal/models"
-	"github.com/NKV510/subscription-service/internal/repository/postgres"
 	"github.com/google/uuid"
 )
 
 type SubscriptionService struct {
-	repo *postgres.SubscriptionRepository
+	repo           SubscriptionRepository
+	idempotencyTTL time.Duration
 }
 
-func NewSubscriptionService(repo *postgres.SubscriptionRepository) *SubscriptionService {
-	return &SubscriptionService{repo: repo}
+// NewSubscriptionService создает сервис. idempotencyTTL - сколько хранится
+// ответ на запрос создания с заголовком Idempotency-Key
+func NewSubscriptionService(repo SubscriptionRepository, idempotencyTTL time.Duration) *SubscriptionService {
+	return &SubscriptionService{repo: repo, idempotencyTTL: idempotencyTTL}
 }
 
 func (s *SubscriptionService) CreateSubscription(
 	ctx context.Context,
 	req models.CreateSubscriptionRequest,
 ) (*models.Subscription, error) {
-	// Парсим дату из формата "MM-YYYY"
-	startDate, err := time.Parse("01-2006", req.StartDate)
+	svc, err := s.findService(ctx, req.ServiceName)
 	if err != nil {
-		slog.Error("Invalid start date format", "date", req.StartDate, "error", err)
-		return nil, fmt.Errorf("invalid start date format, expected MM-YYYY: %w", err)
+		return nil, err
 	}
 
-	// Устанавливаем начало месяца
-	startDate = time.Date(startDate.Year(), startDate.Month(), 1, 0, 0, 0, 0, time.UTC)
-
-	subscription := &models.Subscription{
-		ID:          uuid.New(),
-		ServiceName: req.ServiceName,
-		Price:       req.Price,
-		UserID:      req.UserID,
-		StartDate:   startDate,
-		EndDate:     nil, // По умолчанию подписка бессрочная
+	subscription, err := newSubscription(withDefaultPrice(req, svc))
+	if err != nil {
+		return nil, err
 	}
 
 	if err := s.repo.Create(ctx, subscription); err != nil {
@@ -49,6 +46,156 @@ func (s *SubscriptionService) CreateSubscription(
 	return subscription, nil
 }
 
+// maxIdempotencyKeyLength максимальная длина заголовка Idempotency-Key
+const maxIdempotencyKeyLength = 255
+
+// CreateSubscriptionIdempotent создает подписку не более одного раза для
+// ключа идемпотентности. Повторный запрос с тем же ключом и телом получает
+// сохраненный ответ (replayed = true), с другим телом - ErrIdempotencyMismatch
+func (s *SubscriptionService) CreateSubscriptionIdempotent(
+	ctx context.Context,
+	key string,
+	req models.CreateSubscriptionRequest,
+) (*models.Subscription, bool, error) {
+	if len(key) > maxIdempotencyKeyLength {
+		return nil, false, fmt.Errorf("%w: Idempotency-Key must be at most %d characters",
+			models.ErrValidation, maxIdempotencyKeyLength)
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to encode request: %w", err)
+	}
+	hash := sha256.Sum256(body)
+	requestHash := hex.EncodeToString(hash[:])
+
+	// Повтор получает сохраненный ответ без проверки запроса и обращений к
+	// каталогу: исходный запрос уже выполнен успешно
+	stored, err := s.repo.GetIdempotentResponse(ctx, key)
+	if err != nil {
+		return nil, false, err
+	}
+	if stored != nil {
+		return replayedSubscription(stored, key, requestHash)
+	}
+
+	svc, err := s.findService(ctx, req.ServiceName)
+	if err != nil {
+		return nil, false, err
+	}
+
+	subscription, err := newSubscription(withDefaultPrice(req, svc))
+	if err != nil {
+		return nil, false, err
+	}
+
+	// Параллельный запрос с тем же ключом мог успеть выполниться после
+	// проверки выше, поэтому ключ проверяется еще раз при создании
+	stored, err = s.repo.CreateIdempotent(ctx, subscription, models.IdempotencyKey{
+		Key:         key,
+		RequestHash: requestHash,
+		ExpiresAt:   time.Now().Add(s.idempotencyTTL),
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	if stored == nil {
+		return subscription, false, nil
+	}
+	return replayedSubscription(stored, key, requestHash)
+}
+
+// replayedSubscription возвращает сохраненный ответ, если он получен на
+// запрос с тем же телом, иначе ErrIdempotencyMismatch
+func replayedSubscription(
+	stored *models.StoredResponse,
+	key string,
+	requestHash string,
+) (*models.Subscription, bool, error) {
+	if stored.RequestHash != requestHash {
+		return nil, false, fmt.Errorf("%w: key %q", models.ErrIdempotencyMismatch, key)
+	}
+	return stored.Subscription, true, nil
+}
+
+// newSubscription проверяет запрос на создание и собирает из него подписку.
+// Обязательные поля проверяются и здесь, а не только биндингом gin, потому
+// что строки импорта собираются без него. Возвращает ошибки всех полей сразу
+func newSubscription(req models.CreateSubscriptionRequest) (*models.Subscription, error) {
+	validationErr := &models.ValidationError{}
+
+	if strings.TrimSpace(req.ServiceName) == "" {
+		validationErr.Add("service_name", "is required")
+	}
+	switch {
+	case req.Price == 0:
+		validationErr.Add("price", "is required when the service has no default price")
+	case req.Price < 1:
+		validationErr.Add("price", "must be at least 1")
+	}
+	currency := models.DefaultCurrency
+	if req.Currency != "" {
+		currency = normalizeCurrency(validationErr, "currency", req.Currency)
+	}
+	if req.UserID == uuid.Nil {
+		validationErr.Add("user_id", "is required")
+	}
+
+	// Месяц без дня означает начало с первого дня месяца
+	startDate, err := parseStartDate("start_date", req.StartDate)
+	if err != nil {
+		validationErr.Merge(err)
+	}
+
+	// По умолчанию подписка бессрочная. Месяц без дня в end_date означает
+	// действие до конца этого месяца
+	var endDate *time.Time
+	if req.EndDate != nil && *req.EndDate != "" {
+		end, err := parseEndDate("end_date", *req.EndDate)
+		if err != nil {
+			validationErr.Merge(err)
+		} else {
+			endDate = &end
+		}
+	}
+
+	// При неверной start_date порядок дат не проверяется
+	if !startDate.IsZero() {
+		checkDateOrder(validationErr, startDate, endDate)
+	}
+
+	// По умолчанию подписка оплачивается помесячно
+	billingPeriod := req.BillingPeriod
+	if billingPeriod == "" {
+		billingPeriod = models.BillingMonthly
+	}
+	checkBillingPeriod(validationErr, billingPeriod, req.BillingIntervalMonths)
+	checkPromo(validationErr, req.TrialMonths, req.IntroPrice, req.IntroMonths)
+
+	if err := validationErr.Err(); err != nil {
+		slog.Warn("Invalid subscription", "error", err)
+		return nil, err
+	}
+
+	subscription := &models.Subscription{
+		ID:                    uuid.New(),
+		ServiceName:           models.CleanServiceName(req.ServiceName),
+		Price:                 req.Price,
+		Currency:              currency,
+		UserID:                req.UserID,
+		StartDate:             startDate,
+		EndDate:               endDate,
+		BillingPeriod:         billingPeriod,
+		BillingIntervalMonths: req.BillingIntervalMonths,
+		TrialMonths:           req.TrialMonths,
+		IntroPrice:            req.IntroPrice,
+		IntroMonths:           req.IntroMonths,
+	}
+	subscription.SetComputed(time.Now())
+	return subscription, nil
+}
+
 func (s *SubscriptionService) GetSubscriptionByID(
 	ctx context.Context,
 	id uuid.UUID,
@@ -56,11 +203,13 @@ func (s *SubscriptionService) GetSubscriptionByID(
 	return s.repo.GetByID(ctx, id)
 }
 
-// UpdateSubscription обновляет подписку
+// UpdateSubscription обновляет подписку. Если expectedVersion задан (из
+// If-Match), обновление выполняется только для этой версии подписки
 func (s *SubscriptionService) UpdateSubscription(
 	ctx context.Context,
 	id uuid.UUID,
 	req models.UpdateSubscriptionRequest,
+	expectedVersion *int,
 ) (*models.Subscription, error) {
 	// Получаем существующую подписку
 	existing, err := s.repo.GetByID(ctx, id)
@@ -68,34 +217,93 @@ func (s *SubscriptionService) UpdateSubscription(
 		return nil, err
 	}
 
+	if expectedVersion != nil && existing.Version != *expectedVersion {
+		return nil, fmt.Errorf("%w: subscription %s has version %d, expected %d",
+			models.ErrPreconditionFailed, id, existing.Version, *expectedVersion)
+	}
+
 	// Обновляем поля если они предоставлены
+	validationErr := &models.ValidationError{}
+	datesValid := true
 	if req.ServiceName != nil {
-		existing.ServiceName = *req.ServiceName
+		if strings.TrimSpace(*req.ServiceName) == "" {
+			validationErr.Add("service_name", "must not be empty")
+		}
+		existing.ServiceName = models.CleanServiceName(*req.ServiceName)
 	}
 	if req.Price != nil {
+		if *req.Price < 1 {
+			validationErr.Add("price", "must be at least 1")
+		}
 		existing.Price = *req.Price
 	}
+	if req.Currency != nil {
+		existing.Currency = normalizeCurrency(validationErr, "currency", *req.Currency)
+	}
 	if req.StartDate != nil {
-		startDate, err := time.Parse("01-2006", *req.StartDate)
+		startDate, err := parseStartDate("start_date", *req.StartDate)
 		if err != nil {
-			return nil, fmt.Errorf("invalid start date format: %w", err)
+			validationErr.Merge(err)
+			datesValid = false
+		} else {
+			existing.StartDate = startDate
 		}
-		existing.StartDate = time.Date(startDate.Year(), startDate.Month(), 1, 0, 0, 0, 0, time.UTC)
 	}
 	if req.EndDate != nil {
 		if *req.EndDate == "" {
 			existing.EndDate = nil
 		} else {
-			endDate, err := time.Parse("01-2006", *req.EndDate)
+			// Месяц без дня означает действие до конца месяца
+			endDate, err := parseEndDate("end_date", *req.EndDate)
 			if err != nil {
-				return nil, fmt.Errorf("invalid end date format: %w", err)
+				validationErr.Merge(err)
+				datesValid = false
+			} else {
+				existing.EndDate = &endDate
 			}
-			// Устанавливаем конец месяца
-			endDate = time.Date(endDate.Year(), endDate.Month()+1, 0, 0, 0, 0, 0, time.UTC)
-			existing.EndDate = &endDate
 		}
 	}
 
+	// При смене периода на не custom прежнее число месяцев сбрасывается
+	if req.BillingPeriod != nil {
+		existing.BillingPeriod = *req.BillingPeriod
+		if existing.BillingPeriod != models.BillingCustom {
+			existing.BillingIntervalMonths = nil
+		}
+	}
+	if req.BillingIntervalMonths != nil {
+		existing.BillingIntervalMonths = req.BillingIntervalMonths
+	}
+	checkBillingPeriod(validationErr, existing.BillingPeriod, existing.BillingIntervalMonths)
+
+	// Ноль убирает пробный период или вводную цену
+	if req.TrialMonths != nil {
+		existing.TrialMonths = req.TrialMonths
+		if *req.TrialMonths == 0 {
+			existing.TrialMonths = nil
+		}
+	}
+	if req.IntroPrice != nil {
+		existing.IntroPrice = req.IntroPrice
+	}
+	if req.IntroMonths != nil {
+		existing.IntroMonths = req.IntroMonths
+		if *req.IntroMonths == 0 {
+			existing.IntroPrice = nil
+			existing.IntroMonths = nil
+		}
+	}
+	checkPromo(validationErr, existing.TrialMonths, existing.IntroPrice, existing.IntroMonths)
+
+	// Порядок дат проверяется с учетом полей, которые не менялись
+	if datesValid {
+		checkDateOrder(validationErr, existing.StartDate, existing.EndDate)
+	}
+	if err := validationErr.Err(); err != nil {
+		return nil, err
+	}
+	existing.SetComputed(time.Now())
+
 	if err := s.repo.Update(ctx, existing); err != nil {
 		return nil, err
 	}
@@ -103,40 +311,365 @@ func (s *SubscriptionService) UpdateSubscription(
 	return existing, nil
 }
 
-// DeleteSubscription удаляет подписку
-func (s *SubscriptionService) DeleteSubscription(ctx context.Context, id uuid.UUID) error {
-	return s.repo.Delete(ctx, id)
+// DeleteSubscription помечает подписку удаленной. Если expectedVersion задан
+// (из If-Match), удаляется только эта версия подписки
+func (s *SubscriptionService) DeleteSubscription(ctx context.Context, id uuid.UUID, expectedVersion *int) error {
+	return s.repo.Delete(ctx, id, expectedVersion)
 }
 
-// GetSubscriptionsByUserID возвращает подписки пользователя
-func (s *SubscriptionService) GetSubscriptionsByUserID(
+// RestoreSubscription восстанавливает удаленную, но еще не очищенную подписку
+func (s *SubscriptionService) RestoreSubscription(ctx context.Context, id uuid.UUID) (*models.Subscription, error) {
+	return s.repo.Restore(ctx, id)
+}
+
+// GetSubscriptionHistory возвращает журнал изменений подписки, в том числе
+// уже удаленной
+func (s *SubscriptionService) GetSubscriptionHistory(
+	ctx context.Context,
+	id uuid.UUID,
+) ([]models.SubscriptionEvent, error) {
+	return s.repo.GetHistory(ctx, id)
+}
+
+// Параметры пагинации списка подписок
+const (
+	defaultListLimit = 50
+	maxListLimit     = 1000
+)
+
+// ListSubscriptions возвращает страницу подписок по фильтрам и курсор
+// следующей страницы (пустой, если страница последняя)
+func (s *SubscriptionService) ListSubscriptions(
 	ctx context.Context,
-	userID uuid.UUID,
-) ([]*models.Subscription, error) {
-	return s.repo.GetByUserID(ctx, userID)
+	req models.ListSubscriptionsRequest,
+) ([]*models.Subscription, string, error) {
+	filter, err := newSubscriptionFilter(req)
+	if err != nil {
+		return nil, "", err
+	}
+	if filter.ServiceName, err = s.canonicalServiceName(ctx, filter.ServiceName); err != nil {
+		return nil, "", err
+	}
+
+	if filter.Limit <= 0 {
+		filter.Limit = defaultListLimit
+	}
+	if filter.Limit > maxListLimit {
+		filter.Limit = maxListLimit
+	}
+
+	if req.Cursor != "" {
+		cursor, err := decodeCursor(req.Cursor, filter.SortBy, filter.Desc)
+		if err != nil {
+			return nil, "", err
+		}
+		filter.After = cursor
+	}
+
+	// Запрашиваем на одну подписку больше, чтобы понять, есть ли следующая страница
+	limit := filter.Limit
+	filter.Limit++
+
+	subscriptions, err := s.repo.List(ctx, filter)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if len(subscriptions) <= limit {
+		return subscriptions, "", nil
+	}
+
+	subscriptions = subscriptions[:limit]
+	last := subscriptions[limit-1]
+	nextCursor := encodeCursor(models.ListCursor{
+		SortBy: filter.SortBy,
+		Desc:   filter.Desc,
+		Value:  last.SortValue(filter.SortBy),
+		ID:     last.ID,
+	})
+
+	return subscriptions, nextCursor, nil
 }
 
-// GetTotalSpent вычисляет суммарные траты за период
+// ExportSubscriptions передает в fn все подписки, удовлетворяющие фильтрам
+// списка, без пагинации (limit и cursor не используются). Ошибки в
+// параметрах возвращаются до первого вызова fn
+func (s *SubscriptionService) ExportSubscriptions(
+	ctx context.Context,
+	req models.ListSubscriptionsRequest,
+	fn func(sub *models.Subscription) error,
+) error {
+	filter, err := newSubscriptionFilter(req)
+	if err != nil {
+		return err
+	}
+	if filter.ServiceName, err = s.canonicalServiceName(ctx, filter.ServiceName); err != nil {
+		return err
+	}
+	return s.repo.Export(ctx, filter, fn)
+}
+
+// newSubscriptionFilter проверяет фильтры и сортировку списка подписок
+func newSubscriptionFilter(req models.ListSubscriptionsRequest) (models.SubscriptionFilter, error) {
+	filter := models.SubscriptionFilter{
+		UserID:      req.UserID,
+		ServiceName: req.ServiceName,
+		MinPrice:    req.MinPrice,
+		MaxPrice:    req.MaxPrice,
+		SortBy:      req.SortBy,
+		Limit:       req.Limit,
+	}
+
+	validationErr := &models.ValidationError{}
+
+	if filter.SortBy == "" {
+		filter.SortBy = models.SortByStartDate
+	}
+	switch filter.SortBy {
+	case models.SortByStartDate, models.SortByPrice, models.SortByServiceName:
+	default:
+		validationErr.Add("sort_by", "expected start_date, price or service_name")
+	}
+
+	switch req.Order {
+	case "", "desc":
+		filter.Desc = true
+	case "asc":
+	default:
+		validationErr.Add("order", "expected asc or desc")
+	}
+
+	if filter.MinPrice != nil && filter.MaxPrice != nil && *filter.MinPrice > *filter.MaxPrice {
+		validationErr.Add("min_price", "must not be greater than max_price")
+	}
+
+	dates := []struct {
+		field string
+		value *string
+		dest  **time.Time
+		parse func(field, value string) (time.Time, error)
+	}{
+		{"active_at", req.ActiveAt, &filter.ActiveFrom, parseStartDate},
+		{"active_at", req.ActiveAt, &filter.ActiveTo, parseEndDate},
+		{"start_from", req.StartFrom, &filter.StartFrom, parseStartDate},
+		{"start_to", req.StartTo, &filter.StartTo, parseEndDate},
+		{"end_from", req.EndFrom, &filter.EndFrom, parseStartDate},
+		{"end_to", req.EndTo, &filter.EndTo, parseEndDate},
+	}
+	for _, date := range dates {
+		if date.value == nil {
+			continue
+		}
+		parsed, err := date.parse(date.field, *date.value)
+		if err != nil {
+			// active_at разбирается дважды, ошибка нужна одна
+			if date.dest != &filter.ActiveTo {
+				validationErr.Merge(err)
+			}
+			continue
+		}
+		*date.dest = &parsed
+	}
+
+	if req.TrialEndsWithin != nil {
+		now := time.Now()
+		today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+		last := today.AddDate(0, 0, *req.TrialEndsWithin)
+		filter.TrialEndFrom = &today
+		filter.TrialEndTo = &last
+	}
+
+	for _, tag := range req.Tags {
+		key := models.TagKey(tag)
+		if key == "" {
+			validationErr.Add("tag", "must not be empty")
+			break
+		}
+		filter.Tags = append(filter.Tags, key)
+	}
+
+	return filter, validationErr.Err()
+}
+
+// GetTotalSpent вычисляет суммарные траты за период: цену каждого периода
+// оплаты подписки в нем, за неполные периоды - пропорционально числу дней.
+// Если задана currency, списания каждого месяца пересчитываются в нее по
+// курсу, действующему в этом месяце, иначе подписки должны быть в одной
+// валюте
 func (s *SubscriptionService) GetTotalSpent(
 	ctx context.Context,
 	fromStr string,
 	toStr string,
 	userID *uuid.UUID,
 	serviceName *string,
-) (int, error) {
-	// Парсим даты
-	from, err := time.Parse("01-2006", fromStr)
+	currency *string,
+) (*models.TotalSpentResponse, error) {
+	filter, err := s.spendFilter(ctx, fromStr, toStr, userID, serviceName)
+	if err != nil {
+		return nil, err
+	}
+
+	if currency != nil {
+		validationErr := &models.ValidationError{}
+		target := normalizeCurrency(validationErr, "currency", *currency)
+		if err := validationErr.Err(); err != nil {
+			return nil, err
+		}
+		filter.Currency = &target
+	} else if err := s.checkSingleCurrency(ctx, filter, "pass currency to convert them"); err != nil {
+		return nil, err
+	}
+
+	total, err := s.repo.GetTotalSpent(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &models.TotalSpentResponse{Total: total}
+	if filter.Currency != nil {
+		response.Currency = *filter.Currency
+	}
+	return response, nil
+}
+
+// GetMonthlySpent возвращает помесячную разбивку трат за период
+func (s *SubscriptionService) GetMonthlySpent(
+	ctx context.Context,
+	fromStr string,
+	toStr string,
+	userID *uuid.UUID,
+	serviceName *string,
+) ([]models.MonthlySpent, error) {
+	filter, err := s.spendFilter(ctx, fromStr, toStr, userID, serviceName)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkSingleCurrency(ctx, filter, "narrow the filter by user_id or service_name"); err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetMonthlySpent(ctx, filter)
+}
+
+// defaultBreakdownLimit количество групп в разбивке трат по умолчанию
+const defaultBreakdownLimit = 10
+
+// GetSpentBreakdown возвращает траты за период, сгруппированные по
+// сервису и/или пользователю, в порядке убывания суммы
+func (s *SubscriptionService) GetSpentBreakdown(
+	ctx context.Context,
+	req models.SpentBreakdownRequest,
+) ([]models.SpentGroup, error) {
+	filter, err := s.spendFilter(ctx, req.From, req.To, req.UserID, req.ServiceName)
+	if err != nil {
+		return nil, err
+	}
+
+	groupBy, err := parseGroupBy(req.GroupBy)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultBreakdownLimit
+	}
+
+	if err := s.checkSingleCurrency(ctx, filter, "narrow the filter by user_id or service_name"); err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetSpentBreakdown(ctx, filter, groupBy, limit)
+}
+
+// parseGroupBy разбирает список измерений группировки, разделенных запятой
+func parseGroupBy(value string) ([]string, error) {
+	var groupBy []string
+	seen := make(map[string]bool)
+
+	for _, dimension := range strings.Split(value, ",") {
+		dimension = strings.TrimSpace(dimension)
+		switch dimension {
+		case models.GroupByServiceName, models.GroupByUserID, models.GroupByTag:
+		default:
+			return nil, models.NewValidationError("group_by",
+				fmt.Sprintf("invalid dimension %q, expected service_name, user_id or tag", dimension))
+		}
+
+		if !seen[dimension] {
+			seen[dimension] = true
+			groupBy = append(groupBy, dimension)
+		}
+	}
+
+	return groupBy, nil
+}
+
+// spendFilter разбирает фильтр аналитики как newSpendFilter и приводит
+// название сервиса к названию из каталога
+func (s *SubscriptionService) spendFilter(
+	ctx context.Context,
+	fromStr string,
+	toStr string,
+	userID *uuid.UUID,
+	serviceName *string,
+) (models.SpendFilter, error) {
+	filter, err := newSpendFilter(fromStr, toStr, userID, serviceName)
+	if err != nil {
+		return filter, err
+	}
+	filter.ServiceName, err = s.canonicalServiceName(ctx, filter.ServiceName)
+	return filter, err
+}
+
+// checkSingleCurrency возвращает ошибку валидации, если подписки фильтра
+// оплачиваются в разных валютах: их суммы нельзя складывать без пересчета.
+// hint подсказывает, как получить сумму в одной валюте
+func (s *SubscriptionService) checkSingleCurrency(ctx context.Context, filter models.SpendFilter, hint string) error {
+	currencies, err := s.repo.GetSpendCurrencies(ctx, filter)
+	if err != nil {
+		return err
+	}
+	if len(currencies) > 1 {
+		return models.NewValidationError("currency", fmt.Sprintf(
+			"subscriptions are charged in several currencies (%s), %s", strings.Join(currencies, ", "), hint))
+	}
+	return nil
+}
+
+// newSpendFilter разбирает границы периода в формате "YYYY-MM-DD" или
+// "MM-YYYY" (from - с начала месяца, to - до конца месяца)
+func newSpendFilter(
+	fromStr string,
+	toStr string,
+	userID *uuid.UUID,
+	serviceName *string,
+) (models.SpendFilter, error) {
+	validationErr := &models.ValidationError{}
+
+	from, err := parseStartDate("from", fromStr)
 	if err != nil {
-		return 0, fmt.Errorf("invalid 'from' date format: %w", err)
+		validationErr.Merge(err)
 	}
-	from = time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, time.UTC)
 
-	to, err := time.Parse("01-2006", toStr)
+	to, err := parseEndDate("to", toStr)
 	if err != nil {
-		return 0, fmt.Errorf("invalid 'to' date format: %w", err)
+		validationErr.Merge(err)
+	}
+	// Окно включает весь последний день 'to'
+	to = to.Add(23*time.Hour + 59*time.Minute + 59*time.Second)
+
+	if len(validationErr.Fields) == 0 && to.Before(from) {
+		validationErr.Add("to", "must not be before from")
+	}
+	if err := validationErr.Err(); err != nil {
+		return models.SpendFilter{}, err
 	}
-	// Устанавливаем конец месяца для 'to'
-	to = time.Date(to.Year(), to.Month()+1, 0, 23, 59, 59, 0, time.UTC)
 
-	return s.repo.GetTotalSpent(ctx, from, to, userID, serviceName)
+	return models.SpendFilter{
+		From:        from,
+		To:          to,
+		UserID:      userID,
+		ServiceName: serviceName,
+	}, nil
 }
@@ -0,0 +1,363 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/NKV510/subscription-service/internal/models"
+	"github.com/NKV510/subscription-service/internal/repository/memory"
+	"github.com/google/uuid"
+)
+
+func newTestService(t *testing.T) *SubscriptionService {
+	t.Helper()
+	return NewSubscriptionService(memory.NewSubscriptionRepository(), time.Hour)
+}
+
+// fieldNames возвращает поля ошибки проверки err
+func fieldNames(t *testing.T, err error) []string {
+	t.Helper()
+	var validationErr *models.ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("error = %v, want *models.ValidationError", err)
+	}
+	var fields []string
+	for _, field := range validationErr.Fields {
+		fields = append(fields, field.Field)
+	}
+	return fields
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestCreateSubscription(t *testing.T) {
+	userID := uuid.New()
+	valid := models.CreateSubscriptionRequest{
+		ServiceName: "  Yandex   Plus ",
+		Price:       400,
+		UserID:      userID,
+		StartDate:   "07-2025",
+	}
+
+	tests := []struct {
+		name   string
+		modify func(req *models.CreateSubscriptionRequest)
+		fields []string // nil - подписка создается
+		check  func(t *testing.T, sub *models.Subscription)
+	}{
+		{
+			name: "Defaults",
+			check: func(t *testing.T, sub *models.Subscription) {
+				if sub.ServiceName != "Yandex Plus" || sub.Currency != models.DefaultCurrency ||
+					sub.BillingPeriod != models.BillingMonthly || sub.EndDate != nil {
+					t.Errorf("subscription = %+v, want cleaned name, RUB, monthly, no end date", sub)
+				}
+				if !sub.StartDate.Equal(time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC)) {
+					t.Errorf("start_date = %s, want 2025-07-01", sub.StartDate)
+				}
+				if sub.Version != 1 {
+					t.Errorf("version = %d, want 1", sub.Version)
+				}
+			},
+		},
+		{
+			name: "EndMonth",
+			modify: func(req *models.CreateSubscriptionRequest) {
+				req.EndDate = ptr("09-2025")
+				req.Currency = "usd"
+			},
+			check: func(t *testing.T, sub *models.Subscription) {
+				if sub.EndDate == nil || !sub.EndDate.Equal(time.Date(2025, 9, 30, 0, 0, 0, 0, time.UTC)) {
+					t.Errorf("end_date = %v, want 2025-09-30", sub.EndDate)
+				}
+				if sub.Currency != "USD" {
+					t.Errorf("currency = %s, want USD", sub.Currency)
+				}
+			},
+		},
+		{
+			name: "MissingFields",
+			modify: func(req *models.CreateSubscriptionRequest) {
+				*req = models.CreateSubscriptionRequest{StartDate: "07-2025"}
+			},
+			fields: []string{"service_name", "price", "user_id"},
+		},
+		{
+			name: "InvalidValues",
+			modify: func(req *models.CreateSubscriptionRequest) {
+				req.Price = -1
+				req.StartDate = "2025/07/01"
+				req.BillingPeriod = "daily"
+			},
+			fields: []string{"price", "start_date", "billing_period"},
+		},
+		{
+			name: "EndBeforeStart",
+			modify: func(req *models.CreateSubscriptionRequest) {
+				req.EndDate = ptr("2025-06-30")
+			},
+			fields: []string{"end_date"},
+		},
+		{
+			name: "CustomWithoutInterval",
+			modify: func(req *models.CreateSubscriptionRequest) {
+				req.BillingPeriod = models.BillingCustom
+			},
+			fields: []string{"billing_interval_months"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(t)
+			req := valid
+			if tt.modify != nil {
+				tt.modify(&req)
+			}
+
+			sub, err := s.CreateSubscription(context.Background(), req)
+			if tt.fields != nil {
+				if got := fieldNames(t, err); !slices.Equal(got, tt.fields) {
+					t.Errorf("invalid fields = %v, want %v", got, tt.fields)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("CreateSubscription: %v", err)
+			}
+			tt.check(t, sub)
+
+			stored, err := s.GetSubscriptionByID(context.Background(), sub.ID)
+			if err != nil {
+				t.Fatalf("GetSubscriptionByID: %v", err)
+			}
+			if stored.ServiceName != sub.ServiceName || stored.Version != sub.Version {
+				t.Errorf("stored subscription = %+v, want %+v", stored, sub)
+			}
+		})
+	}
+}
+
+func TestCreateSubscriptionCatalogPrice(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t)
+	if _, err := s.CreateService(ctx, models.CreateServiceRequest{
+		Name:         "Yandex Plus",
+		Aliases:      []string{"Яндекс Плюс"},
+		DefaultPrice: ptr(299),
+	}); err != nil {
+		t.Fatalf("CreateService: %v", err)
+	}
+
+	// Псевдоним приводится к каноническому названию, цена берется из каталога
+	sub, err := s.CreateSubscription(ctx, models.CreateSubscriptionRequest{
+		ServiceName: "яндекс  плюс",
+		UserID:      uuid.New(),
+		StartDate:   "2025-07-15",
+	})
+	if err != nil {
+		t.Fatalf("CreateSubscription: %v", err)
+	}
+	if sub.ServiceName != "Yandex Plus" || sub.ServiceID == nil || sub.Price != 299 {
+		t.Errorf("subscription = name %q, service %v, price %d, want Yandex Plus from the catalog with price 299",
+			sub.ServiceName, sub.ServiceID, sub.Price)
+	}
+}
+
+func TestUpdateSubscription(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t)
+	sub, err := s.CreateSubscription(ctx, models.CreateSubscriptionRequest{
+		ServiceName: "Netflix",
+		Price:       700,
+		UserID:      uuid.New(),
+		StartDate:   "01-2025",
+		EndDate:     ptr("12-2025"),
+	})
+	if err != nil {
+		t.Fatalf("CreateSubscription: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		req     models.UpdateSubscriptionRequest
+		version *int
+		wantErr error
+	}{
+		{"StaleVersion", models.UpdateSubscriptionRequest{Price: ptr(800)}, ptr(sub.Version + 1), models.ErrPreconditionFailed},
+		// Новое начало позже прежнего окончания
+		{"DateOrder", models.UpdateSubscriptionRequest{StartDate: ptr("01-2026")}, nil, models.ErrValidation},
+		{"EmptyName", models.UpdateSubscriptionRequest{ServiceName: ptr(" ")}, nil, models.ErrValidation},
+		{"Valid", models.UpdateSubscriptionRequest{Price: ptr(800), EndDate: ptr("")}, ptr(sub.Version), nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			updated, err := s.UpdateSubscription(ctx, sub.ID, tt.req, tt.version)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("UpdateSubscription error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("UpdateSubscription: %v", err)
+			}
+			if updated.Price != 800 || updated.EndDate != nil || updated.Version != sub.Version+1 {
+				t.Errorf("updated = price %d, end_date %v, version %d, want 800, none, %d",
+					updated.Price, updated.EndDate, updated.Version, sub.Version+1)
+			}
+		})
+	}
+
+	_, err = s.UpdateSubscription(ctx, uuid.New(), models.UpdateSubscriptionRequest{}, nil)
+	if !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("UpdateSubscription of a missing subscription error = %v, want models.ErrNotFound", err)
+	}
+}
+
+func TestListSubscriptions(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t)
+	userID := uuid.New()
+	for i, name := range []string{"Netflix", "Spotify", "Kinopoisk"} {
+		_, err := s.CreateSubscription(ctx, models.CreateSubscriptionRequest{
+			ServiceName: name,
+			Price:       100 * (i + 1),
+			UserID:      userID,
+			StartDate:   "01-2025",
+		})
+		if err != nil {
+			t.Fatalf("CreateSubscription: %v", err)
+		}
+	}
+
+	req := models.ListSubscriptionsRequest{UserID: &userID, SortBy: models.SortByPrice, Order: "asc", Limit: 2}
+	var prices []int
+	for page := 0; page < 3; page++ {
+		subs, cursor, err := s.ListSubscriptions(ctx, req)
+		if err != nil {
+			t.Fatalf("ListSubscriptions: %v", err)
+		}
+		for _, sub := range subs {
+			prices = append(prices, sub.Price)
+		}
+		if cursor == "" {
+			break
+		}
+		req.Cursor = cursor
+	}
+	if !slices.Equal(prices, []int{100, 200, 300}) {
+		t.Errorf("prices over all pages = %v, want [100 200 300]", prices)
+	}
+
+	// Курсор привязан к сортировке, с которой получен
+	req.SortBy = models.SortByServiceName
+	if _, _, err := s.ListSubscriptions(ctx, req); !errors.Is(err, models.ErrValidation) {
+		t.Errorf("ListSubscriptions with a cursor of another sort error = %v, want models.ErrValidation", err)
+	}
+
+	_, _, err := s.ListSubscriptions(ctx, models.ListSubscriptionsRequest{SortBy: "created_at", Order: "up"})
+	if got := fieldNames(t, err); !slices.Equal(got, []string{"sort_by", "order"}) {
+		t.Errorf("invalid fields = %v, want [sort_by order]", got)
+	}
+}
+
+func TestGetTotalSpent(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t)
+	userID := uuid.New()
+	for _, req := range []models.CreateSubscriptionRequest{
+		{ServiceName: "Netflix", Price: 700, UserID: userID, StartDate: "01-2025", EndDate: ptr("03-2025")},
+		{ServiceName: "Spotify", Price: 300, UserID: userID, StartDate: "02-2025"},
+	} {
+		if _, err := s.CreateSubscription(ctx, req); err != nil {
+			t.Fatalf("CreateSubscription: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name        string
+		from, to    string
+		serviceName *string
+		total       int
+		fields      []string
+	}{
+		{name: "AllServices", from: "01-2025", to: "04-2025", total: 3*700 + 3*300},
+		{name: "ServiceFilter", from: "01-2025", to: "04-2025", serviceName: ptr("Netflix"), total: 3 * 700},
+		{name: "InvalidDates", from: "2025", to: "13-2025", fields: []string{"from", "to"}},
+		{name: "ToBeforeFrom", from: "04-2025", to: "01-2025", fields: []string{"to"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.GetTotalSpent(ctx, tt.from, tt.to, &userID, tt.serviceName, nil)
+			if tt.fields != nil {
+				if names := fieldNames(t, err); !slices.Equal(names, tt.fields) {
+					t.Errorf("invalid fields = %v, want %v", names, tt.fields)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetTotalSpent: %v", err)
+			}
+			if got.Total != tt.total {
+				t.Errorf("total = %d, want %d", got.Total, tt.total)
+			}
+		})
+	}
+}
+
+func TestCreateSubscriptionIdempotent(t *testing.T) {
+	userID := uuid.New()
+	first := models.CreateSubscriptionRequest{ServiceName: "Netflix", Price: 700, UserID: userID, StartDate: "01-2025"}
+	other := models.CreateSubscriptionRequest{ServiceName: "Spotify", Price: 300, UserID: userID, StartDate: "01-2025"}
+
+	tests := []struct {
+		name     string
+		ttl      time.Duration
+		retry    models.CreateSubscriptionRequest
+		replayed bool
+		wantErr  error
+	}{
+		{name: "Replay", ttl: time.Hour, retry: first, replayed: true},
+		{name: "OtherPayload", ttl: time.Hour, retry: other, wantErr: models.ErrIdempotencyMismatch},
+		// Истекший ключ принимается заново, в том числе с другим запросом
+		{name: "ExpiredKey", ttl: -time.Second, retry: other},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			s := NewSubscriptionService(memory.NewSubscriptionRepository(), tt.ttl)
+			key := uuid.NewString()
+
+			created, replayed, err := s.CreateSubscriptionIdempotent(ctx, key, first)
+			if err != nil || replayed {
+				t.Fatalf("first CreateSubscriptionIdempotent = replayed %t, %v", replayed, err)
+			}
+
+			sub, replayed, err := s.CreateSubscriptionIdempotent(ctx, key, tt.retry)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("retry error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("retry: %v", err)
+			}
+			if replayed != tt.replayed || (sub.ID == created.ID) != tt.replayed {
+				t.Errorf("retry = %s replayed %t, want replayed %t of %s", sub.ID, replayed, tt.replayed, created.ID)
+			}
+			if sub.ServiceName != tt.retry.ServiceName {
+				t.Errorf("retry service_name = %s, want %s", sub.ServiceName, tt.retry.ServiceName)
+			}
+		})
+	}
+}
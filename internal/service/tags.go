@@ -0,0 +1,90 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/NKV510/subscription-service/internal/models"
+	"github.com/google/uuid"
+)
+
+func (s *SubscriptionService) CreateTag(ctx context.Context, req models.CreateTagRequest) (*models.Tag, error) {
+	validationErr := &models.ValidationError{}
+	tag := &models.Tag{UserID: req.UserID, Name: checkTagName(validationErr, "name", req.Name)}
+	if err := validationErr.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.CreateTag(ctx, tag); err != nil {
+		return nil, err
+	}
+	return tag, nil
+}
+
+// ListTags возвращает теги пользователя userID или, если он не задан, все
+func (s *SubscriptionService) ListTags(ctx context.Context, userID *uuid.UUID) ([]models.Tag, error) {
+	return s.repo.ListTags(ctx, userID)
+}
+
+// RenameTag меняет название тега у всех отмеченных им подписок, увеличивая
+// их версию
+func (s *SubscriptionService) RenameTag(ctx context.Context, id uuid.UUID, req models.TagRequest) (*models.Tag, error) {
+	validationErr := &models.ValidationError{}
+	tag := &models.Tag{ID: id, Name: checkTagName(validationErr, "name", req.Name)}
+	if err := validationErr.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.RenameTag(ctx, tag); err != nil {
+		return nil, err
+	}
+	return tag, nil
+}
+
+// DeleteTag удаляет тег и снимает его со всех подписок, увеличивая их версию
+func (s *SubscriptionService) DeleteTag(ctx context.Context, id uuid.UUID) error {
+	return s.repo.DeleteTag(ctx, id)
+}
+
+// SetSubscriptionTags заменяет теги подписки тегами ее пользователя; теги,
+// которых у него еще нет, создаются. Названия, совпадающие без учета регистра, считаются одним тегом
+func (s *SubscriptionService) SetSubscriptionTags(
+	ctx context.Context,
+	id uuid.UUID,
+	req models.SetTagsRequest,
+	expectedVersion *int,
+) (*models.Subscription, error) {
+	validationErr := &models.ValidationError{}
+
+	seen := make(map[string]bool)
+	names := make([]string, 0, len(req.Tags))
+	for _, name := range req.Tags {
+		name = checkTagName(validationErr, "tags", name)
+		key := models.TagKey(name)
+		if key != "" && !seen[key] {
+			seen[key] = true
+			names = append(names, name)
+		}
+	}
+	if len(names) > models.MaxSubscriptionTags {
+		validationErr.Add("tags", fmt.Sprintf("must contain at most %d tags", models.MaxSubscriptionTags))
+	}
+	if err := validationErr.Err(); err != nil {
+		return nil, err
+	}
+
+	return s.repo.SetTags(ctx, id, names, expectedVersion)
+}
+
+// checkTagName проверяет название тега и возвращает его без лишних пробелов
+func checkTagName(validationErr *models.ValidationError, field, name string) string {
+	name = models.CleanServiceName(name)
+	switch {
+	case name == "":
+		validationErr.Add(field, "must not be empty")
+	case utf8.RuneCountInString(name) > models.MaxTagNameLength:
+		validationErr.Add(field, fmt.Sprintf("must be at most %d characters", models.MaxTagNameLength))
+	}
+	return name
+}
@@ -0,0 +1,57 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/NKV510/subscription-service/internal/models"
+)
+
+// defaultUpcomingDays горизонт предстоящих списаний по умолчанию
+const defaultUpcomingDays = 30
+
+// GetUpcomingCharges возвращает списания, которые придутся на ближайшие
+// req.Days дней начиная с сегодняшнего, с суммами по валютам
+func (s *SubscriptionService) GetUpcomingCharges(
+	ctx context.Context,
+	req models.UpcomingChargesRequest,
+) (*models.UpcomingChargesResponse, error) {
+	days := req.Days
+	if days <= 0 {
+		days = defaultUpcomingDays
+	}
+	days = min(days, models.MaxUpcomingDays)
+
+	now := time.Now()
+	from := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 0, days-1)
+
+	serviceName, err := s.canonicalServiceName(ctx, req.ServiceName)
+	if err != nil {
+		return nil, err
+	}
+
+	charges, err := s.repo.ListCharges(ctx, models.SpendFilter{
+		From:        from,
+		To:          to,
+		UserID:      req.UserID,
+		ServiceName: serviceName,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	response := &models.UpcomingChargesResponse{
+		From:    from,
+		To:      to,
+		Charges: charges,
+		Totals:  make(map[string]int),
+	}
+	if response.Charges == nil {
+		response.Charges = []models.Charge{}
+	}
+	for _, charge := range charges {
+		response.Totals[charge.Currency] += charge.Amount
+	}
+	return response, nil
+}
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/NKV510/subscription-service/internal/models"
+	"github.com/google/uuid"
+)
+
+func TestGetUpcomingCharges(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t)
+	now := time.Now()
+	today := date(now.Year(), now.Month(), now.Day())
+	userID := uuid.New()
+
+	// Подписка с 15-го числа списывается 15-го, а не первого числа месяца
+	start := date(today.Year(), today.Month()-2, 15)
+	next := date(today.Year(), today.Month(), 15)
+	if today.Day() > 15 {
+		next = date(today.Year(), today.Month()+1, 15)
+	}
+	for _, req := range []models.CreateSubscriptionRequest{
+		{ServiceName: "Netflix", Price: 700, UserID: userID, StartDate: start.Format(dayLayout)},
+		{ServiceName: "Spotify", Price: 300, UserID: userID, StartDate: start.Format(dayLayout), Currency: "USD"},
+		{ServiceName: "Kinopoisk", Price: 400, UserID: uuid.New(), StartDate: start.Format(dayLayout)},
+	} {
+		if _, err := s.CreateSubscription(ctx, req); err != nil {
+			t.Fatalf("CreateSubscription: %v", err)
+		}
+	}
+
+	// Окно заканчивается днем списания, чтобы в него попало ровно одно
+	days := int(next.Sub(today).Hours()/24) + 1
+	got, err := s.GetUpcomingCharges(ctx, models.UpcomingChargesRequest{UserID: &userID, Days: days})
+	if err != nil {
+		t.Fatalf("GetUpcomingCharges: %v", err)
+	}
+	if !got.From.Equal(today) || !got.To.Equal(next) {
+		t.Errorf("window = %s..%s, want %s..%s", got.From, got.To, today, next)
+	}
+	if len(got.Charges) != 2 {
+		t.Fatalf("charges = %+v, want Netflix and Spotify on %s", got.Charges, next.Format(dayLayout))
+	}
+	for _, charge := range got.Charges {
+		if !charge.Date.Equal(next) {
+			t.Errorf("%s charge date = %s, want %s", charge.ServiceName, charge.Date.Format(dayLayout), next.Format(dayLayout))
+		}
+	}
+	if got.Totals["RUB"] != 700 || got.Totals["USD"] != 300 || len(got.Totals) != 2 {
+		t.Errorf("totals = %v, want RUB 700 and USD 300", got.Totals)
+	}
+
+	sub, err := s.GetSubscriptionByID(ctx, got.Charges[0].SubscriptionID)
+	if err != nil {
+		t.Fatalf("GetSubscriptionByID: %v", err)
+	}
+	if sub.NextChargeDate == nil || !sub.NextChargeDate.Equal(next) {
+		t.Errorf("next_charge_date = %v, want %s", sub.NextChargeDate, next.Format(dayLayout))
+	}
+}
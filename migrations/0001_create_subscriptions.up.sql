@@ -9,6 +9,6 @@ CREATE TABLE IF NOT EXISTS subscriptions (
     end_date DATE NULL
 );
 
-CREATE INDEX idx_subscriptions_user_id ON subscriptions(user_id);
-CREATE INDEX idx_subscriptions_start_date ON subscriptions(start_date);
-CREATE INDEX idx_subscriptions_service_name ON subscriptions(service_name);
\ No newline at end of file
+CREATE INDEX IF NOT EXISTS idx_subscriptions_user_id ON subscriptions(user_id);
+CREATE INDEX IF NOT EXISTS idx_subscriptions_start_date ON subscriptions(start_date);
+CREATE INDEX IF NOT EXISTS idx_subscriptions_service_name ON subscriptions(service_name);
@@ -0,0 +1,15 @@
+-- Журнал изменений подписок. Внешнего ключа на subscriptions нет, чтобы
+-- история удаленной подписки сохранялась
+CREATE TABLE IF NOT EXISTS subscription_events (
+    id BIGSERIAL PRIMARY KEY,
+    subscription_id UUID NOT NULL,
+    event_type VARCHAR(32) NOT NULL,
+    old_values JSONB NULL,
+    new_values JSONB NULL,
+    actor VARCHAR(255) NULL,
+    request_id VARCHAR(255) NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_subscription_events_subscription_id
+    ON subscription_events(subscription_id, id);
@@ -0,0 +1,7 @@
+-- Без колонки deleted_at удаленные подписки снова стали бы видны
+DELETE FROM subscriptions WHERE deleted_at IS NOT NULL;
+
+DROP INDEX IF EXISTS idx_subscriptions_deleted_at;
+
+ALTER TABLE subscriptions
+    DROP COLUMN IF EXISTS deleted_at;
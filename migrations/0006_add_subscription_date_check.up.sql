@@ -0,0 +1,7 @@
+-- NOT VALID: ограничение действует для новых и измененных строк, но не
+-- проверяет уже существующие, чтобы миграция не падала на старых данных.
+-- После исправления таких строк можно выполнить
+-- ALTER TABLE subscriptions VALIDATE CONSTRAINT subscriptions_end_date_check;
+ALTER TABLE subscriptions
+    ADD CONSTRAINT subscriptions_end_date_check
+    CHECK (end_date IS NULL OR end_date >= start_date) NOT VALID;
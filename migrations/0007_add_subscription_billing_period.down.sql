@@ -0,0 +1,7 @@
+ALTER TABLE subscriptions
+    DROP CONSTRAINT IF EXISTS subscriptions_billing_interval_months_check,
+    DROP CONSTRAINT IF EXISTS subscriptions_billing_period_check;
+
+ALTER TABLE subscriptions
+    DROP COLUMN IF EXISTS billing_interval_months,
+    DROP COLUMN IF EXISTS billing_period;
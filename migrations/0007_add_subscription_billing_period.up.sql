@@ -0,0 +1,12 @@
+-- Существующие подписки оплачивались помесячно
+ALTER TABLE subscriptions
+    ADD COLUMN billing_period VARCHAR(16) NOT NULL DEFAULT 'monthly',
+    ADD COLUMN billing_interval_months INTEGER NULL;
+
+-- Число месяцев задается только для периода custom и обязательно для него
+ALTER TABLE subscriptions
+    ADD CONSTRAINT subscriptions_billing_period_check
+    CHECK (billing_period IN ('weekly', 'monthly', 'quarterly', 'yearly', 'custom')),
+    ADD CONSTRAINT subscriptions_billing_interval_months_check
+    CHECK ((billing_period = 'custom') = (billing_interval_months IS NOT NULL)
+           AND (billing_interval_months IS NULL OR billing_interval_months BETWEEN 1 AND 120));
@@ -0,0 +1,14 @@
+-- Существующие цены указаны в рублях
+ALTER TABLE subscriptions
+    ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'RUB'
+    CONSTRAINT subscriptions_currency_check CHECK (currency ~ '^[A-Z]{3}$');
+
+-- Курс from_currency -> to_currency действует с date до следующего курса
+-- той же пары
+CREATE TABLE IF NOT EXISTS exchange_rates (
+    date DATE NOT NULL,
+    from_currency CHAR(3) NOT NULL CHECK (from_currency ~ '^[A-Z]{3}$'),
+    to_currency CHAR(3) NOT NULL CHECK (to_currency ~ '^[A-Z]{3}$'),
+    rate NUMERIC(20, 10) NOT NULL CHECK (rate > 0),
+    PRIMARY KEY (from_currency, to_currency, date)
+);
@@ -0,0 +1,14 @@
+-- Приостановки подписок: списания с paused_from до resumed_from (не
+-- включая) пропускаются, без resumed_from подписка приостановлена бессрочно
+CREATE TABLE IF NOT EXISTS subscription_pauses (
+    subscription_id UUID NOT NULL REFERENCES subscriptions(id) ON DELETE CASCADE,
+    paused_from DATE NOT NULL,
+    resumed_from DATE NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (subscription_id, paused_from),
+    CONSTRAINT subscription_pauses_resumed_from_check CHECK (resumed_from IS NULL OR resumed_from > paused_from)
+);
+
+-- Незавершенной может быть только одна приостановка подписки
+CREATE UNIQUE INDEX IF NOT EXISTS idx_subscription_pauses_open
+    ON subscription_pauses(subscription_id) WHERE resumed_from IS NULL;
@@ -0,0 +1,16 @@
+-- Отмены подписок: последний оплачиваемый месяц и причина. У подписки одна
+-- отмена, повторная отмена ее заменяет
+CREATE TABLE IF NOT EXISTS subscription_cancellations (
+    subscription_id UUID PRIMARY KEY REFERENCES subscriptions(id) ON DELETE CASCADE,
+    effective_month DATE NOT NULL,
+    reason_code VARCHAR(32) NOT NULL,
+    reason_text TEXT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CONSTRAINT subscription_cancellations_effective_month_check
+        CHECK (effective_month = date_trunc('month', effective_month)::date),
+    CONSTRAINT subscription_cancellations_reason_code_check
+        CHECK (reason_code IN ('too_expensive', 'not_using', 'switched_service', 'technical_issues', 'other'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_subscription_cancellations_effective_month
+    ON subscription_cancellations(effective_month);
@@ -0,0 +1,11 @@
+DROP INDEX IF EXISTS idx_subscriptions_trial;
+
+ALTER TABLE subscriptions
+    DROP CONSTRAINT IF EXISTS subscriptions_intro_months_check,
+    DROP CONSTRAINT IF EXISTS subscriptions_intro_price_check,
+    DROP CONSTRAINT IF EXISTS subscriptions_trial_months_check;
+
+ALTER TABLE subscriptions
+    DROP COLUMN IF EXISTS intro_months,
+    DROP COLUMN IF EXISTS intro_price,
+    DROP COLUMN IF EXISTS trial_months;
@@ -0,0 +1,18 @@
+-- Пробный период и вводная цена: первые trial_months месяцев бесплатны,
+-- следующие intro_months месяцев списывается intro_price
+ALTER TABLE subscriptions
+    ADD COLUMN trial_months INTEGER NULL,
+    ADD COLUMN intro_price INTEGER NULL,
+    ADD COLUMN intro_months INTEGER NULL;
+
+ALTER TABLE subscriptions
+    ADD CONSTRAINT subscriptions_trial_months_check
+    CHECK (trial_months IS NULL OR trial_months BETWEEN 1 AND 24),
+    ADD CONSTRAINT subscriptions_intro_price_check
+    CHECK ((intro_price IS NULL) = (intro_months IS NULL) AND (intro_price IS NULL OR intro_price >= 0)),
+    ADD CONSTRAINT subscriptions_intro_months_check
+    CHECK (intro_months IS NULL OR intro_months BETWEEN 1 AND 24);
+
+-- Выборка подписок, у которых скоро заканчивается пробный период
+CREATE INDEX IF NOT EXISTS idx_subscriptions_trial
+    ON subscriptions(start_date) WHERE trial_months IS NOT NULL;
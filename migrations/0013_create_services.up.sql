@@ -0,0 +1,50 @@
+-- Каталог сервисов: каноническое название, под которым хранятся подписки,
+-- и цена по умолчанию для новых подписок
+CREATE TABLE IF NOT EXISTS services (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name VARCHAR(255) NOT NULL,
+    default_price INTEGER NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CONSTRAINT services_default_price_check CHECK (default_price IS NULL OR default_price >= 1)
+);
+
+-- Все написания сервиса, включая каноническое. name_key - название в
+-- нижнем регистре со схлопнутыми пробелами, одно написание принадлежит
+-- одному сервису
+CREATE TABLE IF NOT EXISTS service_names (
+    name_key VARCHAR(255) PRIMARY KEY,
+    service_id UUID NOT NULL REFERENCES services(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_service_names_service_id ON service_names(service_id);
+
+-- При удалении сервиса из каталога подписки сохраняют название
+ALTER TABLE subscriptions
+    ADD COLUMN service_id UUID NULL
+    CONSTRAINT subscriptions_service_id_fkey REFERENCES services(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_subscriptions_service_id ON subscriptions(service_id);
+
+-- Заполнение каталога существующими названиями: написания, совпадающие без
+-- учета регистра и пробелов, - один сервис, каноническое название - самое
+-- частое из них
+WITH spellings AS (
+    SELECT regexp_replace(btrim(service_name), '\s+', ' ', 'g') AS name, COUNT(*) AS uses
+    FROM subscriptions
+    GROUP BY 1
+)
+INSERT INTO services (name)
+SELECT DISTINCT ON (lower(name)) name
+FROM spellings
+ORDER BY lower(name), uses DESC, name;
+
+INSERT INTO service_names (name_key, service_id, name)
+SELECT lower(name), id, name
+FROM services;
+
+UPDATE subscriptions s
+SET service_id = sv.id, service_name = sv.name
+FROM services sv
+WHERE lower(sv.name) = lower(regexp_replace(btrim(s.service_name), '\s+', ' ', 'g'));
@@ -0,0 +1,20 @@
+-- Теги разных пользователей с одним ключом сливаются в самый ранний из них
+CREATE TEMPORARY TABLE tag_survivors ON COMMIT DROP AS
+SELECT DISTINCT ON (name_key) name_key, id
+FROM tags
+ORDER BY name_key, created_at, id;
+
+INSERT INTO subscription_tags (subscription_id, tag_id)
+SELECT st.subscription_id, sv.id
+FROM subscription_tags st
+JOIN tags t ON t.id = st.tag_id
+JOIN tag_survivors sv ON sv.name_key = t.name_key
+ON CONFLICT DO NOTHING;
+
+DELETE FROM tags t
+WHERE NOT EXISTS (SELECT 1 FROM tag_survivors sv WHERE sv.id = t.id);
+
+ALTER TABLE tags
+    DROP CONSTRAINT tags_user_id_name_key_key,
+    DROP COLUMN user_id,
+    ADD CONSTRAINT tags_name_key_key UNIQUE (name_key);
@@ -0,0 +1,32 @@
+-- Теги становятся своими у каждого пользователя. Тег, которым отмечены
+-- подписки нескольких пользователей, копируется каждому из них; тег без
+-- подписок удаляется, так как его владельца не определить
+ALTER TABLE tags
+    ADD COLUMN user_id UUID NULL,
+    DROP CONSTRAINT tags_name_key_key;
+
+CREATE TEMPORARY TABLE tag_owners ON COMMIT DROP AS
+SELECT o.tag_id, o.user_id, gen_random_uuid() AS new_id
+FROM (
+    SELECT DISTINCT st.tag_id, s.user_id
+    FROM subscription_tags st
+    JOIN subscriptions s ON s.id = st.subscription_id
+) AS o;
+
+INSERT INTO tags (id, user_id, name, name_key, created_at)
+SELECT o.new_id, o.user_id, t.name, t.name_key, t.created_at
+FROM tag_owners o
+JOIN tags t ON t.id = o.tag_id;
+
+UPDATE subscription_tags st
+SET tag_id = o.new_id
+FROM subscriptions s, tag_owners o
+WHERE s.id = st.subscription_id
+  AND o.tag_id = st.tag_id
+  AND o.user_id = s.user_id;
+
+DELETE FROM tags WHERE user_id IS NULL;
+
+ALTER TABLE tags
+    ALTER COLUMN user_id SET NOT NULL,
+    ADD CONSTRAINT tags_user_id_name_key_key UNIQUE (user_id, name_key);
@@ -0,0 +1,2 @@
+-- Пересчет ключей не откатывается: слитые сервисы и привязки подписок
+-- остаются, ключи совпадают с теми, что строит приложение
@@ -0,0 +1,6 @@
+-- Ключи названий сервисов, заполненные в 0013 средствами SQL, пересчитываются
+-- шагом на Go (rekeyServiceNames) через models.ServiceNameKey, которым их
+-- сравнивает приложение: regexp_replace, btrim и lower в postgres понимают
+-- пробелы и регистр иначе, чем strings.Fields и strings.ToLower. Каталог
+-- и подписки блокируются от изменений до конца миграции
+LOCK TABLE services, service_names, subscriptions IN SHARE ROW EXCLUSIVE MODE;
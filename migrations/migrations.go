@@ -0,0 +1,18 @@
+// Package migrations содержит версионированные миграции схемы базы данных.
+// Файлы именуются как NNNN_description.up.sql / NNNN_description.down.sql
+// и встраиваются в бинарник
+package migrations
+
+import (
+	"embed"
+
+	"github.com/NKV510/subscription-service/pkg/migrator"
+)
+
+//go:embed *.sql
+var FS embed.FS
+
+// Funcs шаги миграций на Go по версиям
+var Funcs = map[int64]migrator.Func{
+	16: rekeyServiceNames,
+}
@@ -0,0 +1,257 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/NKV510/subscription-service/internal/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// catalogService сервис каталога с каноническим названием
+type catalogService struct {
+	id   uuid.UUID
+	name string
+}
+
+// catalogName написание сервиса из service_names
+type catalogName struct {
+	key       string
+	serviceID uuid.UUID
+	name      string
+}
+
+// catalogPlan каталог с ключами models.ServiceNameKey
+type catalogPlan struct {
+	survivors map[uuid.UUID]uuid.UUID // сервис - сервис, в который он сливается, или он сам
+	canonical map[uuid.UUID]string    // канонические названия оставшихся сервисов
+	names     map[string]catalogName  // написания по новому ключу
+}
+
+// planCatalog пересчитывает ключи написаний. Сервисы, написания которых
+// совпали по новому ключу, сливаются в самый ранний из них; services
+// упорядочены по времени создания. Каноническое написание сервиса
+// сохраняет свой ключ, остальные написания с тем же ключом отбрасываются
+func planCatalog(services []catalogService, names []catalogName) catalogPlan {
+	order := make(map[uuid.UUID]int, len(services))
+	parent := make(map[uuid.UUID]uuid.UUID, len(services))
+	for i, svc := range services {
+		order[svc.id] = i
+		parent[svc.id] = svc.id
+	}
+	var find func(id uuid.UUID) uuid.UUID
+	find = func(id uuid.UUID) uuid.UUID {
+		if parent[id] != id {
+			parent[id] = find(parent[id])
+		}
+		return parent[id]
+	}
+
+	// Канонические названия идут первыми, чтобы их написание заняло ключ
+	spellings := make([]catalogName, 0, len(services)+len(names))
+	for _, svc := range services {
+		spellings = append(spellings, catalogName{serviceID: svc.id, name: svc.name})
+	}
+	spellings = append(spellings, names...)
+
+	owners := make(map[string]uuid.UUID)
+	for _, spelling := range spellings {
+		key := models.ServiceNameKey(spelling.name)
+		owner, ok := owners[key]
+		if !ok {
+			owners[key] = spelling.serviceID
+			continue
+		}
+		a, b := find(owner), find(spelling.serviceID)
+		if order[b] < order[a] {
+			a, b = b, a
+		}
+		parent[b] = a
+	}
+
+	plan := catalogPlan{
+		survivors: make(map[uuid.UUID]uuid.UUID, len(services)),
+		canonical: make(map[uuid.UUID]string),
+		names:     make(map[string]catalogName, len(owners)),
+	}
+	for _, svc := range services {
+		survivor := find(svc.id)
+		plan.survivors[svc.id] = survivor
+		if survivor == svc.id {
+			plan.canonical[svc.id] = models.CleanServiceName(svc.name)
+		}
+	}
+	for _, spelling := range spellings {
+		key := models.ServiceNameKey(spelling.name)
+		if _, ok := plan.names[key]; ok || key == "" {
+			continue
+		}
+		plan.names[key] = catalogName{
+			key:       key,
+			serviceID: plan.survivors[spelling.serviceID],
+			name:      models.CleanServiceName(spelling.name),
+		}
+	}
+
+	return plan
+}
+
+// link возвращает сервис и название подписки с названием name, привязанной
+// к serviceID (nil - не привязана): написание из каталога привязывает
+// подписку к его сервису под каноническим названием, как при создании
+// подписки; иначе привязка переносится на сервис, в который слит прежний
+func (p catalogPlan) link(serviceID *uuid.UUID, name string) (*uuid.UUID, string) {
+	if spelling, ok := p.names[models.ServiceNameKey(name)]; ok {
+		id := spelling.serviceID
+		return &id, p.canonical[id]
+	}
+	if serviceID == nil {
+		return nil, name
+	}
+	survivor, ok := p.survivors[*serviceID]
+	if !ok {
+		return serviceID, name
+	}
+	return &survivor, name
+}
+
+// rekeyServiceNames пересчитывает ключи каталога сервисов по
+// models.ServiceNameKey, сливает сервисы с совпавшими ключами и заново
+// привязывает подписки по названию. Версия измененных подписок
+// увеличивается
+func rekeyServiceNames(ctx context.Context, tx pgx.Tx) error {
+	rows, err := tx.Query(ctx, `SELECT id, name FROM services ORDER BY created_at, id`)
+	if err != nil {
+		return fmt.Errorf("failed to read services: %w", err)
+	}
+	services, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (catalogService, error) {
+		var svc catalogService
+		err := row.Scan(&svc.id, &svc.name)
+		return svc, err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read services: %w", err)
+	}
+
+	rows, err = tx.Query(ctx, `SELECT name_key, service_id, name FROM service_names ORDER BY name_key`)
+	if err != nil {
+		return fmt.Errorf("failed to read service names: %w", err)
+	}
+	names, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (catalogName, error) {
+		var name catalogName
+		err := row.Scan(&name.key, &name.serviceID, &name.name)
+		return name, err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read service names: %w", err)
+	}
+
+	plan := planCatalog(services, names)
+
+	relinked, err := relinkSubscriptions(ctx, tx, plan)
+	if err != nil {
+		return err
+	}
+
+	var (
+		keys, spellings []string
+		owners          []uuid.UUID
+	)
+	for _, name := range plan.names {
+		keys = append(keys, name.key)
+		owners = append(owners, name.serviceID)
+		spellings = append(spellings, name.name)
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM service_names`); err != nil {
+		return fmt.Errorf("failed to delete service names: %w", err)
+	}
+	_, err = tx.Exec(ctx, `
+        INSERT INTO service_names (name_key, service_id, name)
+        SELECT * FROM unnest($1::text[], $2::uuid[], $3::text[])
+    `, keys, owners, spellings)
+	if err != nil {
+		return fmt.Errorf("failed to insert service names: %w", err)
+	}
+
+	var merged []uuid.UUID
+	for _, svc := range services {
+		if plan.survivors[svc.id] != svc.id {
+			merged = append(merged, svc.id)
+			continue
+		}
+		if canonical := plan.canonical[svc.id]; canonical != svc.name {
+			_, err := tx.Exec(ctx, `UPDATE services SET name = $2, updated_at = now() WHERE id = $1`, svc.id, canonical)
+			if err != nil {
+				return fmt.Errorf("failed to rename service: %w", err)
+			}
+		}
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM services WHERE id = ANY($1)`, merged); err != nil {
+		return fmt.Errorf("failed to delete merged services: %w", err)
+	}
+
+	slog.Info("Service names rekeyed",
+		"services", len(services), "merged", len(merged), "names", len(plan.names), "subscriptions", relinked)
+	return nil
+}
+
+// relinkSubscriptions привязывает подписки, в том числе удаленные, по плану
+// и возвращает число измененных
+func relinkSubscriptions(ctx context.Context, tx pgx.Tx, plan catalogPlan) (int, error) {
+	rows, err := tx.Query(ctx, `SELECT id, service_id, service_name FROM subscriptions`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read subscriptions: %w", err)
+	}
+
+	var (
+		ids          []uuid.UUID
+		serviceIDs   []*uuid.UUID
+		serviceNames []string
+	)
+	for rows.Next() {
+		var (
+			id        uuid.UUID
+			serviceID *uuid.UUID
+			name      string
+		)
+		if err := rows.Scan(&id, &serviceID, &name); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan subscription: %w", err)
+		}
+		newID, newName := plan.link(serviceID, name)
+		if newName == name && equalIDs(newID, serviceID) {
+			continue
+		}
+		ids = append(ids, id)
+		serviceIDs = append(serviceIDs, newID)
+		serviceNames = append(serviceNames, newName)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("error iterating rows: %w", err)
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	_, err = tx.Exec(ctx, `
+        UPDATE subscriptions s
+        SET service_id = u.service_id, service_name = u.service_name,
+            version = s.version + 1, updated_at = now()
+        FROM unnest($1::uuid[], $2::uuid[], $3::text[]) AS u(id, service_id, service_name)
+        WHERE s.id = u.id
+    `, ids, serviceIDs, serviceNames)
+	if err != nil {
+		return 0, fmt.Errorf("failed to relink subscriptions: %w", err)
+	}
+	return len(ids), nil
+}
+
+func equalIDs(a, b *uuid.UUID) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
@@ -0,0 +1,78 @@
+package migrations
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestPlanCatalog(t *testing.T) {
+	// Ключи 0013: lower и regexp_replace в postgres не схлопнули
+	// неразрывный пробел и не привели к нижнему регистру кириллицу
+	yandex := catalogService{id: uuid.New(), name: "Yandex Plus"}
+	yandexNBSP := catalogService{id: uuid.New(), name: "Yandex\u00a0Plus"}
+	kinopoisk := catalogService{id: uuid.New(), name: "Кинопоиск"}
+	kinopoiskUpper := catalogService{id: uuid.New(), name: "КИНОПОИСК"}
+	netflix := catalogService{id: uuid.New(), name: "Netflix"}
+	services := []catalogService{yandex, yandexNBSP, kinopoisk, kinopoiskUpper, netflix}
+	names := []catalogName{
+		{key: "yandex plus", serviceID: yandex.id, name: "Yandex Plus"},
+		{key: "яндекс плюс", serviceID: yandex.id, name: "Яндекс Плюс"},
+		{key: "yandex\u00a0plus", serviceID: yandexNBSP.id, name: "Yandex\u00a0Plus"},
+		{key: "кинопоиск", serviceID: kinopoisk.id, name: "Кинопоиск"},
+		{key: "КИНОПОИСК", serviceID: kinopoiskUpper.id, name: "КИНОПОИСК"},
+		{key: "\tnetflix", serviceID: netflix.id, name: "\tNetflix"},
+		{key: "netflix", serviceID: netflix.id, name: "Netflix"},
+	}
+
+	plan := planCatalog(services, names)
+
+	survivors := map[uuid.UUID]uuid.UUID{
+		yandex.id:         yandex.id,
+		yandexNBSP.id:     yandex.id,
+		kinopoisk.id:      kinopoisk.id,
+		kinopoiskUpper.id: kinopoisk.id,
+		netflix.id:        netflix.id,
+	}
+	for id, want := range survivors {
+		if got := plan.survivors[id]; got != want {
+			t.Errorf("survivor of %s = %s, want %s", id, got, want)
+		}
+	}
+
+	wantNames := map[string]catalogName{
+		"yandex plus": {key: "yandex plus", serviceID: yandex.id, name: "Yandex Plus"},
+		"яндекс плюс": {key: "яндекс плюс", serviceID: yandex.id, name: "Яндекс Плюс"},
+		"кинопоиск":   {key: "кинопоиск", serviceID: kinopoisk.id, name: "Кинопоиск"},
+		"netflix":     {key: "netflix", serviceID: netflix.id, name: "Netflix"},
+	}
+	if len(plan.names) != len(wantNames) {
+		t.Errorf("names = %+v, want %+v", plan.names, wantNames)
+	}
+	for key, want := range wantNames {
+		if got := plan.names[key]; got != want {
+			t.Errorf("name %q = %+v, want %+v", key, got, want)
+		}
+	}
+
+	links := []struct {
+		name      string
+		serviceID *uuid.UUID
+		wantID    *uuid.UUID
+		wantName  string
+	}{
+		// Подписка слитого сервиса переходит к оставшемуся
+		{"Yandex\u00a0Plus", &yandexNBSP.id, &yandex.id, "Yandex Plus"},
+		// Непривязанная подписка с написанием из каталога привязывается
+		{"  кинопоиск ", nil, &kinopoisk.id, "Кинопоиск"},
+		{"ЯНДЕКС\tПЛЮС", nil, &yandex.id, "Yandex Plus"},
+		{"Okko", nil, nil, "Okko"},
+		{"Netflix", &netflix.id, &netflix.id, "Netflix"},
+	}
+	for _, tt := range links {
+		gotID, gotName := plan.link(tt.serviceID, tt.name)
+		if !equalIDs(gotID, tt.wantID) || gotName != tt.wantName {
+			t.Errorf("link(%q) = %v %q, want %v %q", tt.name, gotID, gotName, tt.wantID, tt.wantName)
+		}
+	}
+}
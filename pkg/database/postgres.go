@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"net"
+	"net/url"
 	"time"
 
 	"github.com/NKV510/subscription-service/internal/config"
@@ -11,15 +13,16 @@ import (
 )
 
 func NewDBPool(ctx context.Context, cfg *config.Config) (*pgxpool.Pool, error) {
-	dbURL := fmt.Sprintf(
-		"postgres://%s:%s@%s:%s/%s?sslmode=%s",
-		cfg.Database.User,
-		cfg.Database.Password,
-		cfg.Database.Host,
-		cfg.Database.Port,
-		cfg.Database.Name,
-		cfg.Database.SSLMode,
-	)
+	dbURL := cfg.Database.DSN
+	if dbURL == "" {
+		dbURL = (&url.URL{
+			Scheme:   "postgres",
+			User:     url.UserPassword(cfg.Database.User, cfg.Database.Password),
+			Host:     net.JoinHostPort(cfg.Database.Host, cfg.Database.Port),
+			Path:     cfg.Database.Name,
+			RawQuery: url.Values{"sslmode": {cfg.Database.SSLMode}}.Encode(),
+		}).String()
+	}
 
 	dbConfig, err := pgxpool.ParseConfig(dbURL)
 	if err != nil {
@@ -38,7 +41,7 @@ func NewDBPool(ctx context.Context, cfg *config.Config) (*pgxpool.Pool, error) {
 	for i := 0; i < maxRetries; i++ {
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 
-		slog.Info("Connecting to database ", cfg.Database.Host, cfg.Database.Port)
+		slog.Info("Connecting to database", "host", dbConfig.ConnConfig.Host, "port", dbConfig.ConnConfig.Port)
 
 		dbPool, err = pgxpool.NewWithConfig(ctx, dbConfig)
 		if err != nil {